@@ -0,0 +1,141 @@
+// Copyright (c) 2023 cheng-zhongliang. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package event
+
+import (
+	"hash/fnv"
+	"sync/atomic"
+	"syscall"
+)
+
+// The strategies to distribute the accepted connections to the worker bases.
+const (
+	// DistributeRoundRobin hands the connections to the workers in turn.
+	DistributeRoundRobin = iota
+	// DistributeLeastConns hands a connection to the worker with the fewest connections,
+	// which are counted until they are reported by Acceptor.Done.
+	DistributeLeastConns
+	// DistributeHash hands the connections from the same peer IP to the same worker.
+	// The unix connections are handed in turn.
+	DistributeHash
+)
+
+// Acceptor accepts the connections in one event base and hands them to the worker bases.
+// It works in the main-reactor and sub-reactor model.
+type Acceptor struct {
+	// ln is the listener in the acceptor base.
+	ln *Listener
+	// workers is the worker bases.
+	workers []*EventBase
+	// strategy is the strategy to pick a worker.
+	strategy int
+	// next is the next worker by round-robin.
+	next int
+	// conns is the number of the connections of every worker.
+	conns []int64
+	// cb is the callback function called in the worker base with the accepted connection.
+	cb func(base *EventBase, fd int, sa syscall.Sockaddr, arg interface{})
+	// arg is the argument passed to the callback function.
+	arg interface{}
+}
+
+// NewAcceptor creates a listener on the network address in the acceptor base.
+// Every accepted connection is handed to a worker base picked by the strategy,
+// and the callback function is called in the loop of that worker.
+func NewAcceptor(base *EventBase, network, address string, workers []*EventBase, strategy int, callback func(base *EventBase, fd int, sa syscall.Sockaddr, arg interface{}), arg interface{}) (*Acceptor, error) {
+	if len(workers) == 0 {
+		return nil, syscall.EINVAL
+	}
+	a := &Acceptor{
+		workers:  workers,
+		strategy: strategy,
+		conns:    make([]int64, len(workers)),
+		cb:       callback,
+		arg:      arg,
+	}
+	ln, err := NewListener(base, network, address, a.onAccept, nil)
+	if err != nil {
+		return nil, err
+	}
+	a.ln = ln
+	return a, nil
+}
+
+// Listener returns the listener of the acceptor.
+func (a *Acceptor) Listener() *Listener {
+	return a.ln
+}
+
+// Done reports a connection handed to the worker base is closed.
+// It is safe to call from any goroutine.
+func (a *Acceptor) Done(base *EventBase) {
+	for i, w := range a.workers {
+		if w == base {
+			atomic.AddInt64(&a.conns[i], -1)
+			return
+		}
+	}
+}
+
+// Conns returns the number of the connections of every worker.
+func (a *Acceptor) Conns() []int64 {
+	conns := make([]int64, len(a.conns))
+	for i := range a.conns {
+		conns[i] = atomic.LoadInt64(&a.conns[i])
+	}
+	return conns
+}
+
+// Close closes the listener of the acceptor.
+func (a *Acceptor) Close() error {
+	return a.ln.Close()
+}
+
+func (a *Acceptor) onAccept(fd int, sa syscall.Sockaddr, arg interface{}) {
+	i := a.pick(sa)
+	w := a.workers[i]
+	atomic.AddInt64(&a.conns[i], 1)
+	err := w.post(&task{fn: func() {
+		a.cb(w, fd, sa, a.arg)
+	}, cancel: func() {
+		a.drop(i, fd)
+	}})
+	if err != nil {
+		a.drop(i, fd)
+	}
+}
+
+// drop closes the connection not handed to the worker, which is shut down.
+func (a *Acceptor) drop(i, fd int) {
+	atomic.AddInt64(&a.conns[i], -1)
+	syscall.Close(fd)
+}
+
+// pick returns the index of the worker for the connection from the peer.
+func (a *Acceptor) pick(sa syscall.Sockaddr) int {
+	switch a.strategy {
+	case DistributeLeastConns:
+		least := 0
+		for i := 1; i < len(a.conns); i++ {
+			if atomic.LoadInt64(&a.conns[i]) < atomic.LoadInt64(&a.conns[least]) {
+				least = i
+			}
+		}
+		return least
+	case DistributeHash:
+		h := fnv.New32a()
+		switch sa := sa.(type) {
+		case *syscall.SockaddrInet4:
+			h.Write(sa.Addr[:])
+			return int(h.Sum32() % uint32(len(a.workers)))
+		case *syscall.SockaddrInet6:
+			h.Write(sa.Addr[:])
+			return int(h.Sum32() % uint32(len(a.workers)))
+		}
+	}
+	i := a.next
+	a.next = (a.next + 1) % len(a.workers)
+	return i
+}
@@ -0,0 +1,145 @@
+// Copyright (c) 2023 cheng-zhongliang. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package event_test
+
+import (
+	"io"
+	"net"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	. "github.com/cheng-zhongliang/event"
+)
+
+func TestAcceptor(t *testing.T) {
+	for _, strategy := range []int{DistributeRoundRobin, DistributeLeastConns, DistributeHash} {
+		g, err := NewEventBaseGroup(4)
+		if err != nil {
+			t.Fatal(err)
+		}
+		workers := g.Bases()[1:]
+
+		var mu sync.Mutex
+		accepted := map[*EventBase]int{}
+		total := 0
+		a, err := NewAcceptor(g.Bases()[0], "tcp", "127.0.0.1:0", workers, strategy, func(base *EventBase, fd int, sa syscall.Sockaddr, arg interface{}) {
+			syscall.Close(fd)
+			mu.Lock()
+			accepted[base]++
+			total++
+			mu.Unlock()
+		}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sa, err := a.Listener().Addr()
+		if err != nil {
+			t.Fatal(err)
+		}
+		addr := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: sa.(*syscall.SockaddrInet4).Port}
+		g.Start()
+
+		const conns = 30
+		for i := 0; i < conns; i++ {
+			c, err := net.Dial("tcp", addr.String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			c.Close()
+		}
+		for deadline := time.Now().Add(time.Second); ; time.Sleep(time.Millisecond) {
+			mu.Lock()
+			n := total
+			mu.Unlock()
+			if n == conns {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("strategy %d: accepted %d, want %d", strategy, n, conns)
+			}
+		}
+
+		switch strategy {
+		case DistributeRoundRobin, DistributeLeastConns:
+			for _, w := range workers {
+				if accepted[w] != conns/len(workers) {
+					t.Fatalf("strategy %d: accepted %v, want %d each", strategy, accepted, conns/len(workers))
+				}
+			}
+		case DistributeHash:
+			if len(accepted) != 1 {
+				t.Fatalf("connections from one peer spread: %v", accepted)
+			}
+		}
+		if strategy == DistributeLeastConns {
+			a.Done(workers[1])
+			if c := a.Conns(); c[0] != 10 || c[1] != 9 || c[2] != 10 {
+				t.Fatalf("conns %v", c)
+			}
+		}
+
+		g.Shutdown()
+		if err := g.Wait(); err != nil {
+			t.Fatal(err)
+		}
+		a.Close()
+	}
+}
+
+func TestAcceptorWorkerShutdown(t *testing.T) {
+	base, err := NewBase()
+	if err != nil {
+		t.Fatal(err)
+	}
+	worker, err := NewBase()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := NewAcceptor(base, "tcp", "127.0.0.1:0", []*EventBase{worker}, DistributeRoundRobin, func(base *EventBase, fd int, sa syscall.Sockaddr, arg interface{}) {
+		t.Fatal("connection handed to the worker shut down")
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	sa, err := a.Listener().Addr()
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: sa.(*syscall.SockaddrInet4).Port}
+
+	c, err := net.Dial("tcp", addr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	for deadline := time.Now().Add(time.Second); a.Conns()[0] == 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("connection not accepted")
+		}
+		if err := base.Loop(EvLoopOnce | EvLoopNoblock); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the connection posted to the worker is closed when the worker is shut down.
+	if err := worker.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+	if n := a.Conns()[0]; n != 0 {
+		t.Fatalf("conns %d, want 0", n)
+	}
+	c.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := c.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("error %v, want EOF", err)
+	}
+
+	if err := base.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright (c) 2023 cheng-zhongliang. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package event
+
+import (
+	"errors"
+	"runtime"
+	"sync/atomic"
+)
+
+var ErrAffinityNotSupported = errors.New("cpu affinity not supported")
+
+// SetAffinity locks the goroutine of the loop to its OS thread while the loop runs,
+// and binds the thread to the CPUs. No CPUs only locks the thread.
+// The thread is bound back to its CPUs and unlocked when the loop returns.
+// So every call of Loop binds and unbinds the thread, which costs two sched_setaffinity calls;
+// a loop driven by repeated EvLoopOnce calls is better run by Dispatch, or bound by the caller.
+// The CPUs are only supported on Linux.
+func (bs *EventBase) SetAffinity(cpus ...int) error {
+	if err := checkCPUs(cpus); err != nil {
+		return err
+	}
+	bs.cpus = cpus
+	bs.pin = true
+	bs.pinned = false
+	return nil
+}
+
+// ThreadID returns the id of the OS thread the loop is locked to,
+// or -1 if the loop is not running locked or the id is not supported.
+// It is safe to call from any goroutine.
+func (bs *EventBase) ThreadID() int {
+	return int(atomic.LoadInt32(&bs.tid))
+}
+
+// pinThread locks the goroutine of the loop to its OS thread and binds the thread to the CPUs.
+func (bs *EventBase) pinThread() error {
+	runtime.LockOSThread()
+	if len(bs.cpus) > 0 {
+		prev, err := setAffinity(bs.cpus)
+		if err != nil {
+			runtime.UnlockOSThread()
+			return err
+		}
+		bs.prevCPUs = prev
+	}
+	atomic.StoreInt32(&bs.tid, int32(gettid()))
+	bs.pinned = true
+	return nil
+}
+
+// unpinThread binds the thread back to its CPUs and unlocks it when the loop returns,
+// so the thread is reused by other goroutines as before.
+func (bs *EventBase) unpinThread() {
+	if len(bs.cpus) > 0 {
+		restoreAffinity(bs.prevCPUs)
+	}
+	atomic.StoreInt32(&bs.tid, -1)
+	bs.pinned = false
+	runtime.UnlockOSThread()
+}
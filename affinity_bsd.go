@@ -0,0 +1,31 @@
+// Copyright (c) 2023 cheng-zhongliang. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build darwin || dragonfly || freebsd || netbsd || openbsd
+// +build darwin dragonfly freebsd netbsd openbsd
+
+package event
+
+func checkCPUs(cpus []int) error {
+	if len(cpus) > 0 {
+		return ErrAffinityNotSupported
+	}
+	return nil
+}
+
+// cpuMask is empty as the CPUs are not supported.
+type cpuMask struct{}
+
+func setAffinity(cpus []int) (cpuMask, error) {
+	return cpuMask{}, ErrAffinityNotSupported
+}
+
+func restoreAffinity(mask cpuMask) error {
+	return ErrAffinityNotSupported
+}
+
+// gettid returns -1 as the thread id is not exposed portably.
+func gettid() int {
+	return -1
+}
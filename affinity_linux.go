@@ -0,0 +1,61 @@
+// Copyright (c) 2023 cheng-zhongliang. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build linux
+// +build linux
+
+package event
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+const (
+	// maxCPUs is the number of the CPUs in a cpu_set_t.
+	maxCPUs = 1024
+	// wordBits is the number of the bits of an unsigned long.
+	wordBits = 32 << (^uintptr(0) >> 63)
+)
+
+func checkCPUs(cpus []int) error {
+	for _, cpu := range cpus {
+		if cpu < 0 || cpu >= maxCPUs {
+			return syscall.EINVAL
+		}
+	}
+	return nil
+}
+
+// cpuMask is the cpu_set_t of sched_setaffinity.
+type cpuMask [maxCPUs / wordBits]uintptr
+
+// setAffinity binds the thread to the CPUs and returns the CPUs it was bound to.
+func setAffinity(cpus []int) (cpuMask, error) {
+	var prev, mask cpuMask
+	if err := schedAffinity(syscall.SYS_SCHED_GETAFFINITY, &prev); err != nil {
+		return prev, err
+	}
+	for _, cpu := range cpus {
+		mask[cpu/wordBits] |= 1 << uint(cpu%wordBits)
+	}
+	return prev, schedAffinity(syscall.SYS_SCHED_SETAFFINITY, &mask)
+}
+
+// restoreAffinity binds the thread back to the CPUs returned by setAffinity.
+func restoreAffinity(mask cpuMask) error {
+	return schedAffinity(syscall.SYS_SCHED_SETAFFINITY, &mask)
+}
+
+func schedAffinity(trap uintptr, mask *cpuMask) error {
+	_, _, errno := syscall.RawSyscall(trap, 0, unsafe.Sizeof(*mask), uintptr(unsafe.Pointer(mask)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+func gettid() int {
+	return syscall.Gettid()
+}
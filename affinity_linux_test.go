@@ -0,0 +1,103 @@
+// Copyright (c) 2023 cheng-zhongliang. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build linux
+// +build linux
+
+package event_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"runtime"
+	"syscall"
+	"testing"
+
+	. "github.com/cheng-zhongliang/event"
+)
+
+// allowedCPUs returns the CPUs the thread is bound to.
+func allowedCPUs(tid int) (string, error) {
+	status, err := ioutil.ReadFile(fmt.Sprintf("/proc/self/task/%d/status", tid))
+	if err != nil {
+		return "", err
+	}
+	m := regexp.MustCompile(`Cpus_allowed_list:\t(.*)\n`).FindSubmatch(status)
+	if m == nil {
+		return "", fmt.Errorf("no allowed cpus in:\n%s", status)
+	}
+	return string(m[1]), nil
+}
+
+func TestSetAffinity(t *testing.T) {
+	base, err := NewBase()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tid := base.ThreadID(); tid != -1 {
+		t.Fatalf("thread id %d before the loop", tid)
+	}
+	if err := base.SetAffinity(-1); err != syscall.EINVAL {
+		t.Fatalf("error %v, want %v", err, syscall.EINVAL)
+	}
+
+	done := make(chan error)
+	go func() {
+		// the goroutine stays on the thread to see its CPUs after the loop returns.
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+		before, err := allowedCPUs(syscall.Gettid())
+		if err != nil {
+			done <- err
+			return
+		}
+		if err := base.SetAffinity(0); err != nil {
+			done <- err
+			return
+		}
+		var inLoop error
+		NewTimer(base, func(fd int, events uint32, arg interface{}) {
+			if tid := base.ThreadID(); tid != syscall.Gettid() {
+				inLoop = fmt.Errorf("thread id %d, want %d", tid, syscall.Gettid())
+				return
+			}
+			cpus, err := allowedCPUs(base.ThreadID())
+			if err != nil {
+				inLoop = err
+			} else if cpus != "0" {
+				inLoop = fmt.Errorf("thread bound to cpus %s, want 0", cpus)
+			}
+		}, nil).Attach(0)
+		if err := base.Loop(EvLoopOnce); err != nil {
+			done <- err
+			return
+		}
+		if inLoop != nil {
+			done <- inLoop
+			return
+		}
+		if tid := base.ThreadID(); tid != -1 {
+			done <- fmt.Errorf("thread id %d after the loop", tid)
+			return
+		}
+		after, err := allowedCPUs(syscall.Gettid())
+		if err != nil {
+			done <- err
+			return
+		}
+		if after != before {
+			done <- fmt.Errorf("thread bound to cpus %s after the loop, want %s", after, before)
+			return
+		}
+		done <- nil
+	}()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := base.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright (c) 2023 cheng-zhongliang. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package event
+
+import (
+	"bytes"
+	"io"
+	"syscall"
+)
+
+const (
+	// minBufferRead is the minimum free space of the buffer to read from a fd.
+	minBufferRead = 0x1000
+)
+
+// Buffer is the byte buffer for non-blocking I/O.
+// It works in a similar manner as evbuffer of libevent.
+// The zero value is an empty buffer ready to use.
+type Buffer struct {
+	// buf is the underlying bytes. The unread portion is buf[off:].
+	buf []byte
+	// off is the offset of the unread portion.
+	off int
+}
+
+// Len returns the number of the unread bytes.
+func (b *Buffer) Len() int {
+	return len(b.buf) - b.off
+}
+
+// Bytes returns the unread bytes.
+// The slice is only valid until the next modification of the buffer.
+func (b *Buffer) Bytes() []byte {
+	return b.buf[b.off:]
+}
+
+// Index returns the index of the first sep in the unread bytes, or -1 if not present.
+func (b *Buffer) Index(sep []byte) int {
+	return bytes.Index(b.buf[b.off:], sep)
+}
+
+// Write appends p to the buffer.
+func (b *Buffer) Write(p []byte) (int, error) {
+	b.grow(len(p))
+	b.buf = append(b.buf, p...)
+	return len(p), nil
+}
+
+// WriteString appends s to the buffer.
+func (b *Buffer) WriteString(s string) (int, error) {
+	b.grow(len(s))
+	b.buf = append(b.buf, s...)
+	return len(s), nil
+}
+
+// Drain discards the first n unread bytes.
+func (b *Buffer) Drain(n int) {
+	if n >= b.Len() {
+		b.Reset()
+		return
+	}
+	b.off += n
+}
+
+// Reset discards all the unread bytes but keeps the underlying storage.
+func (b *Buffer) Reset() {
+	b.buf = b.buf[:0]
+	b.off = 0
+}
+
+// ReadFd reads once from the fd and appends the bytes to the buffer.
+// It returns io.EOF when the peer closes the connection.
+// The error is syscall.EAGAIN when nothing can be read without blocking.
+func (b *Buffer) ReadFd(fd int) (int, error) {
+	b.grow(minBufferRead)
+	for {
+		n, err := syscall.Read(fd, b.buf[len(b.buf):cap(b.buf)])
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		if n == 0 {
+			return 0, io.EOF
+		}
+		b.buf = b.buf[:len(b.buf)+n]
+		return n, nil
+	}
+}
+
+// WriteFd writes the unread bytes to the fd until all are written or it would block.
+// The written bytes are drained from the buffer.
+// The error is syscall.EAGAIN when the fd is not writable and some bytes are left.
+func (b *Buffer) WriteFd(fd int) (int, error) {
+	total := 0
+	for b.Len() > 0 {
+		n, err := syscall.Write(fd, b.buf[b.off:])
+		if err == syscall.EINTR {
+			continue
+		}
+		if n > 0 {
+			total += n
+			b.Drain(n)
+		}
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// grow makes sure there are at least n bytes of free space after the unread bytes.
+func (b *Buffer) grow(n int) {
+	if cap(b.buf)-len(b.buf) >= n {
+		return
+	}
+	if b.off > 0 && cap(b.buf)-b.Len() >= n {
+		m := copy(b.buf, b.buf[b.off:])
+		b.buf = b.buf[:m]
+		b.off = 0
+		return
+	}
+	buf := make([]byte, b.Len(), 2*cap(b.buf)+n)
+	copy(buf, b.buf[b.off:])
+	b.buf = buf
+	b.off = 0
+}
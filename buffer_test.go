@@ -0,0 +1,126 @@
+// Copyright (c) 2023 cheng-zhongliang. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package event_test
+
+import (
+	"bytes"
+	"io"
+	"syscall"
+	"testing"
+
+	. "github.com/cheng-zhongliang/event"
+)
+
+func TestBufferWriteDrain(t *testing.T) {
+	var b Buffer
+	var want []byte
+	for i := 0; i < 1000; i++ {
+		p := bytes.Repeat([]byte{byte(i)}, i%37)
+		b.Write(p)
+		want = append(want, p...)
+		n := i % 23
+		if n > len(want) {
+			n = len(want)
+		}
+		b.Drain(n)
+		want = want[n:]
+		if !bytes.Equal(b.Bytes(), want) {
+			t.Fatalf("iteration %d: buffer differs", i)
+		}
+	}
+	b.Drain(b.Len() + 1)
+	if b.Len() != 0 {
+		t.Fatalf("len %d after draining all", b.Len())
+	}
+}
+
+func TestBufferCompact(t *testing.T) {
+	var b Buffer
+	b.WriteString("0123456789")
+	size := cap(b.Bytes())
+	b.Drain(6)
+	if b.Index([]byte("6")) != 0 {
+		t.Fatalf("index %d, want 0", b.Index([]byte("6")))
+	}
+	// the drained space is reused by moving the unread bytes to the front.
+	b.WriteString("abcde")
+	if string(b.Bytes()) != "6789abcde" {
+		t.Fatalf("buffer %q", b.Bytes())
+	}
+	if cap(b.Bytes()) != size {
+		t.Fatalf("capacity %d, want %d without growing", cap(b.Bytes()), size)
+	}
+	b.WriteString("fghijklmnop")
+	if string(b.Bytes()) != "6789abcdefghijklmnop" {
+		t.Fatalf("buffer %q", b.Bytes())
+	}
+}
+
+func TestBufferReadFd(t *testing.T) {
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer syscall.Close(fds[0])
+	if err := syscall.SetNonblock(fds[0], true); err != nil {
+		t.Fatal(err)
+	}
+
+	var b Buffer
+	if _, err := b.ReadFd(fds[0]); err != syscall.EAGAIN {
+		t.Fatalf("error %v, want %v", err, syscall.EAGAIN)
+	}
+	syscall.Write(fds[1], []byte("hello"))
+	if n, err := b.ReadFd(fds[0]); n != 5 || err != nil {
+		t.Fatalf("read %d %v, want 5 nil", n, err)
+	}
+	syscall.Close(fds[1])
+	if n, err := b.ReadFd(fds[0]); n != 0 || err != io.EOF {
+		t.Fatalf("read %d %v, want 0 EOF", n, err)
+	}
+	if string(b.Bytes()) != "hello" {
+		t.Fatalf("buffer %q", b.Bytes())
+	}
+}
+
+func TestBufferWriteFd(t *testing.T) {
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer syscall.Close(fds[0])
+	defer syscall.Close(fds[1])
+	if err := syscall.SetNonblock(fds[0], true); err != nil {
+		t.Fatal(err)
+	}
+
+	data := bytes.Repeat([]byte("0123456789abcdef"), 1<<16)
+	var b Buffer
+	b.Write(data)
+	n, err := b.WriteFd(fds[0])
+	if err != syscall.EAGAIN {
+		t.Fatalf("error %v, want %v", err, syscall.EAGAIN)
+	}
+	if n <= 0 || n+b.Len() != len(data) {
+		t.Fatalf("written %d left %d, want %d in total", n, b.Len(), len(data))
+	}
+
+	// the rest is written as the peer reads.
+	got := make([]byte, 0, len(data))
+	buf := make([]byte, 1<<16)
+	for len(got) < len(data) {
+		m, err := syscall.Read(fds[1], buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, buf[:m]...)
+		if _, err := b.WriteFd(fds[0]); err != nil && err != syscall.EAGAIN {
+			t.Fatal(err)
+		}
+	}
+	if b.Len() != 0 || !bytes.Equal(got, data) {
+		t.Fatalf("left %d, data differs %v", b.Len(), !bytes.Equal(got, data))
+	}
+}
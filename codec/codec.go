@@ -0,0 +1,135 @@
+// Copyright (c) 2023 cheng-zhongliang. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package codec implements framed connections on the event loop.
+package codec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+
+	"github.com/cheng-zhongliang/event"
+)
+
+const (
+	// DefaultMaxFrameSize is the default maximum size of a frame.
+	DefaultMaxFrameSize = 1 << 20
+	// lengthHeaderSize is the size of the big-endian length prefix.
+	lengthHeaderSize = 4
+)
+
+var (
+	ErrFrameTooLarge = errors.New("frame too large")
+	ErrClosed        = errors.New("connection closed")
+)
+
+// Codec splits the byte stream into frames and encodes the frames to send.
+type Codec interface {
+	// Decode returns the first complete frame in p and the number of bytes it occupies.
+	// The number is 0 if the frame is not complete yet.
+	Decode(p []byte) (frame []byte, n int, err error)
+	// Encode appends the encoded frame to the buffer.
+	Encode(b *event.Buffer, frame []byte)
+}
+
+// delimiterCodec is the codec of the frames terminated by a delimiter.
+type delimiterCodec struct {
+	// delim is the delimiter of the frames.
+	delim []byte
+	// maxSize is the maximum size of a frame without the delimiter.
+	maxSize int
+	// line reports whether a trailing carriage return is stripped.
+	line bool
+}
+
+// NewLineCodec creates a codec of the frames terminated by "\n".
+// A trailing "\r" is stripped from the decoded frames.
+// The maxSize is the maximum size of a frame. Zero means DefaultMaxFrameSize.
+func NewLineCodec(maxSize int) Codec {
+	return &delimiterCodec{delim: []byte{'\n'}, maxSize: frameSize(maxSize), line: true}
+}
+
+// NewDelimiterCodec creates a codec of the frames terminated by the delimiter.
+// The maxSize is the maximum size of a frame. Zero means DefaultMaxFrameSize.
+func NewDelimiterCodec(delim []byte, maxSize int) Codec {
+	return &delimiterCodec{delim: append([]byte(nil), delim...), maxSize: frameSize(maxSize)}
+}
+
+func (dc *delimiterCodec) Decode(p []byte) ([]byte, int, error) {
+	i := bytes.Index(p, dc.delim)
+	if i < 0 {
+		if len(p) > dc.maxSize && !dc.partialDelim(p) {
+			return nil, 0, ErrFrameTooLarge
+		}
+		return nil, 0, nil
+	}
+	frame := p[:i]
+	if dc.line && i > 0 && p[i-1] == '\r' {
+		frame = p[:i-1]
+	}
+	if len(frame) > dc.maxSize {
+		return nil, 0, ErrFrameTooLarge
+	}
+	return frame, i + len(dc.delim), nil
+}
+
+// partialDelim reports whether p may be a frame of the maximum size followed by a partial delimiter.
+func (dc *delimiterCodec) partialDelim(p []byte) bool {
+	if dc.line {
+		return len(p) == dc.maxSize+1 && p[dc.maxSize] == '\r'
+	}
+	for k := len(p) - dc.maxSize; k < len(dc.delim); k++ {
+		if bytes.HasSuffix(p, dc.delim[:k]) {
+			return true
+		}
+	}
+	return false
+}
+
+func (dc *delimiterCodec) Encode(b *event.Buffer, frame []byte) {
+	b.Write(frame)
+	b.Write(dc.delim)
+}
+
+// lengthCodec is the codec of the frames prefixed by a 4-byte big-endian length.
+type lengthCodec struct {
+	// maxSize is the maximum size of a frame without the prefix.
+	maxSize int
+}
+
+// NewLengthCodec creates a codec of the frames prefixed by a 4-byte big-endian length.
+// The maxSize is the maximum size of a frame. Zero means DefaultMaxFrameSize.
+func NewLengthCodec(maxSize int) Codec {
+	return &lengthCodec{maxSize: frameSize(maxSize)}
+}
+
+func (lc *lengthCodec) Decode(p []byte) ([]byte, int, error) {
+	if len(p) < lengthHeaderSize {
+		return nil, 0, nil
+	}
+	size := binary.BigEndian.Uint32(p)
+	if uint64(size) > uint64(lc.maxSize) {
+		return nil, 0, ErrFrameTooLarge
+	}
+	n := lengthHeaderSize + int(size)
+	if len(p) < n {
+		return nil, 0, nil
+	}
+	return p[lengthHeaderSize:n], n, nil
+}
+
+func (lc *lengthCodec) Encode(b *event.Buffer, frame []byte) {
+	var hdr [lengthHeaderSize]byte
+	binary.BigEndian.PutUint32(hdr[:], uint32(len(frame)))
+	b.Write(hdr[:])
+	b.Write(frame)
+}
+
+func frameSize(maxSize int) int {
+	if maxSize <= 0 {
+		return DefaultMaxFrameSize
+	}
+	return maxSize
+}
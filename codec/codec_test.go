@@ -0,0 +1,209 @@
+// Copyright (c) 2023 cheng-zhongliang. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package codec_test
+
+import (
+	"bytes"
+	"compress/flate"
+	"syscall"
+	"testing"
+
+	"github.com/cheng-zhongliang/event"
+	. "github.com/cheng-zhongliang/event/codec"
+)
+
+func TestDecode(t *testing.T) {
+	for _, c := range []struct {
+		codec  Codec
+		in     string
+		frames []string
+		err    error
+	}{
+		{NewLineCodec(0), "a\r\nbc\nd", []string{"a", "bc"}, nil},
+		{NewLineCodec(2), "abc", nil, ErrFrameTooLarge},
+		{NewLineCodec(2), "ab\r\n", []string{"ab"}, nil},
+		{NewDelimiterCodec([]byte("||"), 0), "a||b|c||", []string{"a", "b|c"}, nil},
+		{NewDelimiterCodec([]byte("\r\n\r\n"), 2), "a\r\n\r", nil, nil},
+		{NewDelimiterCodec([]byte("\r\n\r\n"), 2), "abc\r", nil, ErrFrameTooLarge},
+		{NewLengthCodec(0), "\x00\x00\x00\x01a\x00\x00\x00\x00\x00\x00\x00\x02b", []string{"a", ""}, nil},
+		{NewLengthCodec(4), "\x00\x00\x00\x05", nil, ErrFrameTooLarge},
+	} {
+		p := []byte(c.in)
+		var frames []string
+		var err error
+		for {
+			var frame []byte
+			var n int
+			frame, n, err = c.codec.Decode(p)
+			if err != nil || n == 0 {
+				break
+			}
+			frames = append(frames, string(frame))
+			p = p[n:]
+		}
+		if err != c.err || len(frames) != len(c.frames) {
+			t.Fatalf("decode %q: frames %q error %v, want %q %v", c.in, frames, err, c.frames, c.err)
+		}
+		for i := range frames {
+			if frames[i] != c.frames[i] {
+				t.Fatalf("decode %q: frames %q, want %q", c.in, frames, c.frames)
+			}
+		}
+	}
+}
+
+func TestEncode(t *testing.T) {
+	for _, codec := range []Codec{NewLineCodec(0), NewDelimiterCodec([]byte("\x00"), 0), NewLengthCodec(0)} {
+		b := new(event.Buffer)
+		codec.Encode(b, []byte("hello"))
+		frame, n, err := codec.Decode(b.Bytes())
+		if err != nil || n != b.Len() || !bytes.Equal(frame, []byte("hello")) {
+			t.Fatalf("round trip %q %d %v", frame, n, err)
+		}
+	}
+}
+
+func TestConn(t *testing.T) {
+	base, err := event.NewBase()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer syscall.Close(fds[1])
+	if err := syscall.SetNonblock(fds[0], true); err != nil {
+		t.Fatal(err)
+	}
+
+	var frames []string
+	var closeErr error
+	closed := false
+	c, err := NewConn(base, fds[0], NewLengthCodec(8), func(c *Conn, frame []byte, arg interface{}) {
+		frames = append(frames, string(frame))
+		c.Write(frame)
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetCloseCallback(func(c *Conn, err error, arg interface{}) {
+		closed = true
+		closeErr = err
+	})
+
+	syscall.Write(fds[1], []byte("\x00\x00\x00\x02hi\x00\x00\x00\x03yo"))
+	if err := base.Loop(event.EvLoopOnce | event.EvLoopNoblock); err != nil {
+		t.Fatal(err)
+	}
+	if len(frames) != 1 || frames[0] != "hi" {
+		t.Fatalf("frames %q not equal", frames)
+	}
+	buf := make([]byte, 64)
+	n, _ := syscall.Read(fds[1], buf)
+	if string(buf[:n]) != "\x00\x00\x00\x02hi" {
+		t.Fatalf("echo %q not equal", buf[:n])
+	}
+
+	syscall.Write(fds[1], []byte("!\x00\x00\x01\x00"))
+	if err := base.Loop(event.EvLoopOnce | event.EvLoopNoblock); err != nil {
+		t.Fatal(err)
+	}
+	if len(frames) != 2 || frames[1] != "yo!" {
+		t.Fatalf("frames %q not equal", frames)
+	}
+	if !closed || closeErr != ErrFrameTooLarge {
+		t.Fatalf("closed %v error %v, want true %v", closed, closeErr, ErrFrameTooLarge)
+	}
+	if c.Write([]byte("x")) != ErrClosed {
+		t.Fatal("write after close")
+	}
+
+	if err := base.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConnFilter(t *testing.T) {
+	base, err := event.NewBase()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, fd := range fds {
+		if err := syscall.SetNonblock(fd, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var echoes []string
+	a, err := NewConn(base, fds[0], NewLineCodec(0), func(c *Conn, frame []byte, arg interface{}) {
+		echoes = append(echoes, string(frame))
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewConn(base, fds[1], NewLineCodec(0), func(c *Conn, frame []byte, arg interface{}) {
+		c.Write(frame)
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed := false
+	var closeErr error
+	b.SetCloseCallback(func(c *Conn, err error, arg interface{}) {
+		closed = true
+		closeErr = err
+	})
+	for _, c := range []*Conn{a, b} {
+		f, err := event.NewDeflateFilter(flate.BestSpeed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.SetFilter(f)
+	}
+
+	frames := []string{"hello", string(bytes.Repeat([]byte("event"), 4096)), "world"}
+	for _, frame := range frames {
+		if err := a.Write([]byte(frame)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 100 && len(echoes) < len(frames); i++ {
+		if err := base.Loop(event.EvLoopOnce | event.EvLoopNoblock); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(echoes) != len(frames) {
+		t.Fatalf("%d echoes, want %d", len(echoes), len(frames))
+	}
+	for i := range frames {
+		if echoes[i] != frames[i] {
+			t.Fatalf("echo %d not equal", i)
+		}
+	}
+
+	// the peer decompresses the final block before the end of the stream.
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100 && !closed; i++ {
+		if err := base.Loop(event.EvLoopOnce | event.EvLoopNoblock); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !closed || closeErr != nil {
+		t.Fatalf("closed %v error %v, want true nil", closed, closeErr)
+	}
+
+	if err := base.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+}
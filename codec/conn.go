@@ -0,0 +1,213 @@
+// Copyright (c) 2023 cheng-zhongliang. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package codec
+
+import (
+	"io"
+	"syscall"
+
+	"github.com/cheng-zhongliang/event"
+)
+
+// Conn is a connection exchanging the frames of a codec.
+type Conn struct {
+	// fd is the socket of the connection.
+	fd int
+	// codec is the codec of the frames.
+	codec Codec
+	// rev is the read event of the socket.
+	rev *event.Event
+	// wev is the write event of the socket.
+	wev *event.Event
+	// in is the bytes read from the socket.
+	in event.Buffer
+	// out is the bytes to write to the socket.
+	out event.Buffer
+	// filter is the filter between the socket and the frames.
+	filter event.Filter
+	// raw is the bytes read from the socket before the input filter.
+	raw event.Buffer
+	// plain is the encoded frames before the output filter.
+	plain event.Buffer
+	// closed reports whether the connection is closed.
+	closed bool
+	// closing reports whether the socket is closed after the output is written.
+	closing bool
+	// processing reports whether the frames are being dispatched.
+	processing bool
+	// cb is the callback function when a frame is received.
+	cb func(c *Conn, frame []byte, arg interface{})
+	// closeCb is the callback function when the connection is closed.
+	closeCb func(c *Conn, err error, arg interface{})
+	// arg is the argument passed to the callback functions.
+	arg interface{}
+}
+
+// NewConn creates a framed connection of the non-blocking socket.
+// The callback is called with each complete frame. The frame is only valid until the callback returns.
+// A frame exceeding the maximum size of the codec closes the connection with ErrFrameTooLarge.
+func NewConn(base *event.EventBase, fd int, codec Codec, callback func(c *Conn, frame []byte, arg interface{}), arg interface{}) (*Conn, error) {
+	c := new(Conn)
+	c.fd = fd
+	c.codec = codec
+	c.cb = callback
+	c.arg = arg
+	c.rev = event.New(base, fd, event.EvRead|event.EvPersist, c.onRead, nil)
+	c.wev = event.New(base, fd, event.EvWrite|event.EvPersist, c.onWrite, nil)
+	if err := c.rev.Attach(0); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// SetCloseCallback sets the callback function when the connection is closed.
+// The error is nil if the connection is closed by Close or by the peer.
+func (c *Conn) SetCloseCallback(callback func(c *Conn, err error, arg interface{})) {
+	c.closeCb = callback
+}
+
+// SetFilter sets the filter between the socket and the frames, such as a chain of filters.
+// It must be set before the connection receives or sends any bytes.
+// Each Write flushes the output of the filter.
+func (c *Conn) SetFilter(filter event.Filter) {
+	c.filter = filter
+}
+
+// Fd returns the file descriptor of the connection.
+func (c *Conn) Fd() int {
+	return c.fd
+}
+
+// Write encodes and sends the frame.
+func (c *Conn) Write(frame []byte) error {
+	if c.closed || c.closing {
+		return ErrClosed
+	}
+	if c.filter == nil {
+		c.codec.Encode(&c.out, frame)
+	} else {
+		c.codec.Encode(&c.plain, frame)
+		if err := c.filter.Output(&c.out, &c.plain, event.FilterFlush); err != nil {
+			c.finish(err)
+			return err
+		}
+	}
+	c.flush()
+	return nil
+}
+
+// Close closes the connection after the pending frames are sent.
+func (c *Conn) Close() error {
+	if c.closed || c.closing {
+		return ErrClosed
+	}
+	c.closing = true
+	c.rev.Detach()
+	if c.filter != nil {
+		if err := c.filter.Output(&c.out, &c.plain, event.FilterFinished); err != nil {
+			c.finish(err)
+			return err
+		}
+	}
+	c.flush()
+	return nil
+}
+
+func (c *Conn) onRead(fd int, events uint32, arg interface{}) {
+	if c.filter == nil {
+		_, err := c.in.ReadFd(fd)
+		if err == syscall.EAGAIN {
+			return
+		}
+		if err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			c.finish(err)
+			return
+		}
+		c.process()
+		return
+	}
+
+	_, err := c.raw.ReadFd(fd)
+	if err == syscall.EAGAIN {
+		return
+	}
+	if err != nil && err != io.EOF {
+		c.finish(err)
+		return
+	}
+	mode := event.FilterNormal
+	if err == io.EOF {
+		mode = event.FilterFinished
+	}
+	if ferr := c.filter.Input(&c.in, &c.raw, mode); ferr != nil {
+		c.finish(ferr)
+		return
+	}
+	c.process()
+	if err == io.EOF {
+		c.finish(nil)
+	}
+}
+
+func (c *Conn) onWrite(fd int, events uint32, arg interface{}) {
+	c.flush()
+}
+
+// process dispatches the complete frames in the input buffer.
+func (c *Conn) process() {
+	if c.processing {
+		return
+	}
+	c.processing = true
+	defer func() { c.processing = false }()
+	for !c.closed && !c.closing {
+		frame, n, err := c.codec.Decode(c.in.Bytes())
+		if err != nil {
+			c.finish(err)
+			return
+		}
+		if n == 0 {
+			return
+		}
+		c.cb(c, frame, c.arg)
+		c.in.Drain(n)
+	}
+}
+
+func (c *Conn) flush() {
+	if c.closed {
+		return
+	}
+	_, err := c.out.WriteFd(c.fd)
+	if err == syscall.EAGAIN {
+		c.wev.Attach(0)
+		return
+	}
+	c.wev.Detach()
+	if err != nil {
+		c.finish(err)
+		return
+	}
+	if c.closing {
+		c.finish(nil)
+	}
+}
+
+// finish closes the socket and calls the close callback.
+func (c *Conn) finish(err error) {
+	if c.closed {
+		return
+	}
+	c.closed = true
+	c.rev.Detach()
+	c.wev.Detach()
+	syscall.Close(c.fd)
+	if c.closeCb != nil {
+		c.closeCb(c, err, c.arg)
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright (c) 2023 cheng-zhongliang. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package event
+
+import (
+	"syscall"
+	"time"
+)
+
+// connector is the state of a pending outbound connection.
+type connector struct {
+	// ev is the event to wait for the connection.
+	ev *Event
+	// err is the error when the connection fails immediately.
+	err error
+	// cb is the callback function when the connection completes.
+	cb func(fd int, err error, arg interface{})
+	// arg is the argument passed to the callback function.
+	arg interface{}
+}
+
+// Connect connects to the address on the network without blocking.
+// Network can be "tcp", "tcp4", "tcp6" or "unix".
+// Timeout is the timeout of the connection. Default is 0, which means no timeout.
+// The callback function is called with the connected non-blocking fd and a nil error on success.
+// Otherwise it is called with -1 and the error, such as syscall.ECONNREFUSED or ErrConnectTimeout.
+// The returned error only reports the failures before connecting, such as an invalid address.
+func Connect(base *EventBase, network, address string, timeout time.Duration, callback func(fd int, err error, arg interface{}), arg interface{}) error {
+	family, sa, err := resolveSockaddr(network, address)
+	if err != nil {
+		return err
+	}
+	fd, err := socket(family, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		return err
+	}
+	c := new(connector)
+	c.cb = callback
+	c.arg = arg
+	for {
+		err = syscall.Connect(fd, sa)
+		if err != syscall.EINTR {
+			break
+		}
+	}
+	switch err {
+	case nil, syscall.EINPROGRESS, syscall.EALREADY:
+		events := uint32(EvWrite)
+		if timeout > 0 {
+			events |= EvTimeout
+		}
+		c.ev = New(base, fd, events, c.onConnect, nil)
+	default:
+		syscall.Close(fd)
+		c.err = err
+		c.ev = NewTimer(base, c.onConnect, nil)
+	}
+	if err := c.ev.Attach(timeout); err != nil {
+		if c.ev.fd >= 0 {
+			syscall.Close(fd)
+		}
+		return err
+	}
+	return nil
+}
+
+func (c *connector) onConnect(fd int, events uint32, arg interface{}) {
+	err := c.err
+	if err == nil && events&EvWrite == 0 {
+		err = ErrConnectTimeout
+	}
+	if err == nil {
+		var errno int
+		errno, err = syscall.GetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_ERROR)
+		if err == nil && errno != 0 {
+			err = syscall.Errno(errno)
+		}
+	}
+	if err != nil {
+		if fd >= 0 {
+			syscall.Close(fd)
+		}
+		c.cb(-1, err, c.arg)
+		return
+	}
+	c.cb(fd, nil, c.arg)
+}
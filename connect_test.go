@@ -0,0 +1,216 @@
+// Copyright (c) 2023 cheng-zhongliang. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package event_test
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	. "github.com/cheng-zhongliang/event"
+)
+
+func TestConnect(t *testing.T) {
+	base, err := NewBase()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	n := 0
+	err = Connect(base, "tcp", ln.Addr().String(), time.Second, func(fd int, err error, arg interface{}) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if arg != "hello" {
+			t.Fatal("arg not equal")
+		}
+		syscall.Close(fd)
+		n++
+	}, "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := base.Loop(EvLoopOnce); err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 1 {
+		t.FailNow()
+	}
+
+	if err := base.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConnectRefused(t *testing.T) {
+	base, err := NewBase()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	n := 0
+	err = Connect(base, "tcp4", addr, 0, func(fd int, err error, arg interface{}) {
+		if fd != -1 {
+			t.Fatal("fd not equal")
+		}
+		if err != syscall.ECONNREFUSED {
+			t.Fatal(err)
+		}
+		n++
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := base.Loop(EvLoopOnce); err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 1 {
+		t.FailNow()
+	}
+
+	if err := base.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConnectTimeout(t *testing.T) {
+	base, err := NewBase()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer syscall.Close(fd)
+	if err := syscall.Bind(fd, &syscall.SockaddrInet4{Addr: [4]byte{127, 0, 0, 1}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Listen(fd, 0); err != nil {
+		t.Fatal(err)
+	}
+	sa, err := syscall.Getsockname(fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := (&net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: sa.(*syscall.SockaddrInet4).Port}).String()
+
+	// the connections are never accepted, so the handshake stalls once the backlog is full.
+	full := false
+	for i := 0; i < 16; i++ {
+		conn, err := net.DialTimeout("tcp", addr, 50*time.Millisecond)
+		if err != nil {
+			full = true
+			break
+		}
+		defer conn.Close()
+	}
+	if !full {
+		t.Skip("backlog not full")
+	}
+
+	n := 0
+	err = Connect(base, "tcp", addr, 50*time.Millisecond, func(fd int, err error, arg interface{}) {
+		if fd != -1 {
+			t.Fatal("fd not equal")
+		}
+		if err != ErrConnectTimeout {
+			t.Fatal(err)
+		}
+		n++
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for deadline := time.Now().Add(time.Second); n == 0 && time.Now().Before(deadline); {
+		if err := base.Loop(EvLoopOnce); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n != 1 {
+		t.FailNow()
+	}
+
+	if err := base.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConnectUnix(t *testing.T) {
+	base, err := NewBase()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "event")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := dir + "/event.sock"
+
+	n := 0
+	err = Connect(base, "unix", path, 0, func(fd int, err error, arg interface{}) {
+		if err != syscall.ENOENT {
+			t.Fatal(err)
+		}
+		n++
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	err = Connect(base, "unix", path, 0, func(fd int, err error, arg interface{}) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		syscall.Close(fd)
+		n++
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := base.Loop(EvLoopOnce); err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 2 {
+		t.FailNow()
+	}
+
+	if err := base.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+}
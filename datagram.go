@@ -0,0 +1,206 @@
+// Copyright (c) 2023 cheng-zhongliang. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package event
+
+import (
+	"net"
+	"syscall"
+)
+
+const (
+	// defaultDatagramBatch is the default number of datagrams received or sent at once.
+	defaultDatagramBatch = 32
+	// defaultDatagramSize is the default size of the buffer of every datagram.
+	defaultDatagramSize = 0x2000
+)
+
+// datagram is a datagram with its peer address.
+type datagram struct {
+	// data is the payload of the datagram.
+	data []byte
+	// sa is the peer address of the datagram.
+	sa syscall.Sockaddr
+}
+
+// Datagram is the datagram endpoint to receive and send datagrams in batches.
+// It uses recvmmsg and sendmmsg on Linux.
+type Datagram struct {
+	// rev is the read event of the socket.
+	rev *Event
+	// wev is the write event of the socket. It is attached while datagrams are queued.
+	wev *Event
+	// fd is the datagram socket.
+	fd int
+	// path is the path of the unix socket to remove when closed.
+	path string
+	// size is the size of the buffer of every datagram.
+	size int
+	// bufs is the reusable buffers to receive datagrams.
+	bufs [][]byte
+	// in is the received datagrams.
+	in []datagram
+	// out is the queued datagrams to send.
+	out []datagram
+	// free is the reusable buffers of the sent datagrams.
+	free [][]byte
+	// mmsg is the state of the batch system calls.
+	mmsg mmsgState
+	// err is the error of the last failed send. It is returned by the next WriteTo.
+	err error
+	// cb is the callback function when a datagram is received.
+	cb func(data []byte, sa syscall.Sockaddr, arg interface{})
+	// arg is the argument passed to the callback function.
+	arg interface{}
+}
+
+// NewDatagram creates a new datagram endpoint bound to the network address.
+// Network can be "udp", "udp4", "udp6" or "unixgram".
+// On every readable event up to the batch size of datagrams are received,
+// and the callback function is called with the payload and the sender address of each one.
+// The payload is only valid until the callback returns.
+func NewDatagram(base *EventBase, network, address string, callback func(data []byte, sa syscall.Sockaddr, arg interface{}), arg interface{}) (*Datagram, error) {
+	switch network {
+	case "udp", "udp4", "udp6", "unixgram":
+	default:
+		return nil, net.UnknownNetworkError(network)
+	}
+	family, sa, err := resolveSockaddr(network, address)
+	if err != nil {
+		return nil, err
+	}
+	fd, err := socket(family, syscall.SOCK_DGRAM, 0)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Bind(fd, sa); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+	d := new(Datagram)
+	d.fd = fd
+	if family == syscall.AF_UNIX {
+		d.path = address
+	}
+	d.cb = callback
+	d.arg = arg
+	d.SetBatch(defaultDatagramBatch, defaultDatagramSize)
+	d.rev = New(base, fd, EvRead|EvPersist, d.onRead, nil)
+	d.wev = New(base, fd, EvWrite|EvPersist, d.onWrite, nil)
+	if err := d.rev.Attach(0); err != nil {
+		syscall.Close(fd)
+		if d.path != "" {
+			syscall.Unlink(d.path)
+		}
+		return nil, err
+	}
+	return d, nil
+}
+
+// SetBatch sets the number of datagrams received or sent at once and the buffer size of every datagram.
+// The datagrams larger than the buffer size are truncated.
+// It returns syscall.EINVAL if the batch or the size is not positive.
+func (d *Datagram) SetBatch(batch, size int) error {
+	if batch <= 0 || size <= 0 {
+		return syscall.EINVAL
+	}
+	d.size = size
+	d.bufs = make([][]byte, batch)
+	for i := range d.bufs {
+		d.bufs[i] = make([]byte, size)
+	}
+	d.in = make([]datagram, batch)
+	d.free = nil
+	d.mmsg.init(d.bufs)
+	return nil
+}
+
+// WriteTo queues the datagram to the peer address.
+// The queued datagrams are sent in batches when the socket is writable.
+// The data is copied, so it can be reused after WriteTo returns.
+// A datagram failed to send is dropped, and the error is returned by the next WriteTo
+// without queuing its datagram.
+func (d *Datagram) WriteTo(data []byte, sa syscall.Sockaddr) error {
+	if err := d.err; err != nil {
+		d.err = nil
+		return err
+	}
+	var buf []byte
+	if n := len(d.free); n > 0 && cap(d.free[n-1]) >= len(data) {
+		buf = d.free[n-1][:len(data)]
+		d.free = d.free[:n-1]
+	} else if len(data) > d.size {
+		buf = make([]byte, len(data))
+	} else {
+		buf = make([]byte, len(data), d.size)
+	}
+	copy(buf, data)
+	d.out = append(d.out, datagram{data: buf, sa: sa})
+	if d.wev.flags&evListInserted != 0 {
+		return nil
+	}
+	return d.wev.Attach(0)
+}
+
+// Fd returns the file descriptor of the datagram socket.
+func (d *Datagram) Fd() int {
+	return d.fd
+}
+
+// Addr returns the local address of the datagram socket.
+func (d *Datagram) Addr() (syscall.Sockaddr, error) {
+	return syscall.Getsockname(d.fd)
+}
+
+// Close drops the queued datagrams and closes the datagram socket.
+func (d *Datagram) Close() error {
+	if d.rev.flags&evListInserted != 0 {
+		d.rev.Detach()
+	}
+	if d.wev.flags&evListInserted != 0 {
+		d.wev.Detach()
+	}
+	d.out = nil
+	err := syscall.Close(d.fd)
+	if d.path != "" {
+		syscall.Unlink(d.path)
+	}
+	return err
+}
+
+func (d *Datagram) onRead(fd int, events uint32, arg interface{}) {
+	n, err := d.mmsg.recv(fd, d.bufs, d.in)
+	if err != nil {
+		return
+	}
+	for i := 0; i < n && d.rev.flags&evListInserted != 0; i++ {
+		d.cb(d.in[i].data, d.in[i].sa, d.arg)
+	}
+}
+
+func (d *Datagram) onWrite(fd int, events uint32, arg interface{}) {
+	for len(d.out) > 0 {
+		batch := d.out
+		if len(batch) > len(d.bufs) {
+			batch = batch[:len(d.bufs)]
+		}
+		n, err := d.mmsg.send(fd, batch)
+		if err == syscall.EAGAIN || err == syscall.EINTR {
+			return
+		}
+		if err != nil {
+			d.err = err
+			n = 1
+		}
+		for i := 0; i < n; i++ {
+			if len(d.free) < len(d.bufs) {
+				d.free = append(d.free, d.out[i].data)
+			}
+			d.out[i] = datagram{}
+		}
+		d.out = d.out[n:]
+	}
+	d.out = nil
+	d.wev.Detach()
+}
@@ -0,0 +1,55 @@
+// Copyright (c) 2023 cheng-zhongliang. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build darwin || dragonfly || freebsd || netbsd || openbsd
+// +build darwin dragonfly freebsd netbsd openbsd
+
+package event
+
+import (
+	"syscall"
+)
+
+// mmsgState is empty as the datagrams are received and sent one by one.
+type mmsgState struct{}
+
+func (m *mmsgState) init(bufs [][]byte) {}
+
+func (m *mmsgState) recv(fd int, bufs [][]byte, in []datagram) (int, error) {
+	n := 0
+	for n < len(bufs) {
+		r, sa, err := syscall.Recvfrom(fd, bufs[n], 0)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			if n > 0 {
+				break
+			}
+			return 0, err
+		}
+		in[n].data = bufs[n][:r]
+		in[n].sa = sa
+		n++
+	}
+	return n, nil
+}
+
+func (m *mmsgState) send(fd int, out []datagram) (int, error) {
+	n := 0
+	for n < len(out) {
+		err := syscall.Sendto(fd, out[n].data, 0, out[n].sa)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			if n > 0 {
+				break
+			}
+			return 0, err
+		}
+		n++
+	}
+	return n, nil
+}
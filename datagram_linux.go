@@ -0,0 +1,155 @@
+// Copyright (c) 2023 cheng-zhongliang. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build linux
+// +build linux
+
+package event
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// mmsghdr is the message header of recvmmsg and sendmmsg.
+type mmsghdr struct {
+	hdr syscall.Msghdr
+	len uint32
+}
+
+// mmsgState is the reusable message headers of recvmmsg and sendmmsg.
+type mmsgState struct {
+	rhdrs  []mmsghdr
+	riovs  []syscall.Iovec
+	rnames []syscall.RawSockaddrAny
+	whdrs  []mmsghdr
+	wiovs  []syscall.Iovec
+	wnames []syscall.RawSockaddrAny
+}
+
+func (m *mmsgState) init(bufs [][]byte) {
+	n := len(bufs)
+	m.rhdrs = make([]mmsghdr, n)
+	m.riovs = make([]syscall.Iovec, n)
+	m.rnames = make([]syscall.RawSockaddrAny, n)
+	m.whdrs = make([]mmsghdr, n)
+	m.wiovs = make([]syscall.Iovec, n)
+	m.wnames = make([]syscall.RawSockaddrAny, n)
+	for i := range bufs {
+		m.riovs[i].Base = &bufs[i][0]
+		m.riovs[i].SetLen(len(bufs[i]))
+		m.rhdrs[i].hdr.Name = (*byte)(unsafe.Pointer(&m.rnames[i]))
+		m.rhdrs[i].hdr.Iov = &m.riovs[i]
+		m.rhdrs[i].hdr.Iovlen = 1
+		m.whdrs[i].hdr.Iov = &m.wiovs[i]
+		m.whdrs[i].hdr.Iovlen = 1
+	}
+}
+
+func (m *mmsgState) recv(fd int, bufs [][]byte, in []datagram) (int, error) {
+	for i := range m.rhdrs {
+		m.rhdrs[i].hdr.Namelen = syscall.SizeofSockaddrAny
+	}
+	var r uintptr
+	var errno syscall.Errno
+	for {
+		r, _, errno = syscall.Syscall6(syscall.SYS_RECVMMSG, uintptr(fd), uintptr(unsafe.Pointer(&m.rhdrs[0])), uintptr(len(m.rhdrs)), 0, 0, 0)
+		if errno != syscall.EINTR {
+			break
+		}
+	}
+	if errno != 0 {
+		return 0, errno
+	}
+	n := int(r)
+	for i := 0; i < n; i++ {
+		in[i].data = bufs[i][:m.rhdrs[i].len]
+		in[i].sa = anyToSockaddr(&m.rnames[i])
+	}
+	return n, nil
+}
+
+func (m *mmsgState) send(fd int, out []datagram) (int, error) {
+	for i := range out {
+		if len(out[i].data) > 0 {
+			m.wiovs[i].Base = &out[i].data[0]
+		} else {
+			m.wiovs[i].Base = nil
+		}
+		m.wiovs[i].SetLen(len(out[i].data))
+		m.whdrs[i].hdr.Name = nil
+		m.whdrs[i].hdr.Namelen = 0
+		if n := sockaddrToAny(out[i].sa, &m.wnames[i]); n > 0 {
+			m.whdrs[i].hdr.Name = (*byte)(unsafe.Pointer(&m.wnames[i]))
+			m.whdrs[i].hdr.Namelen = n
+		}
+	}
+	r, _, errno := syscall.Syscall6(sysSendmmsg, uintptr(fd), uintptr(unsafe.Pointer(&m.whdrs[0])), uintptr(len(out)), 0, 0, 0)
+	for i := range out {
+		m.wiovs[i].Base = nil
+	}
+	if errno != 0 {
+		return 0, errno
+	}
+	return int(r), nil
+}
+
+func anyToSockaddr(rsa *syscall.RawSockaddrAny) syscall.Sockaddr {
+	switch rsa.Addr.Family {
+	case syscall.AF_INET:
+		pp := (*syscall.RawSockaddrInet4)(unsafe.Pointer(rsa))
+		sa := new(syscall.SockaddrInet4)
+		p := (*[2]byte)(unsafe.Pointer(&pp.Port))
+		sa.Port = int(p[0])<<8 + int(p[1])
+		sa.Addr = pp.Addr
+		return sa
+	case syscall.AF_INET6:
+		pp := (*syscall.RawSockaddrInet6)(unsafe.Pointer(rsa))
+		sa := new(syscall.SockaddrInet6)
+		p := (*[2]byte)(unsafe.Pointer(&pp.Port))
+		sa.Port = int(p[0])<<8 + int(p[1])
+		sa.ZoneId = pp.Scope_id
+		sa.Addr = pp.Addr
+		return sa
+	case syscall.AF_UNIX:
+		pp := (*syscall.RawSockaddrUnix)(unsafe.Pointer(rsa))
+		n := 0
+		for n < len(pp.Path) && pp.Path[n] != 0 {
+			n++
+		}
+		b := (*[len(pp.Path)]byte)(unsafe.Pointer(&pp.Path[0]))
+		return &syscall.SockaddrUnix{Name: string(b[:n])}
+	}
+	return nil
+}
+
+// sockaddrToAny encodes the socket address to rsa and returns the length.
+// It returns 0 if sa is nil or not supported.
+func sockaddrToAny(sa syscall.Sockaddr, rsa *syscall.RawSockaddrAny) uint32 {
+	switch sa := sa.(type) {
+	case *syscall.SockaddrInet4:
+		pp := (*syscall.RawSockaddrInet4)(unsafe.Pointer(rsa))
+		*pp = syscall.RawSockaddrInet4{Family: syscall.AF_INET, Addr: sa.Addr}
+		p := (*[2]byte)(unsafe.Pointer(&pp.Port))
+		p[0], p[1] = byte(sa.Port>>8), byte(sa.Port)
+		return syscall.SizeofSockaddrInet4
+	case *syscall.SockaddrInet6:
+		pp := (*syscall.RawSockaddrInet6)(unsafe.Pointer(rsa))
+		*pp = syscall.RawSockaddrInet6{Family: syscall.AF_INET6, Scope_id: sa.ZoneId, Addr: sa.Addr}
+		p := (*[2]byte)(unsafe.Pointer(&pp.Port))
+		p[0], p[1] = byte(sa.Port>>8), byte(sa.Port)
+		return syscall.SizeofSockaddrInet6
+	case *syscall.SockaddrUnix:
+		pp := (*syscall.RawSockaddrUnix)(unsafe.Pointer(rsa))
+		*pp = syscall.RawSockaddrUnix{Family: syscall.AF_UNIX}
+		if len(sa.Name) >= len(pp.Path) {
+			return 0
+		}
+		for i := 0; i < len(sa.Name); i++ {
+			pp.Path[i] = int8(sa.Name[i])
+		}
+		return uint32(2 + len(sa.Name) + 1)
+	}
+	return 0
+}
@@ -0,0 +1,209 @@
+// Copyright (c) 2023 cheng-zhongliang. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package event_test
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	. "github.com/cheng-zhongliang/event"
+)
+
+func TestDatagram(t *testing.T) {
+	base, err := NewBase()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	peer := conn.LocalAddr().(*net.UDPAddr)
+
+	var got []string
+	d, err := NewDatagram(base, "udp4", "127.0.0.1:0", func(data []byte, sa syscall.Sockaddr, arg interface{}) {
+		if sa.(*syscall.SockaddrInet4).Port != peer.Port {
+			t.Fatal("peer port not equal")
+		}
+		if arg != "hello" {
+			t.Fatal("arg not equal")
+		}
+		got = append(got, string(data))
+	}, "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SetBatch(0, 64); err != syscall.EINVAL {
+		t.Fatalf("error %v, want %v", err, syscall.EINVAL)
+	}
+	if err := d.SetBatch(4, 0); err != syscall.EINVAL {
+		t.Fatalf("error %v, want %v", err, syscall.EINVAL)
+	}
+	if err := d.SetBatch(4, 64); err != nil {
+		t.Fatal(err)
+	}
+
+	sa, err := d.Addr()
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: sa.(*syscall.SockaddrInet4).Port}
+
+	want := []string{"a", "bb", "ccc", "dddd", "eeeee", "ffffff"}
+	for _, s := range want {
+		if _, err := conn.WriteToUDP([]byte(s), addr); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := base.Loop(EvLoopOnce); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got) != 4 {
+		t.Fatalf("%d datagrams received in a batch, want 4", len(got))
+	}
+
+	if err := base.Loop(EvLoopOnce); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("%d datagrams received, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("datagram %q not equal to %q", got[i], want[i])
+		}
+	}
+
+	to := &syscall.SockaddrInet4{Port: peer.Port, Addr: [4]byte{127, 0, 0, 1}}
+	for _, s := range want {
+		if err := d.WriteTo([]byte(s), to); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := base.Loop(EvLoopOnce); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 64)
+	for _, s := range want {
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(buf[:n]) != s {
+			t.Fatalf("datagram %q not equal to %q", buf[:n], s)
+		}
+	}
+
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := base.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDatagramUnix(t *testing.T) {
+	base, err := NewBase()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "event")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var got string
+	var from syscall.Sockaddr
+	d0, err := NewDatagram(base, "unixgram", dir+"/d0.sock", func(data []byte, sa syscall.Sockaddr, arg interface{}) {
+		got = string(data)
+		from = sa
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d1, err := NewDatagram(base, "unixgram", dir+"/d1.sock", func(data []byte, sa syscall.Sockaddr, arg interface{}) {}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d1.WriteTo([]byte("hello"), &syscall.SockaddrUnix{Name: dir + "/d0.sock"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for deadline := time.Now().Add(time.Second); got == "" && time.Now().Before(deadline); {
+		if err := base.Loop(EvLoopOnce); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got != "hello" {
+		t.Fatal("datagram not equal")
+	}
+	if from.(*syscall.SockaddrUnix).Name != dir+"/d1.sock" {
+		t.Fatal("peer address not equal")
+	}
+
+	if err := d1.WriteTo([]byte("hello"), &syscall.SockaddrUnix{Name: dir + "/none.sock"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := base.Loop(EvLoopOnce); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d1.WriteTo([]byte("hello"), &syscall.SockaddrUnix{Name: dir + "/d0.sock"}); err == nil {
+		t.Fatal("send error not returned")
+	}
+	if err := d1.WriteTo([]byte("hello"), &syscall.SockaddrUnix{Name: dir + "/d0.sock"}); err != nil {
+		t.Fatal(err)
+	}
+
+	d0.Close()
+	d1.Close()
+
+	if err := base.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDatagramUnixAttachFailed(t *testing.T) {
+	base, err := NewBase()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := base.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "event")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// the socket is bound before it fails to attach to the base shut down.
+	if _, err := NewDatagram(base, "unixgram", dir+"/d.sock", func(data []byte, sa syscall.Sockaddr, arg interface{}) {}, nil); err == nil {
+		t.Fatal("attach error not returned")
+	}
+	if _, err := os.Stat(dir + "/d.sock"); !os.IsNotExist(err) {
+		t.Fatalf("socket file left: %v", err)
+	}
+}
@@ -0,0 +1,158 @@
+// Copyright (c) 2023 cheng-zhongliang. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package event
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"io"
+	"io/ioutil"
+)
+
+const (
+	// deflateWindow is the size of the history a deflate stream refers to.
+	deflateWindow = 1 << 15
+)
+
+var ErrDeflateTrailing = errors.New("bytes after the end of the deflate stream")
+
+var (
+	// deflateSync is the empty stored block ending the output flushed by a deflate stream.
+	deflateSync = []byte{0x00, 0x00, 0xff, 0xff}
+	// deflateFinal is the empty final block appended to decompress the flushed output.
+	deflateFinal = []byte{0x01, 0x00, 0x00, 0xff, 0xff}
+)
+
+// deflateFilter is the filter compressing the output and decompressing the input by deflate.
+type deflateFilter struct {
+	// w is the compressor of the output, which writes to zout.
+	w *flate.Writer
+	// zout is the compressed output not moved to the destination yet.
+	zout Buffer
+	// hist is the last decompressed bytes the following input refers to.
+	hist []byte
+	// finished reports whether the input is ended by the final block.
+	finished bool
+}
+
+// deflateSource reads the compressed input followed by the tail ending the flushed stream.
+// It is a byte reader, so the decompressor reads no further than the end of the stream.
+type deflateSource struct {
+	// p is the compressed input.
+	p []byte
+	// tail is the bytes read after the input.
+	tail []byte
+	// n is the number of the bytes read.
+	n int
+}
+
+// NewDeflateFilter creates a filter which compresses the output by deflate at the level,
+// and decompresses the input compressed by the filter of the peer.
+// The output is sent when it is flushed, and the input is decompressed when the peer flushes.
+func NewDeflateFilter(level int) (Filter, error) {
+	f := new(deflateFilter)
+	w, err := flate.NewWriter(&f.zout, level)
+	if err != nil {
+		return nil, err
+	}
+	f.w = w
+	return f, nil
+}
+
+func (f *deflateFilter) Output(dst, src *Buffer, mode int) error {
+	if _, err := f.w.Write(src.Bytes()); err != nil {
+		return err
+	}
+	src.Reset()
+	switch mode {
+	case FilterFlush:
+		if err := f.w.Flush(); err != nil {
+			return err
+		}
+	case FilterFinished:
+		if err := f.w.Close(); err != nil {
+			return err
+		}
+	}
+	dst.Write(f.zout.Bytes())
+	f.zout.Reset()
+	return nil
+}
+
+func (f *deflateFilter) Input(dst, src *Buffer, mode int) error {
+	p := src.Bytes()
+	if len(p) == 0 {
+		return nil
+	}
+	if f.finished {
+		return ErrDeflateTrailing
+	}
+	flushed := bytes.HasSuffix(p, deflateSync)
+	if !flushed && mode != FilterFinished {
+		return nil
+	}
+	s := &deflateSource{p: p}
+	if flushed {
+		s.tail = deflateFinal
+	}
+	r := flate.NewReaderDict(s, f.hist)
+	out, err := ioutil.ReadAll(r)
+	r.Close()
+	switch {
+	case err == nil && s.n <= len(p):
+		// the input is ended by its own final block.
+		if s.n < len(p) {
+			return ErrDeflateTrailing
+		}
+		f.finished = true
+	case err == nil && s.n == len(p)+len(s.tail):
+	case mode == FilterFinished:
+		if err == nil {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	default:
+		// the sync block is a part of the compressed bytes, so more input is needed.
+		return nil
+	}
+	dst.Write(out)
+	src.Reset()
+	f.hist = append(f.hist, out...)
+	if len(f.hist) > deflateWindow {
+		f.hist = append(f.hist[:0], f.hist[len(f.hist)-deflateWindow:]...)
+	}
+	return nil
+}
+
+func (s *deflateSource) Read(b []byte) (int, error) {
+	n := 0
+	for n < len(b) {
+		c, err := s.ReadByte()
+		if err != nil {
+			if n > 0 {
+				return n, nil
+			}
+			return 0, err
+		}
+		b[n] = c
+		n++
+	}
+	return n, nil
+}
+
+func (s *deflateSource) ReadByte() (byte, error) {
+	var c byte
+	switch {
+	case s.n < len(s.p):
+		c = s.p[s.n]
+	case s.n < len(s.p)+len(s.tail):
+		c = s.tail[s.n-len(s.p)]
+	default:
+		return 0, io.EOF
+	}
+	s.n++
+	return c, nil
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2023 cheng-zhongliang. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package event
+
+import (
+	"syscall"
+	"time"
+)
+
+// DispatchLimits is the limits of the callbacks run per loop iteration.
+// The active events left by the limits run in the next iteration, which polls without blocking.
+// It works in a similar manner as max_dispatch_callbacks, max_dispatch_interval
+// and limit_callbacks_after_prio of libevent.
+type DispatchLimits struct {
+	// MaxCallbacks is the maximum number of the limited callbacks per iteration.
+	// Zero means no limit.
+	MaxCallbacks int
+	// MaxTime is the maximum time of the limited callbacks per iteration.
+	// Zero means no limit.
+	MaxTime time.Duration
+	// LimitPriority is the highest priority limited. The events of the higher priorities
+	// always run and are not counted. Default is HP, which limits all the events.
+	LimitPriority eventPriority
+	// RecheckPriorities polls the ready events without blocking after every limited callback
+	// of a priority lower than HP, so the events of higher priorities ready meanwhile,
+	// including the expired timers, run before the next one of the lower priority.
+	// It costs a poll per callback and requires MaxCallbacks or MaxTime, which bound the polls,
+	// as the callbacks re-arming the events of higher priorities would keep the iteration going.
+	RecheckPriorities bool
+}
+
+// SetDispatchLimits sets the limits of the callbacks run per loop iteration.
+// It returns syscall.EINVAL if RecheckPriorities is set without MaxCallbacks or MaxTime.
+func (bs *EventBase) SetDispatchLimits(limits DispatchLimits) error {
+	if limits.RecheckPriorities && limits.MaxCallbacks <= 0 && limits.MaxTime <= 0 {
+		return syscall.EINVAL
+	}
+	bs.limits = limits
+	return nil
+}
+
+// overBudget counts the callback run since the start of the iteration,
+// and reports whether the limits are reached.
+func (bs *EventBase) overBudget(count *int, start time.Time) bool {
+	*count++
+	if bs.limits.MaxCallbacks > 0 && *count >= bs.limits.MaxCallbacks {
+		return true
+	}
+	return bs.limits.MaxTime > 0 && time.Since(start) >= bs.limits.MaxTime
+}
+
+// recheck polls the ready events and the expired timers without blocking.
+func (bs *EventBase) recheck() error {
+	bs.checkStop()
+	if err := bs.poll.wait(bs.onActive, 0); err != nil {
+		return err
+	}
+	bs.updateTimeCache()
+	bs.onTimeout()
+	return nil
+}
+
+// hasActive reports whether any event is left active.
+func (bs *EventBase) hasActive() bool {
+	for _, l := range bs.activeEvLists {
+		if l.front() != nil {
+			return true
+		}
+	}
+	return false
+}
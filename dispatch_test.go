@@ -0,0 +1,212 @@
+// Copyright (c) 2023 cheng-zhongliang. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package event_test
+
+import (
+	"reflect"
+	"sort"
+	"syscall"
+	"testing"
+	"time"
+
+	. "github.com/cheng-zhongliang/event"
+)
+
+// expiredTimer attaches an expired timer which records its name when fired.
+func expiredTimer(t *testing.T, base *EventBase, name string, fired *[]string, prioritize func(ev *Event)) {
+	ev := NewTimer(base, func(fd int, events uint32, arg interface{}) {
+		*fired = append(*fired, name)
+	}, nil)
+	prioritize(ev)
+	if err := ev.Attach(0); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func hp(ev *Event) { ev.SetPriority(HP) }
+func mp(ev *Event) { ev.SetPriority(MP) }
+func lp(ev *Event) { ev.SetPriority(LP) }
+
+func TestDispatchMaxCallbacks(t *testing.T) {
+	base, err := NewBase()
+	if err != nil {
+		t.Fatal(err)
+	}
+	base.SetDispatchLimits(DispatchLimits{MaxCallbacks: 2, LimitPriority: MP})
+
+	var fired []string
+	expiredTimer(t, base, "h1", &fired, hp)
+	expiredTimer(t, base, "h2", &fired, hp)
+	expiredTimer(t, base, "m1", &fired, mp)
+	expiredTimer(t, base, "m2", &fired, mp)
+	expiredTimer(t, base, "l1", &fired, lp)
+	expiredTimer(t, base, "l2", &fired, lp)
+
+	want := [][]string{
+		{"h1", "h2", "m1", "m2"},
+		{"h1", "h2", "m1", "m2", "l1", "l2"},
+	}
+	for i := range want {
+		if err := base.Loop(EvLoopOnce | EvLoopNoblock); err != nil {
+			t.Fatal(err)
+		}
+		// the timers of the same priority expire in any order.
+		got := append([]string(nil), fired...)
+		sort.Strings(got)
+		sort.Strings(want[i])
+		if !reflect.DeepEqual(got, want[i]) {
+			t.Fatalf("iteration %d: fired %v, want %v", i, fired, want[i])
+		}
+	}
+
+	if err := base.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDispatchMaxTime(t *testing.T) {
+	base, err := NewBase()
+	if err != nil {
+		t.Fatal(err)
+	}
+	base.SetDispatchLimits(DispatchLimits{MaxTime: 8 * time.Millisecond})
+
+	fired := 0
+	for i := 0; i < 5; i++ {
+		ev := NewTimer(base, func(fd int, events uint32, arg interface{}) {
+			fired++
+			time.Sleep(5 * time.Millisecond)
+		}, nil)
+		if err := ev.Attach(0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := base.Loop(EvLoopOnce | EvLoopNoblock); err != nil {
+		t.Fatal(err)
+	}
+	if fired < 1 || fired > 2 {
+		t.Fatalf("fired %d in an iteration, want 1 or 2", fired)
+	}
+	// the events left active are not blocked by the poll.
+	for fired < 5 {
+		if err := base.Loop(EvLoopOnce); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := base.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDispatchRecheckPriorities(t *testing.T) {
+	base, err := NewBase()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := base.SetDispatchLimits(DispatchLimits{MaxCallbacks: 64, RecheckPriorities: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer syscall.Close(fds[0])
+	defer syscall.Close(fds[1])
+
+	var fired []string
+	rev := New(base, fds[0], EvRead, func(fd int, events uint32, arg interface{}) {
+		fired = append(fired, "read")
+	}, nil)
+	rev.SetPriority(HP)
+	if err := rev.Attach(0); err != nil {
+		t.Fatal(err)
+	}
+	ev := NewTimer(base, func(fd int, events uint32, arg interface{}) {
+		fired = append(fired, "l1")
+		syscall.Write(fds[1], []byte{0})
+	}, nil)
+	ev.SetPriority(LP)
+	if err := ev.Attach(0); err != nil {
+		t.Fatal(err)
+	}
+	later := NewTimer(base, func(fd int, events uint32, arg interface{}) {
+		fired = append(fired, "l2")
+	}, nil)
+	later.SetPriority(LP)
+	if err := later.Attach(time.Nanosecond); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(time.Millisecond)
+	if err := base.Loop(EvLoopOnce | EvLoopNoblock); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"l1", "read", "l2"}; !reflect.DeepEqual(fired, want) {
+		t.Fatalf("fired %v, want %v", fired, want)
+	}
+
+	if err := base.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDispatchRecheckError(t *testing.T) {
+	base, err := NewBase()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := base.SetDispatchLimits(DispatchLimits{MaxCallbacks: 64, RecheckPriorities: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the recheck after the callback fails as the poll is closed.
+	ev := NewTimer(base, func(fd int, events uint32, arg interface{}) {
+		base.Shutdown()
+	}, nil)
+	ev.SetPriority(LP)
+	if err := ev.Attach(0); err != nil {
+		t.Fatal(err)
+	}
+	if err := base.Loop(EvLoopOnce | EvLoopNoblock); err != syscall.EBADF {
+		t.Fatalf("error %v, want %v", err, syscall.EBADF)
+	}
+}
+
+func TestDispatchRecheckBounded(t *testing.T) {
+	base, err := NewBase()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := base.SetDispatchLimits(DispatchLimits{RecheckPriorities: true}); err != syscall.EINVAL {
+		t.Fatalf("error %v, want %v", err, syscall.EINVAL)
+	}
+	if err := base.SetDispatchLimits(DispatchLimits{MaxCallbacks: 4, LimitPriority: LP, RecheckPriorities: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the timer re-armed by itself is ready again at every recheck,
+	// which the callbacks not limited must not run.
+	n := 0
+	var ev *Event
+	ev = NewTimer(base, func(fd int, events uint32, arg interface{}) {
+		n++
+		ev.Attach(0)
+	}, nil)
+	if err := ev.Attach(0); err != nil {
+		t.Fatal(err)
+	}
+	if err := base.Loop(EvLoopOnce | EvLoopNoblock); err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatalf("fired %d times, want 1", n)
+	}
+
+	if err := base.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,185 @@
+// Copyright (c) 2023 cheng-zhongliang. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package event
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"strings"
+)
+
+const (
+	dnsTypeA    = 1
+	dnsTypeAAAA = 28
+	dnsClassIN  = 1
+
+	dnsFlagResponse  = 0x8000
+	dnsFlagRecursion = 0x0100
+	dnsRcodeMask     = 0x000f
+
+	dnsRcodeSuccess   = 0
+	dnsRcodeNameError = 3
+
+	dnsHeaderLen = 12
+	dnsMaxMsgLen = 512
+)
+
+var errDNSMsg = errors.New("malformed dns message")
+
+// dnsResponse is the parsed response of a dns query.
+type dnsResponse struct {
+	// id is the id of the query.
+	id uint16
+	// name is the name in the question.
+	name string
+	// qtype is the type in the question.
+	qtype uint16
+	// rcode is the response code.
+	rcode int
+	// ips is the addresses in the answers.
+	ips []net.IP
+	// ttl is the minimum ttl of the answers.
+	ttl uint32
+}
+
+// appendDNSQuery appends a recursive query of the name and type to b.
+func appendDNSQuery(b []byte, id uint16, name string, qtype uint16) ([]byte, error) {
+	var hdr [dnsHeaderLen]byte
+	binary.BigEndian.PutUint16(hdr[0:], id)
+	binary.BigEndian.PutUint16(hdr[2:], dnsFlagRecursion)
+	binary.BigEndian.PutUint16(hdr[4:], 1)
+	b = append(b, hdr[:]...)
+	n := len(b)
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		if len(label) == 0 || len(label) > 63 {
+			return nil, errDNSMsg
+		}
+		b = append(b, byte(len(label)))
+		b = append(b, label...)
+	}
+	b = append(b, 0)
+	if len(b)-n > 255 {
+		return nil, errDNSMsg
+	}
+	return append(b, byte(qtype>>8), byte(qtype), 0, dnsClassIN), nil
+}
+
+// parseDNSResponse parses the response with a single question.
+// Only the A and AAAA records in the answers are collected.
+func parseDNSResponse(msg []byte) (*dnsResponse, error) {
+	if len(msg) < dnsHeaderLen {
+		return nil, errDNSMsg
+	}
+	flags := binary.BigEndian.Uint16(msg[2:])
+	if flags&dnsFlagResponse == 0 || binary.BigEndian.Uint16(msg[4:]) != 1 {
+		return nil, errDNSMsg
+	}
+	resp := new(dnsResponse)
+	resp.id = binary.BigEndian.Uint16(msg[0:])
+	resp.rcode = int(flags & dnsRcodeMask)
+	ancount := int(binary.BigEndian.Uint16(msg[6:]))
+	name, off, err := readDNSName(msg, dnsHeaderLen)
+	if err != nil || off+4 > len(msg) {
+		return nil, errDNSMsg
+	}
+	resp.name = name
+	resp.qtype = binary.BigEndian.Uint16(msg[off:])
+	off += 4
+	for i := 0; i < ancount; i++ {
+		if off, err = skipDNSName(msg, off); err != nil || off+10 > len(msg) {
+			return nil, errDNSMsg
+		}
+		typ := binary.BigEndian.Uint16(msg[off:])
+		class := binary.BigEndian.Uint16(msg[off+2:])
+		ttl := binary.BigEndian.Uint32(msg[off+4:])
+		rdlen := int(binary.BigEndian.Uint16(msg[off+8:]))
+		off += 10
+		if off+rdlen > len(msg) {
+			return nil, errDNSMsg
+		}
+		rdata := msg[off : off+rdlen]
+		off += rdlen
+		if class != dnsClassIN || typ != resp.qtype {
+			continue
+		}
+		switch {
+		case typ == dnsTypeA && rdlen == net.IPv4len:
+		case typ == dnsTypeAAAA && rdlen == net.IPv6len:
+		default:
+			continue
+		}
+		if len(resp.ips) == 0 || ttl < resp.ttl {
+			resp.ttl = ttl
+		}
+		resp.ips = append(resp.ips, net.IP(append([]byte(nil), rdata...)))
+	}
+	return resp, nil
+}
+
+// readDNSName reads the possibly compressed name at off.
+// It returns the name and the offset after the name.
+func readDNSName(msg []byte, off int) (string, int, error) {
+	var sb strings.Builder
+	end := -1
+	for hops := 0; hops < 16; {
+		if off >= len(msg) {
+			break
+		}
+		c := int(msg[off])
+		switch c & 0xc0 {
+		case 0x00:
+			if c == 0 {
+				if end < 0 {
+					end = off + 1
+				}
+				if sb.Len() == 0 {
+					sb.WriteByte('.')
+				}
+				return sb.String(), end, nil
+			}
+			if off+1+c > len(msg) {
+				return "", 0, errDNSMsg
+			}
+			sb.Write(msg[off+1 : off+1+c])
+			sb.WriteByte('.')
+			off += 1 + c
+		case 0xc0:
+			if off+2 > len(msg) {
+				return "", 0, errDNSMsg
+			}
+			if end < 0 {
+				end = off + 2
+			}
+			off = int(msg[off]&0x3f)<<8 | int(msg[off+1])
+			hops++
+		default:
+			return "", 0, errDNSMsg
+		}
+	}
+	return "", 0, errDNSMsg
+}
+
+// skipDNSName returns the offset after the possibly compressed name at off.
+func skipDNSName(msg []byte, off int) (int, error) {
+	for off < len(msg) {
+		c := int(msg[off])
+		switch c & 0xc0 {
+		case 0x00:
+			if c == 0 {
+				return off + 1, nil
+			}
+			off += 1 + c
+		case 0xc0:
+			if off+2 > len(msg) {
+				return 0, errDNSMsg
+			}
+			return off + 2, nil
+		default:
+			return 0, errDNSMsg
+		}
+	}
+	return 0, errDNSMsg
+}
@@ -9,6 +9,7 @@ package event
 
 import (
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 	"unsafe"
@@ -17,6 +18,8 @@ import (
 const (
 	initialNEvent = 0x20
 	maxNEvent     = 0x1000
+	// epollExclusive wakes up one of the epoll instances watching the same fd.
+	epollExclusive = 0x10000000
 )
 
 var evPool = sync.Pool{
@@ -35,6 +38,14 @@ type poll struct {
 	fd       int
 	fdEvents map[int]*fdEvent
 	events   []syscall.EpollEvent
+	// shared is the number of the events added by addShared so far.
+	shared int32
+	// sharedSeen is the number of the shared events the loop is synchronized with.
+	sharedSeen int32
+	// sharedMu guards the fd events below.
+	sharedMu sync.Mutex
+	// sharedEvents keeps the fd events added by addShared alive, as only the kernel refers to them.
+	sharedEvents map[int]*fdEvent
 }
 
 func openPoll() (*poll, error) {
@@ -46,6 +57,7 @@ func openPoll() (*poll, error) {
 	ep.fd = fd
 	ep.fdEvents = make(map[int]*fdEvent, initialNEvent)
 	ep.events = make([]syscall.EpollEvent, initialNEvent)
+	ep.sharedEvents = make(map[int]*fdEvent)
 	return ep, nil
 }
 
@@ -67,10 +79,49 @@ func (ep *poll) add(ev *Event) error {
 		es.evs |= syscall.EPOLLOUT
 	}
 	epEv := syscall.EpollEvent{Events: es.evs}
+	if ev.exclusive && op == syscall.EPOLL_CTL_ADD {
+		epEv.Events |= epollExclusive
+	}
 	*(**fdEvent)(unsafe.Pointer(&epEv.Fd)) = es
 	return syscall.EpollCtl(ep.fd, op, ev.fd, &epEv)
 }
 
+// addShared watches the read event without the state of the loop.
+// It is safe to call from any goroutine.
+// The event is removed by delShared.
+func (ep *poll) addShared(ev *Event) error {
+	es := &fdEvent{r: ev, evs: syscall.EPOLLIN}
+	ep.sharedMu.Lock()
+	ep.sharedEvents[ev.fd] = es
+	atomic.AddInt32(&ep.shared, 1)
+	ep.sharedMu.Unlock()
+	epEv := syscall.EpollEvent{Events: es.evs}
+	*(**fdEvent)(unsafe.Pointer(&epEv.Fd)) = es
+	if err := syscall.EpollCtl(ep.fd, syscall.EPOLL_CTL_ADD, ev.fd, &epEv); err != nil {
+		ep.delShared(ev)
+		return err
+	}
+	return nil
+}
+
+// delShared removes the read event added by addShared.
+func (ep *poll) delShared(ev *Event) error {
+	ep.sharedMu.Lock()
+	delete(ep.sharedEvents, ev.fd)
+	ep.sharedMu.Unlock()
+	return syscall.EpollCtl(ep.fd, syscall.EPOLL_CTL_DEL, ev.fd, &syscall.EpollEvent{})
+}
+
+// syncShared synchronizes the loop with the goroutines which added the shared events,
+// before the events are reported by the kernel.
+func (ep *poll) syncShared() {
+	if n := atomic.LoadInt32(&ep.shared); n != ep.sharedSeen {
+		ep.sharedMu.Lock()
+		ep.sharedSeen = n
+		ep.sharedMu.Unlock()
+	}
+}
+
 func (ep *poll) del(ev *Event) error {
 	es := ep.fdEvents[ev.fd]
 	if ev.events&EvRead != 0 {
@@ -102,6 +153,7 @@ func (ep *poll) wait(cb func(ev *Event, res uint32), timeout time.Duration) erro
 	if err != nil && !temporaryErr(err) {
 		return err
 	}
+	ep.syncShared()
 	for i := 0; i < n; i++ {
 		var evRead, evWrite *Event
 		what := ep.events[i].Events
@@ -10,9 +10,15 @@ import (
 )
 
 var (
-	ErrEventExists    = errors.New("event exists")
-	ErrEventNotExists = errors.New("event does not exist")
-	ErrEventInvalid   = errors.New("event invalid")
+	ErrEventExists      = errors.New("event exists")
+	ErrEventNotExists   = errors.New("event does not exist")
+	ErrEventInvalid     = errors.New("event invalid")
+	ErrConnectTimeout   = errors.New("connect timeout")
+	ErrHostNotFound     = errors.New("no such host")
+	ErrResolveTimeout   = errors.New("resolve timeout")
+	ErrFdsTruncated     = errors.New("passed fds truncated")
+	ErrBaseShutdown     = errors.New("event base shut down")
+	ErrPidfdUnsupported = errors.New("pidfd_open not supported, Linux 5.3 or later required")
 )
 
 func temporaryErr(err error) bool {
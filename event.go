@@ -5,7 +5,11 @@
 package event
 
 import (
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
+	"unsafe"
 )
 
 const (
@@ -39,6 +43,18 @@ const (
 	evListTimeout = 0x04
 )
 
+// The states of the loop of an event base.
+const (
+	// loopIdle is the state when the loop is not running.
+	loopIdle = iota
+	// loopRunning is the state when the loop is running.
+	loopRunning
+	// loopStopping is the state when the base is shut down while the loop is running.
+	loopStopping
+	// loopClosed is the state after the base is shut down.
+	loopClosed
+)
+
 // eventPriority is the priority of the event.
 type eventPriority uint8
 
@@ -70,6 +86,8 @@ type Event struct {
 	deadline time.Time
 	// priority is the priority of the event.
 	priority eventPriority
+	// exclusive reports whether the fd is watched by EPOLLEXCLUSIVE.
+	exclusive bool
 }
 
 // New creates a new event with default priority MP.
@@ -163,6 +181,43 @@ type EventBase struct {
 	evHeap *eventHeap
 	// nowTimeCache is the cache of now time.
 	nowTimeCache time.Time
+	// tasks is the queue of the functions posted to run in the loop.
+	tasks *taskQueue
+	// posted is set when the loop is woken up to run the posted tasks.
+	posted int32
+	// notifyMu guards the creation of the notifier and the shutdown of the base.
+	notifyMu sync.Mutex
+	// notifier is the *Notifier to wake up the loop to run the posted tasks.
+	// It is created by the first Post.
+	notifier unsafe.Pointer
+	// closed is set when the base is shut down.
+	closed int32
+	// state is the state of the loop, which tells Shutdown whether the loop tears down the base.
+	state int32
+	// posting is the number of the posts pushing their tasks.
+	posting int32
+	// poolMu guards the worker pool and its configuration.
+	poolMu sync.Mutex
+	// poolConfig is the configuration of the worker pool.
+	poolConfig PoolConfig
+	// pool is the worker pool started by Go.
+	pool *pool
+	// cpus is the CPUs the thread of the loop is bound to.
+	cpus []int
+	// pin reports whether the loop is locked to its OS thread.
+	pin bool
+	// pinned reports whether the thread is locked and bound.
+	pinned bool
+	// prevCPUs is the CPUs the thread was bound to before the loop runs.
+	prevCPUs cpuMask
+	// tid is the id of the OS thread the loop is locked to, or -1.
+	tid int32
+	// panicHandler is the handler of the panics recovered from the callback functions.
+	panicHandler PanicHandler
+	// detachOnPanic reports whether the event whose callback function panics is detached.
+	detachOnPanic bool
+	// limits is the limits of the callbacks run per iteration.
+	limits DispatchLimits
 }
 
 // NewBase creates a new event base.
@@ -177,6 +232,8 @@ func NewBase() (*EventBase, error) {
 	bs.activeEvLists = []*list{newList(), newList(), newList()}
 	bs.evHeap = new(eventHeap)
 	bs.nowTimeCache = time.Time{}
+	bs.tid = -1
+	bs.tasks = newTaskQueue()
 	return bs, nil
 }
 
@@ -186,15 +243,42 @@ func NewBase() (*EventBase, error) {
 // If EvLoopOnce is set, the loop will just loop once.
 // If EvLoopNoblock is set, the loop will not block.
 func (bs *EventBase) Loop(flags int) error {
+	if !atomic.CompareAndSwapInt32(&bs.state, loopIdle, loopRunning) {
+		if atomic.LoadInt32(&bs.state) == loopClosed {
+			return syscall.EBADF
+		}
+		// the loop is called by a callback function of the running loop.
+		return bs.loop(flags)
+	}
+	err := bs.loop(flags)
+	if !atomic.CompareAndSwapInt32(&bs.state, loopRunning, loopIdle) {
+		// the base is shut down after the loop polls the last time.
+		if serr := bs.stop(); err == nil {
+			err = serr
+		}
+	}
+	return err
+}
+
+func (bs *EventBase) loop(flags int) error {
+	if bs.pin && !bs.pinned {
+		if err := bs.pinThread(); err != nil {
+			return err
+		}
+		defer bs.unpinThread()
+	}
 	bs.clearTimeCache()
 	for {
+		bs.checkStop()
 		err := bs.poll.wait(bs.onActive, bs.waitTime(flags&EvLoopNoblock != 0))
 		if err != nil {
 			return err
 		}
 		bs.updateTimeCache()
 		bs.onTimeout()
-		bs.handleActiveEvents()
+		if err := bs.handleActiveEvents(); err != nil {
+			return err
+		}
 		if flags&EvLoopOnce != 0 {
 			return nil
 		}
@@ -208,7 +292,65 @@ func (bs *EventBase) Dispatch() error {
 }
 
 // Shutdown breaks event loop and close the poll.
+// It is safe to call from any goroutine. If the loop is running, it wakes up the loop,
+// which shuts down the base before it polls again and returns syscall.EBADF.
+// Otherwise the base is shut down before Shutdown returns.
+// The posts fail with ErrBaseShutdown once it is called.
 func (bs *EventBase) Shutdown() error {
+	for {
+		switch atomic.LoadInt32(&bs.state) {
+		case loopIdle:
+			if atomic.CompareAndSwapInt32(&bs.state, loopIdle, loopClosed) {
+				return bs.close()
+			}
+		case loopRunning:
+			// the notifier is created before the posts are refused, to wake up the loop.
+			n, err := bs.loadNotifier()
+			if !atomic.CompareAndSwapInt32(&bs.state, loopRunning, loopStopping) {
+				continue
+			}
+			bs.notifyMu.Lock()
+			atomic.StoreInt32(&bs.closed, 1)
+			bs.notifyMu.Unlock()
+			if err != nil {
+				return err
+			}
+			n.Trigger()
+			return nil
+		default:
+			return ErrBaseShutdown
+		}
+	}
+}
+
+// checkStop shuts down the base if Shutdown is called while the loop is running.
+func (bs *EventBase) checkStop() {
+	if atomic.LoadInt32(&bs.state) == loopStopping {
+		bs.stop()
+	}
+}
+
+// stop shuts down the base in the loop after Shutdown is called while the loop is running.
+func (bs *EventBase) stop() error {
+	if !atomic.CompareAndSwapInt32(&bs.state, loopStopping, loopClosed) {
+		return nil
+	}
+	return bs.close()
+}
+
+// close tears down the base in the goroutine of the loop, or when the loop is not running.
+func (bs *EventBase) close() error {
+	bs.notifyMu.Lock()
+	atomic.StoreInt32(&bs.closed, 1)
+	n := (*Notifier)(atomic.LoadPointer(&bs.notifier))
+	bs.notifyMu.Unlock()
+	if n != nil {
+		bs.eventQueueRemove(n.ev, evListActive)
+		bs.poll.delShared(n.ev)
+		n.Close()
+	}
+	bs.cancelTasks()
+	bs.closePool()
 	return bs.poll.close()
 }
 
@@ -243,7 +385,7 @@ func (bs *EventBase) delEvent(ev *Event) error {
 }
 
 func (bs *EventBase) waitTime(noblock bool) time.Duration {
-	if noblock {
+	if noblock || bs.hasActive() {
 		return 0
 	}
 	if !bs.evHeap.empty() {
@@ -277,25 +419,43 @@ func (bs *EventBase) onActive(ev *Event, res uint32) {
 	bs.eventQueueInsert(ev, evListActive)
 }
 
-func (bs *EventBase) handleActiveEvents() {
-	for i := range bs.activeEvLists {
-		for e := bs.activeEvLists[i].front(); e != nil; {
-			next := e.nextEle()
-			ev := e.value.(*Event)
-			e = next
-			if ev.events&EvPersist != 0 {
-				bs.eventQueueRemove(ev, evListActive)
-				if ev.events&EvTimeout != 0 {
-					bs.eventQueueRemove(ev, evListTimeout)
-					ev.deadline = bs.Now().Add(ev.timeout)
-					bs.eventQueueInsert(ev, evListTimeout)
-				}
-			} else {
-				bs.delEvent(ev)
+func (bs *EventBase) handleActiveEvents() error {
+	count := 0
+	var start time.Time
+	if bs.limits.MaxTime > 0 {
+		start = time.Now()
+	}
+	for i := 0; i < len(bs.activeEvLists); {
+		e := bs.activeEvLists[i].front()
+		if e == nil {
+			i++
+			continue
+		}
+		ev := e.value.(*Event)
+		if ev.events&EvPersist != 0 {
+			bs.eventQueueRemove(ev, evListActive)
+			if ev.events&EvTimeout != 0 {
+				bs.eventQueueRemove(ev, evListTimeout)
+				ev.deadline = bs.Now().Add(ev.timeout)
+				bs.eventQueueInsert(ev, evListTimeout)
 			}
-			ev.cb(ev.fd, ev.res, ev.arg)
+		} else {
+			bs.delEvent(ev)
+		}
+		bs.runCallback(ev)
+		limited := eventPriority(i) >= bs.limits.LimitPriority
+		if limited && bs.overBudget(&count, start) {
+			return nil
+		}
+		// only the limited callbacks recheck, so the budget bounds the polls.
+		if bs.limits.RecheckPriorities && i > 0 && limited {
+			if err := bs.recheck(); err != nil {
+				return err
+			}
+			i = 0
 		}
 	}
+	return nil
 }
 
 func (bs *EventBase) eventQueueInsert(ev *Event, which int) {
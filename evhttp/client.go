@@ -0,0 +1,586 @@
+// Copyright (c) 2023 cheng-zhongliang. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package evhttp
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/cheng-zhongliang/event"
+)
+
+const (
+	// DefaultMaxIdleConnsPerHost is the default maximum number of idle connections kept for a host.
+	DefaultMaxIdleConnsPerHost = 2
+)
+
+const (
+	// clientIdle is the state when the connection is in the pool.
+	clientIdle = iota
+	// clientBusy is the state when the connection is serving a request.
+	clientBusy
+	// clientClosed is the state when the connection is closed.
+	clientClosed
+)
+
+var (
+	ErrUnsupportedScheme = errors.New("unsupported url scheme")
+	ErrRequestTimeout    = errors.New("http request timeout")
+	ErrMalformedResponse = errors.New("malformed http response")
+	ErrClientClosed      = errors.New("http client closed")
+)
+
+// ClientRequest is the HTTP request sent by the client.
+type ClientRequest struct {
+	// Method is the method of the request.
+	Method string
+	// URL is the URL of the request. Only the http scheme is supported.
+	URL *url.URL
+	// Header is the header fields of the request.
+	Header textproto.MIMEHeader
+	// Body is the body of the request.
+	Body []byte
+	// OnBody is called with the pieces of the response body as they arrive if it is not nil.
+	// The body of the response passed to the completion callback is empty in that case.
+	OnBody func(resp *Response, p []byte)
+}
+
+// Response is the HTTP response received by the client.
+type Response struct {
+	// Proto is the protocol version of the response.
+	Proto string
+	// StatusCode is the status code of the response.
+	StatusCode int
+	// Status is the reason phrase of the response.
+	Status string
+	// Header is the header fields of the response.
+	Header textproto.MIMEHeader
+	// Body is the body of the response.
+	Body []byte
+}
+
+// Client is the HTTP/1.1 client on the event loop.
+// The connections are reused per host through a pool of idle connections.
+type Client struct {
+	// base is the event base of the client.
+	base *event.EventBase
+	// resolver is the resolver of the host names.
+	resolver *event.Resolver
+	// idle is the idle connections by host.
+	idle map[string][]*clientConn
+	// conns is the open connections.
+	conns map[*clientConn]struct{}
+	// calls is the calls not complete, including those resolving or connecting.
+	calls map[*clientCall]struct{}
+	// closed reports whether the client is closed.
+	closed bool
+	// maxIdlePerHost is the maximum number of idle connections kept for a host.
+	maxIdlePerHost int
+	// maxHeaderSize is the maximum size of the header of a response.
+	maxHeaderSize int
+	// maxBodySize is the maximum size of the body of a response.
+	maxBodySize int64
+	// dialTimeout is the timeout to connect.
+	dialTimeout time.Duration
+	// requestTimeout is the timeout of the whole request.
+	requestTimeout time.Duration
+	// idleTimeout is the timeout of the idle connections.
+	idleTimeout time.Duration
+}
+
+// clientCall is a request waiting for the response.
+type clientCall struct {
+	// cl is the client of the call.
+	cl *Client
+	// req is the request of the call.
+	req *ClientRequest
+	// key is the host and port of the request.
+	key string
+	// cb is the callback function when the call completes.
+	cb func(resp *Response, err error, arg interface{})
+	// arg is the argument passed to the callback function.
+	arg interface{}
+	// timer is the timer event of the request timeout.
+	timer *event.Event
+	// cc is the connection serving the call.
+	cc *clientConn
+	// retried reports whether the call is retried on a new connection.
+	retried bool
+	// done reports whether the call is complete.
+	done bool
+}
+
+// clientConn is a connection to a host.
+type clientConn struct {
+	// cl is the client of the connection.
+	cl *Client
+	// key is the host and port of the connection.
+	key string
+	// fd is the socket of the connection.
+	fd int
+	// rev is the read event of the socket.
+	rev *event.Event
+	// wev is the write event of the socket.
+	wev *event.Event
+	// timer is the timer event of the idle timeout.
+	timer *event.Event
+	// in is the bytes read from the socket.
+	in event.Buffer
+	// out is the bytes to write to the socket.
+	out event.Buffer
+	// state is the state of the connection.
+	state int
+	// reused reports whether the connection served a request before.
+	reused bool
+	// received reports whether any bytes of the response are received.
+	received bool
+	// call is the call served by the connection.
+	call *clientCall
+	// resp is the response being read.
+	resp *Response
+	// closeAfter reports whether the connection is closed after the response.
+	closeAfter bool
+	// body is the body decoder of the response. Nil until the head is read.
+	body *bodyReader
+}
+
+// NewClient creates a new client on the event base.
+func NewClient(base *event.EventBase) *Client {
+	cl := new(Client)
+	cl.base = base
+	cl.idle = make(map[string][]*clientConn)
+	cl.conns = make(map[*clientConn]struct{})
+	cl.calls = make(map[*clientCall]struct{})
+	cl.maxIdlePerHost = DefaultMaxIdleConnsPerHost
+	cl.maxHeaderSize = DefaultMaxHeaderSize
+	cl.maxBodySize = DefaultMaxBodySize
+	return cl
+}
+
+// NewRequest creates a new request with the method, the URL and the body.
+func NewRequest(method, rawurl string, body []byte) (*ClientRequest, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	return &ClientRequest{
+		Method: method,
+		URL:    u,
+		Header: make(textproto.MIMEHeader),
+		Body:   body,
+	}, nil
+}
+
+// SetResolver sets the resolver of the host names.
+// By default a resolver is created on the first request to a host name.
+func (cl *Client) SetResolver(r *event.Resolver) {
+	cl.resolver = r
+}
+
+// SetMaxIdleConnsPerHost sets the maximum number of idle connections kept for a host.
+func (cl *Client) SetMaxIdleConnsPerHost(n int) {
+	cl.maxIdlePerHost = n
+}
+
+// SetMaxHeaderSize sets the maximum size of the header of a response.
+func (cl *Client) SetMaxHeaderSize(size int) {
+	cl.maxHeaderSize = size
+}
+
+// SetMaxBodySize sets the maximum size of the body of a response.
+func (cl *Client) SetMaxBodySize(size int64) {
+	cl.maxBodySize = size
+}
+
+// SetTimeouts sets the timeouts of the client.
+// Dial is the timeout to connect, request is the timeout of the whole request
+// and idle is the timeout of the idle connections in the pool.
+// Zero means no timeout.
+func (cl *Client) SetTimeouts(dial, request, idle time.Duration) {
+	cl.dialTimeout = dial
+	cl.requestTimeout = request
+	cl.idleTimeout = idle
+}
+
+// Do sends the request and calls the callback function in the event loop with the response or the error.
+// The request is retried once on a new connection if an idle connection is reset before any
+// response bytes are received and the method is idempotent.
+func (cl *Client) Do(req *ClientRequest, callback func(resp *Response, err error, arg interface{}), arg interface{}) error {
+	if cl.closed {
+		return ErrClientClosed
+	}
+	if req.URL.Scheme != "http" {
+		return ErrUnsupportedScheme
+	}
+	key := req.URL.Host
+	if req.URL.Port() == "" {
+		key = net.JoinHostPort(req.URL.Hostname(), "80")
+	}
+	call := &clientCall{cl: cl, req: req, key: key, cb: callback, arg: arg}
+	if cl.requestTimeout > 0 {
+		call.timer = event.NewTimer(cl.base, call.onTimeout, nil)
+		if err := call.timer.Attach(cl.requestTimeout); err != nil {
+			return err
+		}
+	}
+	cl.calls[call] = struct{}{}
+	if err := cl.start(call, false); err != nil {
+		call.done = true
+		delete(cl.calls, call)
+		if call.timer != nil {
+			call.timer.Detach()
+		}
+		return err
+	}
+	return nil
+}
+
+// Close closes all the connections.
+// The pending requests, including those still resolving or connecting, are failed with ErrClientClosed.
+// The requests done afterwards fail with ErrClientClosed.
+func (cl *Client) Close() error {
+	if cl.closed {
+		return ErrClientClosed
+	}
+	cl.closed = true
+	for cc := range cl.conns {
+		cc.fail(ErrClientClosed)
+	}
+	for call := range cl.calls {
+		call.finish(nil, ErrClientClosed)
+	}
+	return nil
+}
+
+func (cl *Client) start(call *clientCall, fresh bool) error {
+	if cl.closed {
+		return ErrClientClosed
+	}
+	if !fresh {
+		if cc := cl.popIdle(call.key); cc != nil {
+			cc.send(call)
+			return nil
+		}
+	}
+	host, port, err := net.SplitHostPort(call.key)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return cl.dial(call, ip, port)
+	}
+	if cl.resolver == nil {
+		if cl.resolver, err = event.NewResolver(cl.base); err != nil {
+			return err
+		}
+	}
+	return cl.resolver.LookupHost(host, func(addrs []net.IP, err error, arg interface{}) {
+		if call.done {
+			return
+		}
+		if err == nil {
+			err = cl.dial(call, addrs[0], port)
+		}
+		if err != nil {
+			call.finish(nil, err)
+		}
+	}, nil)
+}
+
+func (cl *Client) dial(call *clientCall, ip net.IP, port string) error {
+	return event.Connect(cl.base, "tcp", net.JoinHostPort(ip.String(), port), cl.dialTimeout, func(fd int, err error, arg interface{}) {
+		if call.done || cl.closed {
+			if fd >= 0 {
+				syscall.Close(fd)
+			}
+			call.finish(nil, ErrClientClosed)
+			return
+		}
+		if err != nil {
+			call.finish(nil, err)
+			return
+		}
+		cc, err := cl.newConn(call.key, fd)
+		if err != nil {
+			syscall.Close(fd)
+			call.finish(nil, err)
+			return
+		}
+		cc.send(call)
+	}, nil)
+}
+
+func (cl *Client) newConn(key string, fd int) (*clientConn, error) {
+	cc := new(clientConn)
+	cc.cl = cl
+	cc.key = key
+	cc.fd = fd
+	cc.rev = event.New(cl.base, fd, event.EvRead|event.EvPersist, cc.onRead, nil)
+	cc.wev = event.New(cl.base, fd, event.EvWrite|event.EvPersist, cc.onWrite, nil)
+	cc.timer = event.NewTimer(cl.base, cc.onIdleTimeout, nil)
+	if err := cc.rev.Attach(0); err != nil {
+		return nil, err
+	}
+	cl.conns[cc] = struct{}{}
+	return cc, nil
+}
+
+func (cl *Client) popIdle(key string) *clientConn {
+	conns := cl.idle[key]
+	if len(conns) == 0 {
+		return nil
+	}
+	cc := conns[len(conns)-1]
+	cl.idle[key] = conns[:len(conns)-1]
+	cc.timer.Detach()
+	return cc
+}
+
+func (cl *Client) putIdle(cc *clientConn) {
+	if len(cl.idle[cc.key]) >= cl.maxIdlePerHost {
+		cc.close()
+		return
+	}
+	cc.state = clientIdle
+	cc.reused = true
+	cl.idle[cc.key] = append(cl.idle[cc.key], cc)
+	if cl.idleTimeout > 0 {
+		cc.timer.Attach(cl.idleTimeout)
+	}
+}
+
+func (cl *Client) removeIdle(cc *clientConn) {
+	conns := cl.idle[cc.key]
+	for i := range conns {
+		if conns[i] == cc {
+			cl.idle[cc.key] = append(conns[:i], conns[i+1:]...)
+			break
+		}
+	}
+	if len(cl.idle[cc.key]) == 0 {
+		delete(cl.idle, cc.key)
+	}
+}
+
+func (call *clientCall) onTimeout(fd int, events uint32, arg interface{}) {
+	if call.cc != nil {
+		call.cc.call = nil
+		call.cc.close()
+	}
+	call.finish(nil, ErrRequestTimeout)
+}
+
+func (call *clientCall) finish(resp *Response, err error) {
+	if call.done {
+		return
+	}
+	call.done = true
+	call.cc = nil
+	delete(call.cl.calls, call)
+	if call.timer != nil {
+		call.timer.Detach()
+	}
+	call.cb(resp, err, call.arg)
+}
+
+func (call *clientCall) idempotent() bool {
+	switch call.req.Method {
+	case "GET", "HEAD", "OPTIONS", "TRACE", "PUT", "DELETE":
+		return true
+	}
+	return false
+}
+
+func (cc *clientConn) send(call *clientCall) {
+	req := call.req
+	cc.call = call
+	cc.state = clientBusy
+	cc.received = false
+	call.cc = cc
+	header := make(textproto.MIMEHeader, len(req.Header)+2)
+	for key, values := range req.Header {
+		header[key] = values
+	}
+	if header.Get("Host") == "" {
+		header.Set("Host", req.URL.Host)
+	}
+	if len(req.Body) > 0 || req.Method == "POST" || req.Method == "PUT" {
+		header.Set("Content-Length", strconv.Itoa(len(req.Body)))
+	}
+	writeHead(&cc.out, req.Method+" "+req.URL.RequestURI()+" HTTP/1.1", header)
+	cc.out.Write(req.Body)
+	cc.flush()
+}
+
+func (cc *clientConn) onRead(fd int, events uint32, arg interface{}) {
+	n, err := cc.in.ReadFd(fd)
+	if err == syscall.EAGAIN {
+		return
+	}
+	if cc.state == clientIdle {
+		cc.close()
+		return
+	}
+	if n > 0 {
+		cc.received = true
+	}
+	if err == io.EOF && cc.body != nil && cc.body.state == bodyUntilClose {
+		cc.complete()
+		return
+	}
+	if err != nil {
+		cc.fail(err)
+		return
+	}
+	cc.process()
+}
+
+func (cc *clientConn) onWrite(fd int, events uint32, arg interface{}) {
+	cc.flush()
+}
+
+func (cc *clientConn) onIdleTimeout(fd int, events uint32, arg interface{}) {
+	cc.close()
+}
+
+func (cc *clientConn) flush() {
+	_, err := cc.out.WriteFd(cc.fd)
+	if err == syscall.EAGAIN {
+		cc.wev.Attach(0)
+		return
+	}
+	cc.wev.Detach()
+	if err != nil {
+		cc.fail(err)
+	}
+}
+
+// process parses the response in the input buffer.
+func (cc *clientConn) process() {
+	for cc.state == clientBusy {
+		if cc.body == nil {
+			line, header, ok, err := readHead(&cc.in, cc.cl.maxHeaderSize)
+			if err != nil {
+				cc.fail(err)
+				return
+			}
+			if !ok {
+				return
+			}
+			resp, err := parseStatusLine(line)
+			if err != nil {
+				cc.fail(err)
+				return
+			}
+			if resp.StatusCode >= 100 && resp.StatusCode < 200 {
+				continue
+			}
+			resp.Header = header
+			cc.resp = resp
+			cc.body = new(bodyReader)
+			if cc.call.req.Method == "HEAD" || !bodyAllowed(resp.StatusCode) {
+				cc.body.state = bodyDone
+			} else {
+				closeAfter, err := cc.body.reset(header, true, cc.cl.maxBodySize)
+				if err != nil {
+					cc.fail(err)
+					return
+				}
+				cc.closeAfter = closeAfter
+			}
+			cc.closeAfter = cc.closeAfter || wantsClose(resp.Proto, header)
+		}
+		done, err := cc.body.read(&cc.in, func(p []byte) {
+			if onBody := cc.call.req.OnBody; onBody != nil {
+				onBody(cc.resp, p)
+			} else {
+				cc.resp.Body = append(cc.resp.Body, p...)
+			}
+		})
+		if err != nil {
+			cc.fail(err)
+			return
+		}
+		if !done {
+			return
+		}
+		cc.complete()
+	}
+}
+
+// complete finishes the call and puts the connection back to the pool.
+func (cc *clientConn) complete() {
+	call, resp := cc.call, cc.resp
+	cc.call = nil
+	cc.resp = nil
+	cc.body = nil
+	if cc.closeAfter || cc.in.Len() > 0 {
+		cc.close()
+	} else {
+		cc.cl.putIdle(cc)
+	}
+	cc.closeAfter = false
+	call.finish(resp, nil)
+}
+
+// fail closes the connection and fails or retries the call.
+func (cc *clientConn) fail(err error) {
+	call := cc.call
+	reused, received := cc.reused, cc.received
+	cc.call = nil
+	cc.close()
+	if call == nil || call.done {
+		return
+	}
+	if reused && !received && !call.retried && call.idempotent() && err != ErrClientClosed {
+		call.retried = true
+		call.cc = nil
+		if err := call.cl.start(call, true); err == nil {
+			return
+		}
+	}
+	if err == errHeaderTooLarge || err == errBodyTooLarge || err == errMalformed || err == errUnsupportedCode {
+		err = ErrMalformedResponse
+	}
+	call.finish(nil, err)
+}
+
+func (cc *clientConn) close() {
+	if cc.state == clientClosed {
+		return
+	}
+	if cc.state == clientIdle {
+		cc.cl.removeIdle(cc)
+	}
+	cc.state = clientClosed
+	cc.rev.Detach()
+	cc.wev.Detach()
+	cc.timer.Detach()
+	syscall.Close(cc.fd)
+	delete(cc.cl.conns, cc)
+}
+
+func parseStatusLine(line string) (*Response, error) {
+	parts := strings.SplitN(line, " ", 3)
+	if len(parts) < 2 || !strings.HasPrefix(parts[0], "HTTP/1.") {
+		return nil, errMalformed
+	}
+	code, err := strconv.Atoi(parts[1])
+	if err != nil || code < 100 || code > 999 {
+		return nil, errMalformed
+	}
+	resp := &Response{Proto: parts[0], StatusCode: code}
+	if len(parts) == 3 {
+		resp.Status = parts[2]
+	}
+	return resp, nil
+}
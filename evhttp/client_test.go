@@ -0,0 +1,316 @@
+// Copyright (c) 2023 cheng-zhongliang. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package evhttp_test
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/cheng-zhongliang/event"
+	. "github.com/cheng-zhongliang/event/evhttp"
+)
+
+func TestClient(t *testing.T) {
+	base, err := event.NewBase()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ports := map[int]bool{}
+	s := NewServer(base, func(req *Request) {
+		ports[req.RemoteAddr.(*syscall.SockaddrInet4).Port] = true
+		req.ResponseHeader.Set("X-Method", req.Method)
+		req.Reply(StatusOK, append([]byte(req.URL.Path), req.Body...))
+	})
+	ln, err := s.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sa, err := ln.Addr()
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := "127.0.0.1:" + strconv.Itoa(sa.(*syscall.SockaddrInet4).Port)
+
+	cl := NewClient(base)
+	cl.SetTimeouts(time.Second, time.Second, time.Second)
+
+	done := make(chan struct{})
+	var bodies []string
+	var do func(method, body string)
+	do = func(method, body string) {
+		req, err := NewRequest(method, "http://"+addr+"/"+method, []byte(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = cl.Do(req, func(resp *Response, err error, arg interface{}) {
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != StatusOK || resp.Header.Get("X-Method") != method {
+				t.Fatalf("response %d %q not equal", resp.StatusCode, resp.Header.Get("X-Method"))
+			}
+			bodies = append(bodies, string(resp.Body))
+			if len(bodies) == 1 {
+				do("POST", "hello")
+			} else {
+				close(done)
+			}
+		}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	do("GET", "")
+	runUntil(t, base, done)
+
+	if len(bodies) != 2 || bodies[0] != "/GET" || bodies[1] != "/POSThello" {
+		t.Fatalf("bodies %q not equal", bodies)
+	}
+	if len(ports) != 1 {
+		t.Fatal("connection not reused")
+	}
+
+	cl.Close()
+	s.Close()
+	if err := base.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClientRetry(t *testing.T) {
+	base, err := event.NewBase()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for i := 0; i < 2; i++ {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			r := bufio.NewReader(conn)
+			if _, err := http.ReadRequest(r); err != nil {
+				conn.Close()
+				return
+			}
+			io.WriteString(conn, "HTTP/1.1 200 OK\r\nContent-Length: "+strconv.Itoa(i+1)+"\r\n\r\n"+"ab"[:i+1])
+			if i == 0 {
+				http.ReadRequest(r)
+			}
+			conn.Close()
+		}
+	}()
+
+	cl := NewClient(base)
+
+	done := make(chan struct{})
+	var bodies []string
+	var get func()
+	get = func() {
+		req, err := NewRequest("GET", "http://"+ln.Addr().String()+"/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = cl.Do(req, func(resp *Response, err error, arg interface{}) {
+			if err != nil {
+				t.Fatal(err)
+			}
+			bodies = append(bodies, string(resp.Body))
+			if len(bodies) == 1 {
+				get()
+			} else {
+				close(done)
+			}
+		}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	get()
+	runUntil(t, base, done)
+
+	if len(bodies) != 2 || bodies[0] != "a" || bodies[1] != "ab" {
+		t.Fatalf("bodies %q not equal", bodies)
+	}
+
+	cl.Close()
+	if err := base.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClientTimeout(t *testing.T) {
+	base, err := event.NewBase()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	cl := NewClient(base)
+	cl.SetTimeouts(0, 20*time.Millisecond, 0)
+
+	done := make(chan struct{})
+	req, err := NewRequest("GET", "http://"+ln.Addr().String()+"/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cl.Do(req, func(resp *Response, err error, arg interface{}) {
+		if err != ErrRequestTimeout {
+			t.Fatal(err)
+		}
+		close(done)
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runUntil(t, base, done)
+
+	if err := base.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClientClose(t *testing.T) {
+	base, err := event.NewBase()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	// the request is still connecting when the client is closed.
+	cl := NewClient(base)
+	req, err := NewRequest("GET", "http://"+ln.Addr().String()+"/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	calls := 0
+	err = cl.Do(req, func(resp *Response, err error, arg interface{}) {
+		calls++
+		if err != ErrClientClosed {
+			t.Errorf("error %v, want %v", err, ErrClientClosed)
+		}
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cl.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 1 {
+		t.Fatalf("callback called %d times, want 1", calls)
+	}
+	if err := cl.Do(req, func(resp *Response, err error, arg interface{}) {}, nil); err != ErrClientClosed {
+		t.Fatalf("error %v, want %v", err, ErrClientClosed)
+	}
+
+	// the connection completed after the close is closed without sending the request.
+	for i := 0; i < 10; i++ {
+		if err := base.Loop(event.EvLoopOnce | event.EvLoopNoblock); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if calls != 1 {
+		t.Fatalf("callback called %d times, want 1", calls)
+	}
+	c, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.SetReadDeadline(time.Now().Add(time.Second))
+	if n, err := c.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("read %d %v, want EOF", n, err)
+	}
+
+	if err := base.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClientStreaming(t *testing.T) {
+	base, err := event.NewBase()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewServer(base, func(req *Request) {
+		req.ReplyStart(StatusOK)
+		req.ReplyChunk([]byte("hello"))
+		event.NewTimer(base, func(fd int, events uint32, arg interface{}) {
+			req.ReplyChunk([]byte(" world"))
+			req.ReplyEnd()
+		}, nil).Attach(10 * time.Millisecond)
+	})
+	ln, err := s.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sa, err := ln.Addr()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cl := NewClient(base)
+
+	done := make(chan struct{})
+	var pieces []string
+	req, err := NewRequest("GET", "http://127.0.0.1:"+strconv.Itoa(sa.(*syscall.SockaddrInet4).Port)+"/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.OnBody = func(resp *Response, p []byte) {
+		if resp.StatusCode != StatusOK {
+			t.Fatal("status not equal")
+		}
+		pieces = append(pieces, string(p))
+	}
+	err = cl.Do(req, func(resp *Response, err error, arg interface{}) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(resp.Body) != 0 {
+			t.Fatal("body not streamed")
+		}
+		close(done)
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runUntil(t, base, done)
+
+	if len(pieces) != 2 || pieces[0] != "hello" || pieces[1] != " world" {
+		t.Fatalf("pieces %q not equal", pieces)
+	}
+
+	cl.Close()
+	s.Close()
+	if err := base.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+}
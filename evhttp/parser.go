@@ -0,0 +1,254 @@
+// Copyright (c) 2023 cheng-zhongliang. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package evhttp
+
+import (
+	"bytes"
+	"errors"
+	"net/textproto"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cheng-zhongliang/event"
+)
+
+const (
+	// bodyLength is the state to read a body with a known length.
+	bodyLength = iota
+	// bodyChunkSize is the state to read the size line of a chunk.
+	bodyChunkSize
+	// bodyChunkData is the state to read the data of a chunk.
+	bodyChunkData
+	// bodyTrailer is the state to read the trailer after the last chunk.
+	bodyTrailer
+	// bodyUntilClose is the state to read a body delimited by closing the connection.
+	bodyUntilClose
+	// bodyDone is the state when the body is complete.
+	bodyDone
+)
+
+var (
+	crlf     = []byte("\r\n")
+	crlfcrlf = []byte("\r\n\r\n")
+
+	errMalformed       = errors.New("malformed http message")
+	errHeaderTooLarge  = errors.New("http header too large")
+	errBodyTooLarge    = errors.New("http body too large")
+	errUnsupportedCode = errors.New("unsupported transfer encoding")
+)
+
+// readHead reads the start line and the header fields of a message.
+// It returns ok false if more bytes are needed.
+func readHead(in *event.Buffer, maxSize int) (line string, header textproto.MIMEHeader, ok bool, err error) {
+	for in.Len() >= 2 && bytes.HasPrefix(in.Bytes(), crlf) {
+		in.Drain(2)
+	}
+	i := in.Index(crlfcrlf)
+	if i < 0 {
+		if in.Len() > maxSize {
+			return "", nil, false, errHeaderTooLarge
+		}
+		return "", nil, false, nil
+	}
+	if i+4 > maxSize {
+		return "", nil, false, errHeaderTooLarge
+	}
+	lines := strings.Split(string(in.Bytes()[:i]), "\r\n")
+	in.Drain(i + 4)
+	header = make(textproto.MIMEHeader, len(lines)-1)
+	for _, l := range lines[1:] {
+		colon := strings.IndexByte(l, ':')
+		if colon <= 0 || strings.ContainsAny(l[:colon], " \t") {
+			return "", nil, false, errMalformed
+		}
+		header.Add(l[:colon], strings.Trim(l[colon+1:], " \t"))
+	}
+	return lines[0], header, true, nil
+}
+
+// writeHead writes the start line and the header fields of a message.
+// The fields are written in the sorted order of the keys.
+func writeHead(out *event.Buffer, line string, header textproto.MIMEHeader) {
+	out.WriteString(line)
+	out.WriteString("\r\n")
+	keys := make([]string, 0, len(header))
+	for key := range header {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		for _, value := range header[key] {
+			out.WriteString(key)
+			out.WriteString(": ")
+			out.WriteString(value)
+			out.WriteString("\r\n")
+		}
+	}
+	out.WriteString("\r\n")
+}
+
+// bodyReader is the incremental decoder of a message body.
+type bodyReader struct {
+	// state is the decoding state of the body.
+	state int
+	// remaining is the remaining bytes of the body or the chunk.
+	remaining int64
+	// size is the decoded bytes of the body.
+	size int64
+	// maxSize is the maximum size of the body. Zero means no limit.
+	maxSize int64
+}
+
+// reset prepares the reader for the body framed by the header.
+// It returns whether the connection has to be closed after the message.
+func (br *bodyReader) reset(header textproto.MIMEHeader, untilClose bool, maxSize int64) (bool, error) {
+	br.size = 0
+	br.maxSize = maxSize
+	if te := header.Get("Transfer-Encoding"); te != "" {
+		if !strings.EqualFold(te, "chunked") {
+			return false, errUnsupportedCode
+		}
+		br.state = bodyChunkSize
+		return header.Get("Content-Length") != "", nil
+	}
+	if values := header["Content-Length"]; len(values) > 0 {
+		for _, v := range values[1:] {
+			if v != values[0] {
+				return false, errMalformed
+			}
+		}
+		n, err := strconv.ParseInt(values[0], 10, 64)
+		if err != nil || n < 0 {
+			return false, errMalformed
+		}
+		if maxSize > 0 && n > maxSize {
+			return false, errBodyTooLarge
+		}
+		br.state = bodyLength
+		br.remaining = n
+		if n == 0 {
+			br.state = bodyDone
+		}
+		return false, nil
+	}
+	if untilClose {
+		br.state = bodyUntilClose
+		return true, nil
+	}
+	br.state = bodyDone
+	return false, nil
+}
+
+// read decodes the body bytes in the buffer and passes them to fn.
+// It returns done true when the body is complete.
+func (br *bodyReader) read(in *event.Buffer, fn func(p []byte)) (bool, error) {
+	for {
+		switch br.state {
+		case bodyLength, bodyUntilClose:
+			p := in.Bytes()
+			if br.state == bodyLength && int64(len(p)) > br.remaining {
+				p = p[:br.remaining]
+			}
+			if len(p) > 0 {
+				if err := br.grow(len(p)); err != nil {
+					return false, err
+				}
+				fn(p)
+				in.Drain(len(p))
+			}
+			if br.state == bodyUntilClose {
+				return false, nil
+			}
+			br.remaining -= int64(len(p))
+			if br.remaining > 0 {
+				return false, nil
+			}
+			br.state = bodyDone
+		case bodyChunkSize:
+			i := in.Index(crlf)
+			if i < 0 {
+				if in.Len() > 1024 {
+					return false, errMalformed
+				}
+				return false, nil
+			}
+			line := string(in.Bytes()[:i])
+			in.Drain(i + 2)
+			if j := strings.IndexByte(line, ';'); j >= 0 {
+				line = line[:j]
+			}
+			n, err := strconv.ParseInt(strings.TrimSpace(line), 16, 64)
+			if err != nil || n < 0 {
+				return false, errMalformed
+			}
+			if n == 0 {
+				br.state = bodyTrailer
+				continue
+			}
+			if br.maxSize > 0 && br.size+n > br.maxSize {
+				return false, errBodyTooLarge
+			}
+			br.state = bodyChunkData
+			br.remaining = n
+		case bodyChunkData:
+			if br.remaining > 0 {
+				p := in.Bytes()
+				if int64(len(p)) > br.remaining {
+					p = p[:br.remaining]
+				}
+				if len(p) == 0 {
+					return false, nil
+				}
+				if err := br.grow(len(p)); err != nil {
+					return false, err
+				}
+				fn(p)
+				in.Drain(len(p))
+				br.remaining -= int64(len(p))
+				continue
+			}
+			if in.Len() < 2 {
+				return false, nil
+			}
+			if !bytes.HasPrefix(in.Bytes(), crlf) {
+				return false, errMalformed
+			}
+			in.Drain(2)
+			br.state = bodyChunkSize
+		case bodyTrailer:
+			i := in.Index(crlf)
+			if i < 0 {
+				if in.Len() > 1024 {
+					return false, errMalformed
+				}
+				return false, nil
+			}
+			in.Drain(i + 2)
+			if i == 0 {
+				br.state = bodyDone
+			}
+		case bodyDone:
+			return true, nil
+		}
+	}
+}
+
+func (br *bodyReader) grow(n int) error {
+	br.size += int64(n)
+	if br.maxSize > 0 && br.size > br.maxSize {
+		return errBodyTooLarge
+	}
+	return nil
+}
+
+// wantsClose reports whether the message of the protocol version closes the connection.
+func wantsClose(proto string, header textproto.MIMEHeader) bool {
+	conn := strings.ToLower(header.Get("Connection"))
+	if proto == "HTTP/1.0" {
+		return !strings.Contains(conn, "keep-alive")
+	}
+	return strings.Contains(conn, "close")
+}
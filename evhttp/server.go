@@ -0,0 +1,528 @@
+// Copyright (c) 2023 cheng-zhongliang. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package evhttp implements an embedded HTTP/1.1 server and client on the event loop.
+// It works in a similar manner as evhttp of libevent.
+package evhttp
+
+import (
+	"errors"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/cheng-zhongliang/event"
+)
+
+const (
+	// DefaultMaxHeaderSize is the default maximum size of the header of a message.
+	DefaultMaxHeaderSize = 1 << 16
+	// DefaultMaxBodySize is the default maximum size of the body of a message.
+	DefaultMaxBodySize = 1 << 20
+
+	// TimeFormat is the time format of the Date header.
+	TimeFormat = "Mon, 02 Jan 2006 15:04:05 GMT"
+)
+
+const (
+	// connReadHead is the state to read the head of a request.
+	connReadHead = iota
+	// connReadBody is the state to read the body of a request.
+	connReadBody
+	// connHandle is the state to wait for the reply of a request.
+	connHandle
+	// connClosed is the state when the connection is closed.
+	connClosed
+)
+
+var (
+	ErrHijacked = errors.New("http connection hijacked or closed")
+)
+
+// Handler is the callback function for every request.
+// The request must be replied by Reply or ReplyStart, either in the handler
+// or later in the event loop. The next request on the connection is not
+// dispatched until the reply is complete.
+type Handler func(req *Request)
+
+// Server is the HTTP/1.1 server.
+type Server struct {
+	// base is the event base of the server.
+	base *event.EventBase
+	// handler is the callback function for every request.
+	handler Handler
+	// listeners is the listeners of the server.
+	listeners []*event.Listener
+	// conns is the open connections.
+	conns map[*conn]struct{}
+	// maxHeaderSize is the maximum size of the header of a request.
+	maxHeaderSize int
+	// maxBodySize is the maximum size of the body of a request.
+	maxBodySize int64
+	// readTimeout is the timeout to read a request.
+	readTimeout time.Duration
+	// writeTimeout is the timeout to write a response when the connection is not writable.
+	writeTimeout time.Duration
+	// idleTimeout is the timeout to wait for the next request.
+	idleTimeout time.Duration
+}
+
+// Request is the HTTP request received by the server.
+type Request struct {
+	// Method is the method of the request.
+	Method string
+	// URI is the request target of the request line.
+	URI string
+	// URL is the parsed request target.
+	URL *url.URL
+	// Proto is the protocol version, "HTTP/1.0" or "HTTP/1.1".
+	Proto string
+	// Header is the header fields of the request.
+	Header textproto.MIMEHeader
+	// Body is the body of the request.
+	Body []byte
+	// RemoteAddr is the address of the client.
+	RemoteAddr syscall.Sockaddr
+	// ResponseHeader is the header fields of the response.
+	// It must be set before the reply is started.
+	ResponseHeader textproto.MIMEHeader
+
+	// c is the connection of the request.
+	c *conn
+	// chunked reports whether the reply uses chunked transfer encoding.
+	chunked bool
+	// started reports whether the reply is started.
+	started bool
+	// done reports whether the reply is complete.
+	done bool
+}
+
+// conn is the connection of a client.
+type conn struct {
+	// srv is the server of the connection.
+	srv *Server
+	// fd is the socket of the connection.
+	fd int
+	// sa is the address of the client.
+	sa syscall.Sockaddr
+	// rev is the read event of the socket.
+	rev *event.Event
+	// wev is the write event of the socket.
+	wev *event.Event
+	// timer is the timer event of the read, write and idle timeouts.
+	timer *event.Event
+	// in is the bytes read from the socket.
+	in event.Buffer
+	// out is the bytes to write to the socket.
+	out event.Buffer
+	// state is the state of the connection.
+	state int
+	// idle reports whether the connection is waiting for the next request.
+	idle bool
+	// processing reports whether the requests are being parsed.
+	processing bool
+	// closeAfter reports whether the connection is closed after the current request.
+	closeAfter bool
+	// req is the current request.
+	req *Request
+	// body is the body decoder of the current request.
+	body bodyReader
+}
+
+// NewServer creates a new server on the event base.
+func NewServer(base *event.EventBase, handler Handler) *Server {
+	s := new(Server)
+	s.base = base
+	s.handler = handler
+	s.conns = make(map[*conn]struct{})
+	s.maxHeaderSize = DefaultMaxHeaderSize
+	s.maxBodySize = DefaultMaxBodySize
+	return s
+}
+
+// SetMaxHeaderSize sets the maximum size of the header of a request.
+// The request with a larger header is replied with 431.
+func (s *Server) SetMaxHeaderSize(size int) {
+	s.maxHeaderSize = size
+}
+
+// SetMaxBodySize sets the maximum size of the body of a request.
+// The request with a larger body is replied with 413.
+func (s *Server) SetMaxBodySize(size int64) {
+	s.maxBodySize = size
+}
+
+// SetTimeouts sets the timeouts of the connections.
+// Read is the timeout to read a request, write is the timeout to write a response
+// when the connection is not writable and idle is the timeout to wait for the next request.
+// Zero means no timeout.
+func (s *Server) SetTimeouts(read, write, idle time.Duration) {
+	s.readTimeout = read
+	s.writeTimeout = write
+	s.idleTimeout = idle
+}
+
+// Base returns the event base of the server.
+func (s *Server) Base() *event.EventBase {
+	return s.base
+}
+
+// Listen accepts connections on the network address.
+func (s *Server) Listen(network, address string) (*event.Listener, error) {
+	ln, err := event.NewListener(s.base, network, address, s.onAccept, nil)
+	if err != nil {
+		return nil, err
+	}
+	s.listeners = append(s.listeners, ln)
+	return ln, nil
+}
+
+// ServeConn serves the connected non-blocking socket.
+// The fd is owned by the server after ServeConn returns nil.
+func (s *Server) ServeConn(fd int, sa syscall.Sockaddr) error {
+	c := new(conn)
+	c.srv = s
+	c.fd = fd
+	c.sa = sa
+	c.rev = event.New(s.base, fd, event.EvRead|event.EvPersist, c.onRead, nil)
+	c.wev = event.New(s.base, fd, event.EvWrite|event.EvPersist, c.onWrite, nil)
+	c.timer = event.NewTimer(s.base, c.onTimeout, nil)
+	if err := c.rev.Attach(0); err != nil {
+		return err
+	}
+	c.arm(s.readTimeout)
+	s.conns[c] = struct{}{}
+	return nil
+}
+
+// Close closes the listeners and all the connections.
+func (s *Server) Close() error {
+	for _, ln := range s.listeners {
+		ln.Close()
+	}
+	s.listeners = nil
+	for c := range s.conns {
+		c.close()
+	}
+	return nil
+}
+
+func (s *Server) onAccept(fd int, sa syscall.Sockaddr, arg interface{}) {
+	if err := s.ServeConn(fd, sa); err != nil {
+		syscall.Close(fd)
+	}
+}
+
+// Reply replies the request with the status code and the body.
+// The Content-Length header is set by the length of the body.
+func (req *Request) Reply(code int, body []byte) {
+	if req.started || req.c.state == connClosed {
+		return
+	}
+	header := req.ResponseHeader
+	if bodyAllowed(code) {
+		header.Set("Content-Length", strconv.Itoa(len(body)))
+	}
+	req.writeHead(code)
+	if req.Method != "HEAD" && bodyAllowed(code) {
+		req.c.out.Write(body)
+	}
+	req.done = true
+	req.c.flush()
+}
+
+// Base returns the event base of the server which received the request.
+func (req *Request) Base() *event.EventBase {
+	return req.c.srv.base
+}
+
+// Hijack takes over the connection of the request from the server.
+// It returns the non-blocking socket and the bytes received after the request.
+// The server neither replies the request nor uses the socket after Hijack.
+func (req *Request) Hijack() (int, []byte, error) {
+	c := req.c
+	if req.started || c.state != connHandle || c.req != req {
+		return -1, nil, ErrHijacked
+	}
+	c.state = connClosed
+	c.rev.Detach()
+	c.wev.Detach()
+	c.timer.Detach()
+	delete(c.srv.conns, c)
+	return c.fd, append([]byte(nil), c.in.Bytes()...), nil
+}
+
+// ReplyStart starts a streaming reply with the status code.
+// The body is sent by ReplyChunk and completed by ReplyEnd.
+// It uses chunked transfer encoding for HTTP/1.1, otherwise the connection is closed after the body.
+func (req *Request) ReplyStart(code int) {
+	if req.started || req.c.state == connClosed {
+		return
+	}
+	header := req.ResponseHeader
+	header.Del("Content-Length")
+	if bodyAllowed(code) {
+		if req.Proto == "HTTP/1.1" {
+			header.Set("Transfer-Encoding", "chunked")
+			req.chunked = true
+		} else {
+			req.c.closeAfter = true
+		}
+	}
+	req.writeHead(code)
+	req.c.flush()
+}
+
+// ReplyChunk sends the chunk of a streaming reply.
+func (req *Request) ReplyChunk(data []byte) {
+	if !req.started || req.done || req.c.state == connClosed || len(data) == 0 || req.Method == "HEAD" {
+		return
+	}
+	if req.chunked {
+		req.c.out.WriteString(strconv.FormatInt(int64(len(data)), 16))
+		req.c.out.WriteString("\r\n")
+		req.c.out.Write(data)
+		req.c.out.WriteString("\r\n")
+	} else {
+		req.c.out.Write(data)
+	}
+	req.c.flush()
+}
+
+// ReplyEnd completes a streaming reply.
+func (req *Request) ReplyEnd() {
+	if !req.started || req.done || req.c.state == connClosed {
+		return
+	}
+	if req.chunked && req.Method != "HEAD" {
+		req.c.out.WriteString("0\r\n\r\n")
+	}
+	req.done = true
+	req.c.flush()
+}
+
+func (req *Request) writeHead(code int) {
+	c := req.c
+	header := req.ResponseHeader
+	header.Set("Date", c.srv.base.Now().UTC().Format(TimeFormat))
+	if c.closeAfter {
+		header.Set("Connection", "close")
+	} else if req.Proto == "HTTP/1.0" {
+		header.Set("Connection", "keep-alive")
+	}
+	req.started = true
+	writeHead(&c.out, "HTTP/1.1 "+strconv.Itoa(code)+" "+StatusText(code), header)
+}
+
+func (c *conn) onRead(fd int, events uint32, arg interface{}) {
+	_, err := c.in.ReadFd(fd)
+	if err == syscall.EAGAIN {
+		return
+	}
+	if err != nil {
+		c.close()
+		return
+	}
+	if c.idle {
+		c.idle = false
+		c.arm(c.srv.readTimeout)
+	}
+	c.process()
+}
+
+func (c *conn) onWrite(fd int, events uint32, arg interface{}) {
+	c.flush()
+}
+
+func (c *conn) onTimeout(fd int, events uint32, arg interface{}) {
+	if c.state == connHandle || c.idle {
+		c.close()
+		return
+	}
+	c.fail(StatusRequestTimeout)
+}
+
+// process parses and dispatches the requests in the input buffer.
+func (c *conn) process() {
+	if c.processing {
+		return
+	}
+	c.processing = true
+	defer func() { c.processing = false }()
+	for c.state == connReadHead || c.state == connReadBody {
+		if c.state == connReadHead {
+			line, header, ok, err := readHead(&c.in, c.srv.maxHeaderSize)
+			if err != nil {
+				c.fail(errorStatus(err))
+				return
+			}
+			if !ok {
+				return
+			}
+			if code := c.newRequest(line, header); code != 0 {
+				c.fail(code)
+				return
+			}
+			closeAfter, err := c.body.reset(header, false, c.srv.maxBodySize)
+			if err != nil {
+				c.fail(errorStatus(err))
+				return
+			}
+			c.closeAfter = closeAfter || wantsClose(c.req.Proto, header)
+			c.state = connReadBody
+			if c.body.state != bodyDone && strings.EqualFold(header.Get("Expect"), "100-continue") {
+				c.out.WriteString("HTTP/1.1 100 Continue\r\n\r\n")
+				c.flush()
+			}
+		}
+		done, err := c.body.read(&c.in, func(p []byte) {
+			c.req.Body = append(c.req.Body, p...)
+		})
+		if err != nil {
+			c.fail(errorStatus(err))
+			return
+		}
+		if !done {
+			return
+		}
+		c.state = connHandle
+		c.rev.Detach()
+		c.timer.Detach()
+		c.srv.handler(c.req)
+	}
+}
+
+// newRequest parses the request line and returns the status code of the error or 0.
+func (c *conn) newRequest(line string, header textproto.MIMEHeader) int {
+	parts := strings.Split(line, " ")
+	if len(parts) != 3 || parts[0] == "" {
+		return StatusBadRequest
+	}
+	if parts[2] != "HTTP/1.1" && parts[2] != "HTTP/1.0" {
+		if strings.HasPrefix(parts[2], "HTTP/") {
+			return StatusHTTPVersionNotSupported
+		}
+		return StatusBadRequest
+	}
+	u, err := url.ParseRequestURI(parts[1])
+	if err != nil {
+		return StatusBadRequest
+	}
+	c.req = &Request{
+		Method:         parts[0],
+		URI:            parts[1],
+		URL:            u,
+		Proto:          parts[2],
+		Header:         header,
+		RemoteAddr:     c.sa,
+		ResponseHeader: make(textproto.MIMEHeader),
+		c:              c,
+	}
+	return 0
+}
+
+// fail replies the error status and closes the connection.
+func (c *conn) fail(code int) {
+	c.rev.Detach()
+	c.timer.Detach()
+	c.closeAfter = true
+	c.state = connHandle
+	c.req = &Request{
+		Proto:          "HTTP/1.1",
+		ResponseHeader: make(textproto.MIMEHeader),
+		c:              c,
+	}
+	c.req.ResponseHeader.Set("Content-Type", "text/plain; charset=utf-8")
+	c.req.Reply(code, []byte(StatusText(code)))
+}
+
+// flush writes the output buffer and completes the request when the reply is done.
+func (c *conn) flush() {
+	if c.state == connClosed {
+		return
+	}
+	_, err := c.out.WriteFd(c.fd)
+	if err == syscall.EAGAIN {
+		if c.wev.Attach(0) == nil {
+			c.arm(c.srv.writeTimeout)
+		}
+		return
+	}
+	if err != nil {
+		c.close()
+		return
+	}
+	if c.wev.Detach() == nil {
+		c.rearm()
+	}
+	if c.state == connHandle && c.req.done {
+		c.finish()
+	}
+}
+
+// finish completes the current request and reads the next one.
+func (c *conn) finish() {
+	if c.closeAfter {
+		c.close()
+		return
+	}
+	c.req = nil
+	c.state = connReadHead
+	c.rev.Attach(0)
+	if c.in.Len() > 0 {
+		c.arm(c.srv.readTimeout)
+	} else {
+		c.idle = true
+		c.arm(c.srv.idleTimeout)
+	}
+	c.process()
+}
+
+// arm restarts the timer with the timeout. Zero means no timeout.
+func (c *conn) arm(timeout time.Duration) {
+	c.timer.Detach()
+	if timeout > 0 {
+		c.timer.Attach(timeout)
+	}
+}
+
+// rearm restores the read or idle timeout replaced by the write timeout of a pending write.
+// The handler of a request is not timed.
+func (c *conn) rearm() {
+	switch {
+	case c.state == connHandle:
+		c.timer.Detach()
+	case c.idle:
+		c.arm(c.srv.idleTimeout)
+	default:
+		c.arm(c.srv.readTimeout)
+	}
+}
+
+func (c *conn) close() {
+	if c.state == connClosed {
+		return
+	}
+	c.state = connClosed
+	c.rev.Detach()
+	c.wev.Detach()
+	c.timer.Detach()
+	syscall.Close(c.fd)
+	delete(c.srv.conns, c)
+}
+
+func errorStatus(err error) int {
+	switch err {
+	case errHeaderTooLarge:
+		return StatusRequestHeaderFieldsTooLarge
+	case errBodyTooLarge:
+		return StatusRequestEntityTooLarge
+	case errUnsupportedCode:
+		return StatusNotImplemented
+	}
+	return StatusBadRequest
+}
@@ -0,0 +1,300 @@
+// Copyright (c) 2023 cheng-zhongliang. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package evhttp_test
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/cheng-zhongliang/event"
+	. "github.com/cheng-zhongliang/event/evhttp"
+)
+
+// runUntil runs the event loop until the done channel is closed.
+func runUntil(t *testing.T, base *event.EventBase, done chan struct{}) {
+	stopped := int32(0)
+	go func() {
+		<-done
+		atomic.StoreInt32(&stopped, 1)
+	}()
+	ticker := event.NewTicker(base, func(fd int, events uint32, arg interface{}) {}, nil)
+	if err := ticker.Attach(5 * time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); atomic.LoadInt32(&stopped) == 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("test timed out")
+		}
+		if err := base.Loop(event.EvLoopOnce); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ticker.Detach()
+}
+
+// serve runs the server with the handler until the client function returns.
+func serve(t *testing.T, handler Handler, setup func(s *Server), client func(addr string)) {
+	base, err := event.NewBase()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewServer(base, handler)
+	if setup != nil {
+		setup(s)
+	}
+	ln, err := s.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sa, err := ln.Addr()
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := "127.0.0.1:" + strconv.Itoa(sa.(*syscall.SockaddrInet4).Port)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		client(addr)
+	}()
+	runUntil(t, base, done)
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := base.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestServerPipelining(t *testing.T) {
+	serve(t, func(req *Request) {
+		req.ResponseHeader.Set("Content-Type", "text/plain")
+		req.Reply(StatusOK, []byte(req.URL.Path))
+	}, nil, func(addr string) {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+
+		io.WriteString(conn, "GET /a HTTP/1.1\r\nHost: x\r\n\r\nGET /b HTTP/1.1\r\nHost: x\r\nConnection: close\r\n\r\n")
+
+		r := bufio.NewReader(conn)
+		for _, path := range []string{"/a", "/b"} {
+			resp, err := http.ReadResponse(r, nil)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			body, _ := ioutil.ReadAll(resp.Body)
+			if resp.StatusCode != StatusOK || string(body) != path {
+				t.Errorf("response %d %q, want 200 %q", resp.StatusCode, body, path)
+			}
+		}
+		if _, err := r.ReadByte(); err != io.EOF {
+			t.Error("connection not closed")
+		}
+	})
+}
+
+func TestServerAsyncReply(t *testing.T) {
+	var base *event.EventBase
+	serve(t, func(req *Request) {
+		timer := event.NewTimer(base, func(fd int, events uint32, arg interface{}) {
+			req.Reply(StatusCreated, req.Body)
+		}, nil)
+		timer.Attach(10 * time.Millisecond)
+	}, func(s *Server) {
+		base = s.Base()
+	}, func(addr string) {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+
+		io.WriteString(conn, "POST /echo HTTP/1.1\r\nHost: x\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhello\r\n6;ext=1\r\n world\r\n0\r\n\r\n")
+
+		resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		if resp.StatusCode != StatusCreated || string(body) != "hello world" || resp.ContentLength != 11 {
+			t.Errorf("response %d %q, want 201 %q", resp.StatusCode, body, "hello world")
+		}
+	})
+}
+
+func TestServerStreamingReply(t *testing.T) {
+	serve(t, func(req *Request) {
+		req.ReplyStart(StatusOK)
+		req.ReplyChunk([]byte("hello"))
+		req.ReplyChunk([]byte(" world"))
+		req.ReplyEnd()
+	}, nil, func(addr string) {
+		resp, err := http.Get("http://" + addr + "/")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		if len(resp.TransferEncoding) != 1 || string(body) != "hello world" {
+			t.Errorf("response %v %q, want chunked %q", resp.TransferEncoding, body, "hello world")
+		}
+	})
+}
+
+func TestServerLimits(t *testing.T) {
+	serve(t, func(req *Request) {
+		req.Reply(StatusOK, nil)
+	}, func(s *Server) {
+		s.SetMaxHeaderSize(128)
+		s.SetMaxBodySize(4)
+	}, func(addr string) {
+		for _, c := range []struct {
+			req  string
+			code int
+		}{
+			{"POST / HTTP/1.1\r\nContent-Length: 5\r\n\r\nhello", StatusRequestEntityTooLarge},
+			{"POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhello\r\n0\r\n\r\n", StatusRequestEntityTooLarge},
+			{"GET / HTTP/1.1\r\nX: " + strings.Repeat("x", 128) + "\r\n\r\n", StatusRequestHeaderFieldsTooLarge},
+			{"GET / HTTP/2.0\r\n\r\n", StatusHTTPVersionNotSupported},
+			{"GET /\r\n\r\n", StatusBadRequest},
+		} {
+			conn, err := net.Dial("tcp", addr)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			io.WriteString(conn, c.req)
+			resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+			conn.Close()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if resp.StatusCode != c.code || !resp.Close {
+				t.Errorf("response %d close %v, want %d close true", resp.StatusCode, resp.Close, c.code)
+			}
+		}
+	})
+}
+
+func TestServerReadTimeout(t *testing.T) {
+	serve(t, func(req *Request) {
+		req.Reply(StatusOK, nil)
+	}, func(s *Server) {
+		s.SetTimeouts(20*time.Millisecond, 0, 0)
+	}, func(addr string) {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+
+		io.WriteString(conn, "GET / HTTP/1.1\r\n")
+
+		resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if resp.StatusCode != StatusRequestTimeout {
+			t.Errorf("response %d, want 408", resp.StatusCode)
+		}
+	})
+}
+
+func TestServerReadTimeoutAfterContinue(t *testing.T) {
+	base, err := event.NewBase()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(base, func(req *Request) {
+		req.Reply(StatusOK, nil)
+	})
+	s.SetTimeouts(20*time.Millisecond, time.Minute, 0)
+
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer syscall.Close(fds[1])
+	for _, fd := range fds {
+		if err := syscall.SetNonblock(fd, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// fill the socket so the 100 Continue waits for the socket to be writable.
+	filled, junk := 0, make([]byte, 0x1000)
+	for {
+		n, err := syscall.Write(fds[0], junk)
+		if err != nil {
+			break
+		}
+		filled += n
+	}
+	if err := s.ServeConn(fds[0], nil); err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(fdWriter(fds[1]), "POST / HTTP/1.1\r\nContent-Length: 10\r\nExpect: 100-continue\r\n\r\n")
+
+	var resp []byte
+	buf := make([]byte, 0x1000)
+	for deadline := time.Now().Add(time.Second); !strings.Contains(string(resp), "408"); {
+		if time.Now().After(deadline) {
+			t.Fatalf("no read timeout after the 100 Continue is written: %q", resp)
+		}
+		if err := base.Loop(event.EvLoopOnce | event.EvLoopNoblock); err != nil {
+			t.Fatal(err)
+		}
+		if n, err := syscall.Read(fds[1], buf); err == nil {
+			if skip := filled; skip > 0 {
+				if skip > n {
+					skip = n
+				}
+				filled -= skip
+				n -= skip
+				copy(buf, buf[skip:skip+n])
+			}
+			resp = append(resp, buf[:n]...)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if !strings.HasPrefix(string(resp), "HTTP/1.1 100 Continue\r\n\r\n") {
+		t.Fatalf("response %q, want 100 Continue first", resp)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := base.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// fdWriter writes to a fd.
+type fdWriter int
+
+func (w fdWriter) Write(p []byte) (int, error) {
+	return syscall.Write(int(w), p)
+}
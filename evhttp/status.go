@@ -0,0 +1,72 @@
+// Copyright (c) 2023 cheng-zhongliang. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package evhttp
+
+// HTTP status codes.
+const (
+	StatusContinue                    = 100
+	StatusSwitchingProtocols          = 101
+	StatusOK                          = 200
+	StatusCreated                     = 201
+	StatusAccepted                    = 202
+	StatusNoContent                   = 204
+	StatusMovedPermanently            = 301
+	StatusFound                       = 302
+	StatusNotModified                 = 304
+	StatusBadRequest                  = 400
+	StatusUnauthorized                = 401
+	StatusForbidden                   = 403
+	StatusNotFound                    = 404
+	StatusMethodNotAllowed            = 405
+	StatusRequestTimeout              = 408
+	StatusRequestEntityTooLarge       = 413
+	StatusRequestHeaderFieldsTooLarge = 431
+	StatusInternalServerError         = 500
+	StatusNotImplemented              = 501
+	StatusBadGateway                  = 502
+	StatusServiceUnavailable          = 503
+	StatusGatewayTimeout              = 504
+	StatusHTTPVersionNotSupported     = 505
+)
+
+var statusText = map[int]string{
+	StatusContinue:                    "Continue",
+	StatusSwitchingProtocols:          "Switching Protocols",
+	StatusOK:                          "OK",
+	StatusCreated:                     "Created",
+	StatusAccepted:                    "Accepted",
+	StatusNoContent:                   "No Content",
+	StatusMovedPermanently:            "Moved Permanently",
+	StatusFound:                       "Found",
+	StatusNotModified:                 "Not Modified",
+	StatusBadRequest:                  "Bad Request",
+	StatusUnauthorized:                "Unauthorized",
+	StatusForbidden:                   "Forbidden",
+	StatusNotFound:                    "Not Found",
+	StatusMethodNotAllowed:            "Method Not Allowed",
+	StatusRequestTimeout:              "Request Timeout",
+	StatusRequestEntityTooLarge:       "Request Entity Too Large",
+	StatusRequestHeaderFieldsTooLarge: "Request Header Fields Too Large",
+	StatusInternalServerError:         "Internal Server Error",
+	StatusNotImplemented:              "Not Implemented",
+	StatusBadGateway:                  "Bad Gateway",
+	StatusServiceUnavailable:          "Service Unavailable",
+	StatusGatewayTimeout:              "Gateway Timeout",
+	StatusHTTPVersionNotSupported:     "HTTP Version Not Supported",
+}
+
+// StatusText returns the reason phrase of the status code.
+// It returns "Status" for the unknown codes.
+func StatusText(code int) string {
+	if text, ok := statusText[code]; ok {
+		return text
+	}
+	return "Status"
+}
+
+// bodyAllowed reports whether the response with the status code can have a body.
+func bodyAllowed(code int) bool {
+	return code >= 200 && code != StatusNoContent && code != StatusNotModified
+}
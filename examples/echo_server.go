@@ -11,40 +11,20 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
-	fd := socket()
-	ev := event.New(base, fd, event.EvRead|event.EvPersist, accept, base)
-	if err := ev.Attach(0); err != nil {
-		panic(err)
-	}
-	if err := base.Dispatch(); err != nil && err != syscall.EBADF {
-		panic(err)
-	}
-	syscall.Close(fd)
-}
-
-func socket() int {
-	addr := syscall.SockaddrInet4{Port: 1246, Addr: [4]byte{0, 0, 0, 0}}
-	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_STREAM, syscall.IPPROTO_TCP)
+	ln, err := event.NewListener(base, "tcp", ":1246", accept, base)
 	if err != nil {
 		panic(err)
 	}
-	if err := syscall.Bind(fd, &addr); err != nil {
-		panic(err)
-	}
-	err = syscall.Listen(fd, syscall.SOMAXCONN)
-	if err != nil {
+	if err := base.Dispatch(); err != nil && err != syscall.EBADF {
 		panic(err)
 	}
-	return fd
+	ln.Close()
 }
 
-func accept(fd int, events uint32, arg interface{}) {
+func accept(fd int, sa syscall.Sockaddr, arg interface{}) {
 	base := arg.(*event.EventBase)
-	clientFd, _, err := syscall.Accept(fd)
-	if err != nil {
-		panic(err)
-	}
-	ev := event.New(base, clientFd, event.EvRead|event.EvPersist, echo, nil)
+	ev := new(event.Event)
+	ev.Assign(base, fd, event.EvRead|event.EvPersist, echo, ev, event.MP)
 	if err := ev.Attach(0); err != nil {
 		panic(err)
 	}
@@ -53,8 +33,13 @@ func accept(fd int, events uint32, arg interface{}) {
 func echo(fd int, events uint32, arg interface{}) {
 	buf := make([]byte, 0xFFF)
 	n, err := syscall.Read(fd, buf)
-	if err != nil {
-		panic(err)
+	if err == syscall.EAGAIN {
+		return
+	}
+	if err != nil || n == 0 {
+		arg.(*event.Event).Detach()
+		syscall.Close(fd)
+		return
 	}
 	if _, err := syscall.Write(fd, buf[:n]); err != nil {
 		panic(err)
@@ -0,0 +1,52 @@
+// Copyright (c) 2023 cheng-zhongliang. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build darwin || dragonfly || freebsd || netbsd || openbsd
+// +build darwin dragonfly freebsd netbsd openbsd
+
+package event
+
+import (
+	"syscall"
+)
+
+// openExitFd returns a fd which becomes readable when the process exits.
+// It is a private kqueue with the EVFILT_PROC filter of the process.
+func openExitFd(pid int) (int, error) {
+	var change syscall.Kevent_t
+	syscall.SetKevent(&change, pid, syscall.EVFILT_PROC, syscall.EV_ADD|syscall.EV_ONESHOT)
+	change.Fflags = syscall.NOTE_EXIT
+	return openKqueue(change)
+}
+
+// openKqueue creates a close-on-exec kqueue with the changes registered.
+// The kqueue is readable when any of the filters fires.
+func openKqueue(changes ...syscall.Kevent_t) (int, error) {
+	syscall.ForkLock.RLock()
+	fd, err := syscall.Kqueue()
+	if err == nil {
+		syscall.CloseOnExec(fd)
+	}
+	syscall.ForkLock.RUnlock()
+	if err != nil {
+		return -1, err
+	}
+	if _, err := syscall.Kevent(fd, changes, nil, nil); err != nil {
+		syscall.Close(fd)
+		return -1, err
+	}
+	return fd, nil
+}
+
+// readKqueue returns the fired events of the kqueue without blocking.
+func readKqueue(fd int, events []syscall.Kevent_t) (int, error) {
+	var zero syscall.Timespec
+	for {
+		n, err := syscall.Kevent(fd, nil, events, &zero)
+		if err == syscall.EINTR {
+			continue
+		}
+		return n, err
+	}
+}
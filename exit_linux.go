@@ -0,0 +1,26 @@
+// Copyright (c) 2023 cheng-zhongliang. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build linux
+// +build linux
+
+package event
+
+import (
+	"syscall"
+)
+
+// openExitFd returns a fd which becomes readable when the process exits.
+// It is a pidfd, which requires Linux 5.3.
+func openExitFd(pid int) (int, error) {
+	fd, _, errno := syscall.Syscall(sysPidfdOpen, uintptr(pid), 0, 0)
+	if errno == syscall.ENOSYS {
+		return -1, ErrPidfdUnsupported
+	}
+	if errno != 0 {
+		return -1, errno
+	}
+	syscall.CloseOnExec(int(fd))
+	return int(fd), nil
+}
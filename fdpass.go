@@ -0,0 +1,106 @@
+// Copyright (c) 2023 cheng-zhongliang. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package event
+
+import (
+	"io"
+	"syscall"
+	"unsafe"
+)
+
+// SendFds sends the data with the fds over the unix socket by SCM_RIGHTS.
+// The data must not be empty on stream sockets, otherwise the fds can not be received.
+// The fds stay open in the sender and can be closed after SendFds returns.
+func SendFds(fd int, data []byte, fds ...int) (int, error) {
+	var oob []byte
+	if len(fds) > 0 {
+		oob = syscall.UnixRights(fds...)
+	}
+	for {
+		n, err := syscall.SendmsgN(fd, data, oob, nil, 0)
+		if err == syscall.EINTR {
+			continue
+		}
+		return n, err
+	}
+}
+
+// RecvFds receives the data into p with the fds passed from the unix socket.
+// The received fds are close-on-exec and owned by the caller.
+// It returns io.EOF when the peer closes the connection, and ErrFdsTruncated
+// with the data when more than maxFds fds are passed, in which case the received fds are closed.
+// The received fds are closed as well when the control messages fail to parse.
+func RecvFds(fd int, p []byte, maxFds int) (int, []int, error) {
+	oob := make([]byte, syscall.CmsgSpace(maxFds*4))
+	for {
+		n, oobn, flags, err := recvmsg(fd, p, oob)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			return 0, nil, err
+		}
+		fds, err := parseRights(oob[:oobn])
+		if err != nil {
+			closeFds(fds)
+			return n, nil, err
+		}
+		if flags&syscall.MSG_CTRUNC != 0 || len(fds) > maxFds {
+			closeFds(fds)
+			return n, nil, ErrFdsTruncated
+		}
+		if n == 0 && len(fds) == 0 && len(p) > 0 {
+			return 0, nil, io.EOF
+		}
+		return n, fds, nil
+	}
+}
+
+// ReadMsgFd reads once from the unix socket like ReadFd and returns the fds passed with the bytes.
+// The fds are received as RecvFds does.
+func (b *Buffer) ReadMsgFd(fd int, maxFds int) (int, []int, error) {
+	b.grow(minBufferRead)
+	n, fds, err := RecvFds(fd, b.buf[len(b.buf):cap(b.buf)], maxFds)
+	b.buf = b.buf[:len(b.buf)+n]
+	return n, fds, err
+}
+
+// parseRights returns the fds of the SCM_RIGHTS control messages.
+// The messages are parsed one by one, and on error the fds of the messages before
+// are returned with it to be closed. The message cut short by the kernel yields the fds it holds.
+func parseRights(oob []byte) ([]int, error) {
+	var fds []int
+	hdrLen := syscall.CmsgLen(0)
+	for len(oob) >= hdrLen {
+		h := (*syscall.Cmsghdr)(unsafe.Pointer(&oob[0]))
+		n := int(h.Len)
+		if n < hdrLen {
+			return fds, syscall.EINVAL
+		}
+		if n > len(oob) {
+			n = len(oob)
+		}
+		if h.Level == syscall.SOL_SOCKET && h.Type == syscall.SCM_RIGHTS {
+			m := syscall.SocketControlMessage{Header: *h, Data: oob[hdrLen : hdrLen+(n-hdrLen)/4*4]}
+			rights, err := syscall.ParseUnixRights(&m)
+			if err != nil {
+				return fds, err
+			}
+			fds = append(fds, rights...)
+		}
+		next := syscall.CmsgSpace(n - hdrLen)
+		if next >= len(oob) {
+			break
+		}
+		oob = oob[next:]
+	}
+	return fds, nil
+}
+
+func closeFds(fds []int) {
+	for _, fd := range fds {
+		syscall.Close(fd)
+	}
+}
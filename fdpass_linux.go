@@ -0,0 +1,77 @@
+// Copyright (c) 2023 cheng-zhongliang. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build linux
+// +build linux
+
+package event
+
+import (
+	"io"
+	"os"
+	"syscall"
+)
+
+// SetPassCred enables receiving the credentials of the peer on the unix socket by SO_PASSCRED.
+func SetPassCred(fd int) error {
+	return syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_PASSCRED, 1)
+}
+
+// SendCredentials sends the data with the credentials of the process and the fds by SCM_CREDENTIALS.
+// The kernel verifies the credentials, so the receiver can trust them.
+func SendCredentials(fd int, data []byte, fds ...int) (int, error) {
+	oob := syscall.UnixCredentials(&syscall.Ucred{
+		Pid: int32(os.Getpid()),
+		Uid: uint32(os.Getuid()),
+		Gid: uint32(os.Getgid()),
+	})
+	if len(fds) > 0 {
+		oob = append(oob, syscall.UnixRights(fds...)...)
+	}
+	for {
+		n, err := syscall.SendmsgN(fd, data, oob, nil, 0)
+		if err == syscall.EINTR {
+			continue
+		}
+		return n, err
+	}
+}
+
+// RecvCredentials receives the data into p with the credentials of the sender and the fds as RecvFds does.
+// SetPassCred must be enabled on the socket, otherwise the credentials are nil.
+func RecvCredentials(fd int, p []byte, maxFds int) (int, *syscall.Ucred, []int, error) {
+	oob := make([]byte, syscall.CmsgSpace(syscall.SizeofUcred)+syscall.CmsgSpace(maxFds*4))
+	for {
+		n, oobn, flags, err := recvmsg(fd, p, oob)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			return 0, nil, nil, err
+		}
+		fds, err := parseRights(oob[:oobn])
+		if err != nil {
+			closeFds(fds)
+			return n, nil, nil, err
+		}
+		if flags&syscall.MSG_CTRUNC != 0 || len(fds) > maxFds {
+			closeFds(fds)
+			return n, nil, nil, ErrFdsTruncated
+		}
+		var cred *syscall.Ucred
+		msgs, _ := syscall.ParseSocketControlMessage(oob[:oobn])
+		for i := range msgs {
+			if msgs[i].Header.Level == syscall.SOL_SOCKET && msgs[i].Header.Type == syscall.SCM_CREDENTIALS {
+				if cred, err = syscall.ParseUnixCredentials(&msgs[i]); err != nil {
+					closeFds(fds)
+					return n, nil, nil, err
+				}
+			}
+		}
+		if n == 0 && len(fds) == 0 && len(p) > 0 {
+			return 0, cred, nil, io.EOF
+		}
+		return n, cred, fds, nil
+	}
+}
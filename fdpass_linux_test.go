@@ -0,0 +1,43 @@
+// Copyright (c) 2023 cheng-zhongliang. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build linux
+// +build linux
+
+package event_test
+
+import (
+	"os"
+	"syscall"
+	"testing"
+
+	. "github.com/cheng-zhongliang/event"
+)
+
+func TestCredentials(t *testing.T) {
+	pair, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer syscall.Close(pair[0])
+	defer syscall.Close(pair[1])
+
+	if err := SetPassCred(pair[1]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := SendCredentials(pair[0], []byte("hi")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 8)
+	n, cred, fds, err := RecvCredentials(pair[1], buf, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf[:n]) != "hi" || len(fds) != 0 {
+		t.Fatalf("received %q %v", buf[:n], fds)
+	}
+	if cred == nil || cred.Pid != int32(os.Getpid()) || cred.Uid != uint32(os.Getuid()) {
+		t.Fatalf("credentials %+v not equal", cred)
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright (c) 2023 cheng-zhongliang. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package event_test
+
+import (
+	"io/ioutil"
+	"syscall"
+	"testing"
+
+	. "github.com/cheng-zhongliang/event"
+)
+
+func TestFdPassing(t *testing.T) {
+	base, err := NewBase()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pair, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer syscall.Close(pair[0])
+	defer syscall.Close(pair[1])
+
+	var pipe [2]int
+	if err := syscall.Pipe(pipe[:]); err != nil {
+		t.Fatal(err)
+	}
+	defer syscall.Close(pipe[1])
+	if _, err := SendFds(pair[0], []byte("pipe"), pipe[0]); err != nil {
+		t.Fatal(err)
+	}
+	syscall.Close(pipe[0])
+
+	var in Buffer
+	var fds []int
+	ev := New(base, pair[1], EvRead, func(fd int, events uint32, arg interface{}) {
+		_, fds, err = in.ReadMsgFd(fd, 1)
+	}, nil)
+	if err := ev.Attach(0); err != nil {
+		t.Fatal(err)
+	}
+	if err := base.Loop(EvLoopOnce); err != nil {
+		t.Fatal(err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(in.Bytes()) != "pipe" || len(fds) != 1 {
+		t.Fatalf("received %q %v", in.Bytes(), fds)
+	}
+	defer syscall.Close(fds[0])
+
+	syscall.Write(pipe[1], []byte("hello"))
+	buf := make([]byte, 8)
+	n, err := syscall.Read(fds[0], buf)
+	if err != nil || string(buf[:n]) != "hello" {
+		t.Fatalf("read %q %v from passed fd", buf[:n], err)
+	}
+
+	if _, err := SendFds(pair[0], []byte("three"), pipe[1], pipe[1], pipe[1]); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := RecvFds(pair[1], buf, 1); err != ErrFdsTruncated {
+		t.Fatalf("error %v, want %v", err, ErrFdsTruncated)
+	}
+
+	if err := base.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// openFds counts the fds open in the process.
+func openFds(t *testing.T) int {
+	fis, err := ioutil.ReadDir("/dev/fd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(fis)
+}
+
+func TestRecvFdsTruncated(t *testing.T) {
+	pair, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer syscall.Close(pair[0])
+	defer syscall.Close(pair[1])
+
+	buf := make([]byte, 8)
+	before := openFds(t)
+	// two fds may fit in the space for one rounded up, and more do not fit at all.
+	for _, n := range []int{2, 3, 8} {
+		fds := make([]int, n)
+		for i := range fds {
+			fds[i] = pair[0]
+		}
+		if _, err := SendFds(pair[0], []byte("x"), fds...); err != nil {
+			t.Fatal(err)
+		}
+		if _, fds, err := RecvFds(pair[1], buf, 1); err != ErrFdsTruncated || fds != nil {
+			t.Fatalf("%d fds: received %v %v, want %v", n, fds, err, ErrFdsTruncated)
+		}
+		if after := openFds(t); after != before {
+			t.Fatalf("%d fds: %d fds open, want %d", n, after, before)
+		}
+	}
+}
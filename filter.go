@@ -0,0 +1,92 @@
+// Copyright (c) 2023 cheng-zhongliang. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package event
+
+// The flush modes of a filter.
+const (
+	// FilterNormal lets the filter hold the bytes it needs to transform more.
+	FilterNormal = iota
+	// FilterFlush makes the filter output all the bytes received so far.
+	FilterFlush
+	// FilterFinished tells the filter no more bytes follow, so it ends its output.
+	FilterFinished
+)
+
+// Filter transforms the bytes between a buffered socket and its user, such as compressing them.
+// The filter drains the bytes it consumes from src and appends its output to dst.
+// The bytes left in src are passed again with the bytes arriving later.
+// It runs in the loop of the socket.
+// Only the framed connections of the codec package run filters; the net adapters,
+// the HTTP and the WebSocket connections write their bytes unfiltered.
+type Filter interface {
+	// Input transforms the bytes read from the socket.
+	Input(dst, src *Buffer, mode int) error
+	// Output transforms the bytes to write to the socket.
+	Output(dst, src *Buffer, mode int) error
+}
+
+// FilterChain is the filter stacking the filters.
+// The first filter is next to the socket, so the bytes read pass the filters in order,
+// and the bytes to write pass them in reverse order.
+type FilterChain struct {
+	// filters is the filters from the socket to the user.
+	filters []Filter
+	// in is the input buffers between the adjacent filters.
+	in []Buffer
+	// out is the output buffers between the adjacent filters.
+	out []Buffer
+}
+
+// NewFilterChain creates a chain of the filters, the first of which is next to the socket.
+// The chain of no filters passes the bytes unchanged.
+func NewFilterChain(filters ...Filter) *FilterChain {
+	c := new(FilterChain)
+	c.filters = filters
+	if len(filters) > 1 {
+		c.in = make([]Buffer, len(filters)-1)
+		c.out = make([]Buffer, len(filters)-1)
+	}
+	return c
+}
+
+// Input passes the bytes read from the socket through the filters in order.
+func (c *FilterChain) Input(dst, src *Buffer, mode int) error {
+	if len(c.filters) == 0 {
+		dst.Write(src.Bytes())
+		src.Reset()
+		return nil
+	}
+	for i, f := range c.filters {
+		next := dst
+		if i < len(c.in) {
+			next = &c.in[i]
+		}
+		if err := f.Input(next, src, mode); err != nil {
+			return err
+		}
+		src = next
+	}
+	return nil
+}
+
+// Output passes the bytes to write to the socket through the filters in reverse order.
+func (c *FilterChain) Output(dst, src *Buffer, mode int) error {
+	if len(c.filters) == 0 {
+		dst.Write(src.Bytes())
+		src.Reset()
+		return nil
+	}
+	for i := len(c.filters) - 1; i >= 0; i-- {
+		next := dst
+		if i > 0 {
+			next = &c.out[i-1]
+		}
+		if err := c.filters[i].Output(next, src, mode); err != nil {
+			return err
+		}
+		src = next
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+// Copyright (c) 2023 cheng-zhongliang. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package event_test
+
+import (
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"testing"
+
+	. "github.com/cheng-zhongliang/event"
+)
+
+// xorFilter obfuscates the bytes by xor with the key.
+type xorFilter byte
+
+func (f xorFilter) Input(dst, src *Buffer, mode int) error {
+	return f.Output(dst, src, mode)
+}
+
+func (f xorFilter) Output(dst, src *Buffer, mode int) error {
+	for _, c := range src.Bytes() {
+		dst.Write([]byte{c ^ byte(f)})
+	}
+	src.Reset()
+	return nil
+}
+
+// newDeflateChain creates a chain of a deflate filter next to the socket and a xor filter.
+func newDeflateChain(t *testing.T) *FilterChain {
+	f, err := NewDeflateFilter(flate.BestSpeed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewFilterChain(f, xorFilter(0x5a))
+}
+
+func TestFilterChain(t *testing.T) {
+	w, r := newDeflateChain(t), newDeflateChain(t)
+
+	var src, wire, pending, got Buffer
+	var want []byte
+	for i := 0; i < 100; i++ {
+		msg := []byte(fmt.Sprintf("message %d %s", i, bytes.Repeat([]byte("x"), i*50)))
+		want = append(want, msg...)
+		src.Write(msg)
+		if err := w.Output(&wire, &src, FilterFlush); err != nil {
+			t.Fatal(err)
+		}
+		if src.Len() != 0 {
+			t.Fatalf("%d bytes left to filter", src.Len())
+		}
+
+		// the input arrives in small pieces, and is decompressed once the flushed block is complete.
+		for wire.Len() > 0 {
+			n := 7
+			if n > wire.Len() {
+				n = wire.Len()
+			}
+			pending.Write(wire.Bytes()[:n])
+			wire.Drain(n)
+			if err := r.Input(&got, &pending, FilterNormal); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if !bytes.Equal(got.Bytes(), want) {
+			t.Fatalf("message %d: input differs", i)
+		}
+	}
+
+	if err := w.Output(&wire, &src, FilterFinished); err != nil {
+		t.Fatal(err)
+	}
+	pending.Write(wire.Bytes())
+	if err := r.Input(&got, &pending, FilterFinished); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.Bytes(), want) {
+		t.Fatal("input differs after finished")
+	}
+	pending.WriteString("x")
+	if err := r.Input(&got, &pending, FilterNormal); err != ErrDeflateTrailing {
+		t.Fatalf("error %v, want %v", err, ErrDeflateTrailing)
+	}
+}
+
+func TestDeflateFilterFinished(t *testing.T) {
+	w, err := NewDeflateFilter(flate.DefaultCompression)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewDeflateFilter(flate.DefaultCompression)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewDeflateFilter(100); err == nil {
+		t.Fatal("invalid level accepted")
+	}
+
+	// the output not flushed is only decompressed when it is finished.
+	var src, wire, got Buffer
+	src.WriteString("hello, world")
+	if err := w.Output(&wire, &src, FilterNormal); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Output(&wire, &src, FilterFinished); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Input(&got, &wire, FilterNormal); err != nil {
+		t.Fatal(err)
+	}
+	if got.Len() != 0 {
+		t.Fatalf("input %q before finished", got.Bytes())
+	}
+	if err := r.Input(&got, &wire, FilterFinished); err != nil {
+		t.Fatal(err)
+	}
+	if string(got.Bytes()) != "hello, world" {
+		t.Fatalf("input %q", got.Bytes())
+	}
+}
+
+func TestFilterChainEmpty(t *testing.T) {
+	c := NewFilterChain()
+	var src, dst Buffer
+	src.WriteString("hello")
+	if err := c.Output(&dst, &src, FilterNormal); err != nil {
+		t.Fatal(err)
+	}
+	if string(dst.Bytes()) != "hello" || src.Len() != 0 {
+		t.Fatalf("output %q, left %d", dst.Bytes(), src.Len())
+	}
+}
@@ -0,0 +1,244 @@
+// Copyright (c) 2023 cheng-zhongliang. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package event
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"syscall"
+)
+
+// The listener modes of an event base group.
+const (
+	// ListenReusePort opens a socket for every base bound to the same address by SO_REUSEPORT,
+	// so the connections are spread across the loops by the kernel.
+	ListenReusePort = iota
+	// ListenExclusive shares one listening socket among the bases, watched by EPOLLEXCLUSIVE
+	// to wake up one of the loops per connection. On kqueue all the loops are woken up.
+	ListenExclusive
+)
+
+// EventBaseGroup is a group of event bases, each looping in its own goroutine locked to an OS thread.
+type EventBaseGroup struct {
+	// bases is the event bases of the group.
+	bases []*EventBase
+	// wg waits for the loops to return.
+	wg sync.WaitGroup
+	// done is closed when the loop of the base at the same index returns.
+	done []chan struct{}
+	// started reports whether the loops are started.
+	started bool
+	// stopping is set when the group is shut down.
+	stopping int32
+	// mu guards the error below.
+	mu sync.Mutex
+	// err is the first error returned by the loops.
+	err error
+}
+
+// NewEventBaseGroup creates a group of n event bases.
+// Zero means the number of the CPUs.
+func NewEventBaseGroup(n int) (*EventBaseGroup, error) {
+	if n <= 0 {
+		n = runtime.NumCPU()
+	}
+	g := &EventBaseGroup{bases: make([]*EventBase, 0, n)}
+	for i := 0; i < n; i++ {
+		base, err := NewBase()
+		if err != nil {
+			for _, base := range g.bases {
+				base.Shutdown()
+			}
+			return nil, err
+		}
+		g.bases = append(g.bases, base)
+	}
+	return g, nil
+}
+
+// Bases returns the event bases of the group.
+func (g *EventBaseGroup) Bases() []*EventBase {
+	return g.bases
+}
+
+// Start runs the loop of every base in its own goroutine locked to an OS thread.
+// The events of a base must be attached in its loop, by Post, after the group is started.
+func (g *EventBaseGroup) Start() {
+	if g.started {
+		return
+	}
+	g.started = true
+	g.done = make([]chan struct{}, len(g.bases))
+	for i, base := range g.bases {
+		g.done[i] = make(chan struct{})
+		g.wg.Add(1)
+		go g.run(base, g.done[i])
+	}
+}
+
+// Shutdown breaks the loops and shuts down the bases.
+// It is safe to call from any goroutine.
+func (g *EventBaseGroup) Shutdown() {
+	if !atomic.CompareAndSwapInt32(&g.stopping, 0, 1) {
+		return
+	}
+	for _, base := range g.bases {
+		base.Shutdown()
+	}
+}
+
+// Wait waits for the loops to return after the group is shut down.
+// It returns the first error of the loops other than the shutdown.
+func (g *EventBaseGroup) Wait() error {
+	g.wg.Wait()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.err
+}
+
+func (g *EventBaseGroup) run(base *EventBase, done chan struct{}) {
+	defer g.wg.Done()
+	defer close(done)
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	err := base.Dispatch()
+	if err == syscall.EBADF && atomic.LoadInt32(&g.stopping) != 0 {
+		return
+	}
+	g.mu.Lock()
+	if g.err == nil {
+		g.err = err
+	}
+	g.mu.Unlock()
+}
+
+// runOn runs the function in the loop of the i-th base and waits for its error.
+// It runs the function directly before the group is started, or after the loop returns
+// if the base is shut down, so the function still releases its resources.
+// It must not be called from the loops of the group.
+func (g *EventBaseGroup) runOn(i int, fn func() error) error {
+	if !g.started {
+		return fn()
+	}
+	errc := make(chan error, 1)
+	run := func() {
+		errc <- fn()
+	}
+	// the task dropped by the shutdown runs in the loop as it shuts down the base.
+	err := g.bases[i].post(&task{fn: run, cancel: run})
+	if err == ErrBaseShutdown {
+		<-g.done[i]
+		return fn()
+	}
+	if err != nil {
+		return err
+	}
+	return <-errc
+}
+
+// GroupListener is the listeners of an event base group on the same address.
+type GroupListener struct {
+	// group is the event base group of the listeners.
+	group *EventBaseGroup
+	// listeners is the listener of every base.
+	listeners []*Listener
+}
+
+// Listen creates a listener on the network address for every base of the group in the mode.
+// The callback function is called in the loop of the base which accepts the connection.
+// It must not be called from the loops of the group.
+func (g *EventBaseGroup) Listen(network, address string, mode int, callback func(base *EventBase, fd int, sa syscall.Sockaddr, arg interface{}), arg interface{}) (*GroupListener, error) {
+	family, sa, err := resolveSockaddr(network, address)
+	if err != nil {
+		return nil, err
+	}
+	if family == syscall.AF_UNIX {
+		mode = ListenExclusive
+	}
+	path := ""
+	if family == syscall.AF_UNIX {
+		path = address
+	}
+	gl := &GroupListener{group: g}
+	shared := -1
+	for i, base := range g.bases {
+		var fd int
+		switch {
+		case mode == ListenReusePort:
+			fd, err = listenSocket(family, sa, true)
+			if err == nil && i == 0 {
+				// bind the other sockets to the port chosen for the first one.
+				if sa, err = syscall.Getsockname(fd); err != nil {
+					syscall.Close(fd)
+				}
+			}
+		case i == 0:
+			fd, err = listenSocket(family, sa, false)
+			shared = fd
+		default:
+			fd, err = dupCloexec(shared)
+		}
+		if err != nil {
+			gl.Close()
+			return nil, err
+		}
+		if i > 0 {
+			path = ""
+		}
+		ln, err := gl.listen(i, base, fd, network, address, path, mode == ListenExclusive, callback, arg)
+		if err != nil {
+			gl.Close()
+			return nil, err
+		}
+		gl.listeners = append(gl.listeners, ln)
+	}
+	return gl, nil
+}
+
+func (gl *GroupListener) listen(i int, base *EventBase, fd int, network, address, path string, exclusive bool, callback func(base *EventBase, fd int, sa syscall.Sockaddr, arg interface{}), arg interface{}) (*Listener, error) {
+	ln := initListener(base, fd, network, address, path, func(fd int, sa syscall.Sockaddr, arg interface{}) {
+		callback(base, fd, sa, arg)
+	}, arg)
+	ln.ev.exclusive = exclusive
+	if err := gl.group.runOn(i, ln.Enable); err != nil {
+		gl.group.runOn(i, ln.Close)
+		return nil, err
+	}
+	return ln, nil
+}
+
+// Listeners returns the listener of every base.
+func (gl *GroupListener) Listeners() []*Listener {
+	return gl.listeners
+}
+
+// Addr returns the local address of the listening sockets.
+func (gl *GroupListener) Addr() (syscall.Sockaddr, error) {
+	return gl.listeners[0].Addr()
+}
+
+// Close closes the listeners in their loops.
+// It must not be called from the loops of the group.
+func (gl *GroupListener) Close() error {
+	var err error
+	for i, ln := range gl.listeners {
+		if cerr := gl.group.runOn(i, ln.Close); err == nil {
+			err = cerr
+		}
+	}
+	gl.listeners = nil
+	return err
+}
+
+func dupCloexec(fd int) (int, error) {
+	syscall.ForkLock.RLock()
+	nfd, err := syscall.Dup(fd)
+	if err == nil {
+		syscall.CloseOnExec(nfd)
+	}
+	syscall.ForkLock.RUnlock()
+	return nfd, err
+}
@@ -0,0 +1,136 @@
+// Copyright (c) 2023 cheng-zhongliang. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package event_test
+
+import (
+	"net"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	. "github.com/cheng-zhongliang/event"
+)
+
+func TestEventBaseGroup(t *testing.T) {
+	for _, mode := range []int{ListenReusePort, ListenExclusive} {
+		g, err := NewEventBaseGroup(4)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(g.Bases()) != 4 {
+			t.Fatalf("bases %d, want 4", len(g.Bases()))
+		}
+		g.Start()
+
+		var mu sync.Mutex
+		accepted := map[*EventBase]int{}
+		total := 0
+		gl, err := g.Listen("tcp", "127.0.0.1:0", mode, func(base *EventBase, fd int, sa syscall.Sockaddr, arg interface{}) {
+			syscall.Close(fd)
+			mu.Lock()
+			accepted[base]++
+			total++
+			mu.Unlock()
+		}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(gl.Listeners()) != 4 {
+			t.Fatalf("listeners %d, want 4", len(gl.Listeners()))
+		}
+		sa, err := gl.Addr()
+		if err != nil {
+			t.Fatal(err)
+		}
+		addr := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: sa.(*syscall.SockaddrInet4).Port}
+
+		const conns = 40
+		for i := 0; i < conns; i++ {
+			c, err := net.Dial("tcp", addr.String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			c.Close()
+		}
+		for deadline := time.Now().Add(time.Second); ; time.Sleep(time.Millisecond) {
+			mu.Lock()
+			n := total
+			mu.Unlock()
+			if n == conns {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("mode %d: accepted %d, want %d", mode, n, conns)
+			}
+		}
+		if mode == ListenReusePort && len(accepted) < 2 {
+			t.Fatalf("connections not spread: %v", accepted)
+		}
+
+		if err := gl.Close(); err != nil {
+			t.Fatal(err)
+		}
+		g.Shutdown()
+		if err := g.Wait(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestGroupListenerCloseAfterShutdown(t *testing.T) {
+	for _, wait := range []bool{false, true} {
+		g, err := NewEventBaseGroup(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		g.Start()
+		gl, err := g.Listen("tcp", "127.0.0.1:0", ListenReusePort, func(base *EventBase, fd int, sa syscall.Sockaddr, arg interface{}) {
+			syscall.Close(fd)
+		}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ln := gl.Listeners()[0]
+
+		done := make(chan struct{})
+		if wait {
+			// the listener is closed after the loop returns.
+			g.Shutdown()
+			if err := g.Wait(); err != nil {
+				t.Fatal(err)
+			}
+			go func() {
+				gl.Close()
+				close(done)
+			}()
+		} else {
+			// the close queued behind a running task is dropped by the shutdown.
+			release := make(chan struct{})
+			g.Bases()[0].Post(func() {
+				<-release
+			})
+			time.Sleep(10 * time.Millisecond)
+			go func() {
+				gl.Close()
+				close(done)
+			}()
+			time.Sleep(10 * time.Millisecond)
+			g.Shutdown()
+			close(release)
+		}
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatalf("wait %v: close not returned", wait)
+		}
+		if _, err := ln.Addr(); err != syscall.EBADF {
+			t.Fatalf("wait %v: listener fd %d not closed: %v", wait, ln.Fd(), err)
+		}
+		if err := g.Wait(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
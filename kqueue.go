@@ -8,6 +8,8 @@
 package event
 
 import (
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 	"unsafe"
@@ -22,6 +24,14 @@ type poll struct {
 	fd      int
 	changes []syscall.Kevent_t
 	events  []syscall.Kevent_t
+	// shared is the number of the events added by addShared so far.
+	shared int32
+	// sharedSeen is the number of the shared events the loop is synchronized with.
+	sharedSeen int32
+	// sharedMu guards the events below.
+	sharedMu sync.Mutex
+	// sharedEvents keeps the events added by addShared alive, as only the kernel refers to them.
+	sharedEvents map[int]*Event
 }
 
 func openPoll() (*poll, error) {
@@ -33,6 +43,7 @@ func openPoll() (*poll, error) {
 	kq.fd = fd
 	kq.changes = make([]syscall.Kevent_t, initialNEvent)
 	kq.events = make([]syscall.Kevent_t, initialNEvent)
+	kq.sharedEvents = make(map[int]*Event)
 	return kq, nil
 }
 
@@ -56,6 +67,51 @@ func (kq *poll) add(ev *Event) error {
 	return nil
 }
 
+// addShared watches the read event without the state of the loop.
+// It is safe to call from any goroutine.
+// The event is removed by delShared.
+func (kq *poll) addShared(ev *Event) error {
+	kq.sharedMu.Lock()
+	kq.sharedEvents[ev.fd] = ev
+	atomic.AddInt32(&kq.shared, 1)
+	kq.sharedMu.Unlock()
+	change := syscall.Kevent_t{
+		Ident:  uint64(ev.fd),
+		Filter: syscall.EVFILT_READ,
+		Flags:  syscall.EV_ADD,
+		Udata:  (*byte)(unsafe.Pointer(ev)),
+	}
+	if _, err := syscall.Kevent(kq.fd, []syscall.Kevent_t{change}, nil, nil); err != nil {
+		kq.delShared(ev)
+		return err
+	}
+	return nil
+}
+
+// delShared removes the read event added by addShared.
+func (kq *poll) delShared(ev *Event) error {
+	kq.sharedMu.Lock()
+	delete(kq.sharedEvents, ev.fd)
+	kq.sharedMu.Unlock()
+	change := syscall.Kevent_t{
+		Ident:  uint64(ev.fd),
+		Filter: syscall.EVFILT_READ,
+		Flags:  syscall.EV_DELETE,
+	}
+	_, err := syscall.Kevent(kq.fd, []syscall.Kevent_t{change}, nil, nil)
+	return err
+}
+
+// syncShared synchronizes the loop with the goroutines which added the shared events,
+// before the events are reported by the kernel.
+func (kq *poll) syncShared() {
+	if n := atomic.LoadInt32(&kq.shared); n != kq.sharedSeen {
+		kq.sharedMu.Lock()
+		kq.sharedSeen = n
+		kq.sharedMu.Unlock()
+	}
+}
+
 func (kq *poll) del(ev *Event) error {
 	if ev.events&EvRead != 0 {
 		kq.changes = append(kq.changes, syscall.Kevent_t{
@@ -85,6 +141,7 @@ func (kq *poll) wait(cb func(ev *Event, res uint32), timeout time.Duration) erro
 		return err
 	}
 	kq.changes = kq.changes[:0]
+	kq.syncShared()
 	for i := 0; i < n; i++ {
 		flags := kq.events[i].Flags
 		if flags&syscall.EV_ERROR != 0 {
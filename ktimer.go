@@ -0,0 +1,98 @@
+// Copyright (c) 2023 cheng-zhongliang. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package event
+
+import (
+	"errors"
+	"syscall"
+	"time"
+)
+
+// The clocks of the kernel timers.
+const (
+	// ClockMonotonic is the clock not affected by the changes of the system time.
+	ClockMonotonic = iota
+	// ClockRealtime is the wall clock. A deadline on it is canceled when the system time is set.
+	ClockRealtime
+)
+
+var ErrClockChanged = errors.New("clock changed")
+
+// KernelTimer is a timer backed by a kernel timer instead of the timer heap of the event base.
+// It uses timerfd on Linux and EVFILT_TIMER on kqueue.
+type KernelTimer struct {
+	// ev is the read event of the timer fd.
+	ev *Event
+	// fd is the timerfd or the private kqueue.
+	fd int
+	// clock is the clock of the timer.
+	clock int
+	// deadline is the wall clock deadline of the first expiration, zero for a relative timer.
+	deadline time.Time
+	// interval is the period of the expirations after the first one, zero for a one-shot timer.
+	interval time.Duration
+	// first reports whether the first expiration is pending with a period different from the interval.
+	first bool
+	// cb is the callback function when the timer expires.
+	cb func(expirations uint64, err error, arg interface{})
+	// arg is the argument passed to the callback function.
+	arg interface{}
+}
+
+// NewKernelTimer creates a disarmed kernel timer on the clock.
+// The callback function is called with the number of expirations since the last call,
+// or with ErrClockChanged when the system time is set while a deadline on ClockRealtime is armed.
+// The deadline is rearmed before the callback function is called with ErrClockChanged.
+func NewKernelTimer(base *EventBase, clock int, callback func(expirations uint64, err error, arg interface{}), arg interface{}) (*KernelTimer, error) {
+	if clock != ClockMonotonic && clock != ClockRealtime {
+		return nil, syscall.EINVAL
+	}
+	fd, err := openTimerFd(clock)
+	if err != nil {
+		return nil, err
+	}
+	kt := &KernelTimer{fd: fd, clock: clock, cb: callback, arg: arg}
+	kt.ev = New(base, fd, EvRead|EvPersist, kt.onRead, nil)
+	if err := kt.ev.Attach(0); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+	return kt, nil
+}
+
+// Set arms the timer to expire after the value and then every interval.
+// A zero interval makes a one-shot timer.
+func (kt *KernelTimer) Set(value, interval time.Duration) error {
+	if value <= 0 {
+		value = 1
+	}
+	kt.deadline = time.Time{}
+	kt.interval = interval
+	return kt.arm(value)
+}
+
+// SetDeadline arms the timer to expire at the deadline and then every interval.
+// On ClockRealtime the deadline follows the wall clock.
+func (kt *KernelTimer) SetDeadline(deadline time.Time, interval time.Duration) error {
+	if kt.clock != ClockRealtime {
+		return kt.Set(time.Until(deadline), interval)
+	}
+	kt.deadline = deadline
+	kt.interval = interval
+	return kt.armDeadline()
+}
+
+// Stop disarms the timer.
+func (kt *KernelTimer) Stop() error {
+	kt.deadline = time.Time{}
+	kt.interval = 0
+	return kt.disarm()
+}
+
+// Close disarms the timer and releases its fd.
+func (kt *KernelTimer) Close() error {
+	kt.ev.Detach()
+	return syscall.Close(kt.fd)
+}
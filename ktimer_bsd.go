@@ -0,0 +1,86 @@
+// Copyright (c) 2023 cheng-zhongliang. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build darwin || dragonfly || freebsd || netbsd || openbsd
+// +build darwin dragonfly freebsd netbsd openbsd
+
+package event
+
+import (
+	"syscall"
+	"time"
+)
+
+const (
+	// timerIdent is the ident of the EVFILT_TIMER filter in the private kqueue.
+	timerIdent = 1
+	// maxTimerEvents is the maximum number of the expirations read at once.
+	maxTimerEvents = 0x8
+)
+
+// openTimerFd returns a private kqueue. The clock is only used by the deadline,
+// which is checked against the wall clock when the timer fires.
+func openTimerFd(clock int) (int, error) {
+	return openKqueue()
+}
+
+// setTimer registers the EVFILT_TIMER filter with the period in milliseconds, rounded up.
+func (kt *KernelTimer) setTimer(period time.Duration, oneshot bool) error {
+	flags := syscall.EV_ADD
+	if oneshot {
+		flags |= syscall.EV_ONESHOT
+	}
+	var change syscall.Kevent_t
+	syscall.SetKevent(&change, timerIdent, syscall.EVFILT_TIMER, flags)
+	change.Data = int64((period + time.Millisecond - 1) / time.Millisecond)
+	_, err := syscall.Kevent(kt.fd, []syscall.Kevent_t{change}, nil, nil)
+	return err
+}
+
+func (kt *KernelTimer) arm(value time.Duration) error {
+	kt.first = kt.interval <= 0 || value != kt.interval
+	return kt.setTimer(value, kt.first)
+}
+
+// armDeadline arms the timer with the time left to the deadline by the wall clock.
+func (kt *KernelTimer) armDeadline() error {
+	value := kt.deadline.Sub(time.Now().Round(0))
+	if value <= 0 {
+		value = 1
+	}
+	return kt.arm(value)
+}
+
+func (kt *KernelTimer) disarm() error {
+	var change syscall.Kevent_t
+	syscall.SetKevent(&change, timerIdent, syscall.EVFILT_TIMER, syscall.EV_DELETE)
+	_, err := syscall.Kevent(kt.fd, []syscall.Kevent_t{change}, nil, nil)
+	if err == syscall.ENOENT {
+		return nil
+	}
+	return err
+}
+
+func (kt *KernelTimer) onRead(fd int, events uint32, arg interface{}) {
+	var changes [maxTimerEvents]syscall.Kevent_t
+	n, err := readKqueue(fd, changes[:])
+	if err != nil || n == 0 {
+		return
+	}
+	expirations := uint64(0)
+	for i := 0; i < n; i++ {
+		expirations += uint64(changes[i].Data)
+	}
+	if !kt.deadline.IsZero() && kt.first && time.Now().Round(0).Before(kt.deadline) {
+		// the wall clock is set back before the deadline.
+		kt.armDeadline()
+		kt.cb(0, ErrClockChanged, kt.arg)
+		return
+	}
+	if kt.first && kt.interval > 0 {
+		kt.setTimer(kt.interval, false)
+	}
+	kt.first = false
+	kt.cb(expirations, nil, kt.arg)
+}
@@ -0,0 +1,82 @@
+// Copyright (c) 2023 cheng-zhongliang. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build linux
+// +build linux
+
+package event
+
+import (
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+const (
+	// clockRealtime and clockMonotonic are the clock ids of timerfd_create.
+	clockRealtime  = 0
+	clockMonotonic = 1
+	// tfdTimerAbstime arms the timerfd with an absolute time.
+	tfdTimerAbstime = 0x1
+	// tfdTimerCancelOnSet cancels the absolute timerfd on ClockRealtime when the time is set.
+	tfdTimerCancelOnSet = 0x2
+)
+
+// itimerspec is the argument of timerfd_settime.
+type itimerspec struct {
+	interval syscall.Timespec
+	value    syscall.Timespec
+}
+
+func openTimerFd(clock int) (int, error) {
+	id := clockMonotonic
+	if clock == ClockRealtime {
+		id = clockRealtime
+	}
+	fd, _, errno := syscall.Syscall(syscall.SYS_TIMERFD_CREATE, uintptr(id), syscall.O_NONBLOCK|syscall.O_CLOEXEC, 0)
+	if errno != 0 {
+		return -1, errno
+	}
+	return int(fd), nil
+}
+
+func (kt *KernelTimer) settime(flags int, value time.Duration, interval time.Duration) error {
+	spec := itimerspec{
+		interval: syscall.NsecToTimespec(int64(interval)),
+		value:    syscall.NsecToTimespec(int64(value)),
+	}
+	_, _, errno := syscall.Syscall6(syscall.SYS_TIMERFD_SETTIME, uintptr(kt.fd), uintptr(flags), uintptr(unsafe.Pointer(&spec)), 0, 0, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+func (kt *KernelTimer) arm(value time.Duration) error {
+	return kt.settime(0, value, kt.interval)
+}
+
+// armDeadline arms the timerfd with the wall clock deadline, canceled when the time is set.
+func (kt *KernelTimer) armDeadline() error {
+	return kt.settime(tfdTimerAbstime|tfdTimerCancelOnSet, time.Duration(kt.deadline.UnixNano()), kt.interval)
+}
+
+func (kt *KernelTimer) disarm() error {
+	return kt.settime(0, 0, 0)
+}
+
+func (kt *KernelTimer) onRead(fd int, events uint32, arg interface{}) {
+	var expirations uint64
+	_, err := syscall.Read(fd, (*[8]byte)(unsafe.Pointer(&expirations))[:])
+	switch err {
+	case nil:
+		kt.cb(expirations, nil, kt.arg)
+	case syscall.ECANCELED:
+		// the timerfd keeps reporting the cancellation until it is armed again.
+		if !kt.deadline.IsZero() {
+			kt.armDeadline()
+		}
+		kt.cb(0, ErrClockChanged, kt.arg)
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright (c) 2023 cheng-zhongliang. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package event_test
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/cheng-zhongliang/event"
+)
+
+func TestKernelTimer(t *testing.T) {
+	base, err := NewBase()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	total := uint64(0)
+	kt, err := NewKernelTimer(base, ClockMonotonic, func(expirations uint64, err error, arg interface{}) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		total += expirations
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := kt.Set(5*time.Millisecond, 10*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(time.Second); total < 3; {
+		if time.Now().After(deadline) {
+			t.Fatalf("expirations %d, want 3", total)
+		}
+		if err := base.Loop(EvLoopOnce); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := kt.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	total = 0
+	time.Sleep(30 * time.Millisecond)
+	if err := base.Loop(EvLoopOnce | EvLoopNoblock); err != nil {
+		t.Fatal(err)
+	}
+	if total != 0 {
+		t.Fatalf("expirations %d after stop", total)
+	}
+
+	if err := kt.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := base.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestKernelTimerDeadline(t *testing.T) {
+	base, err := NewBase()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fired := time.Time{}
+	kt, err := NewKernelTimer(base, ClockRealtime, func(expirations uint64, err error, arg interface{}) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expirations != 1 {
+			t.Fatalf("expirations %d, want 1", expirations)
+		}
+		fired = time.Now()
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(20 * time.Millisecond)
+	if err := kt.SetDeadline(deadline, 0); err != nil {
+		t.Fatal(err)
+	}
+	for limit := time.Now().Add(time.Second); fired.IsZero(); {
+		if time.Now().After(limit) {
+			t.Fatal("deadline not reached")
+		}
+		if err := base.Loop(EvLoopOnce); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if fired.Before(deadline) {
+		t.Fatalf("fired %v before the deadline %v", fired, deadline)
+	}
+
+	if _, err := NewKernelTimer(base, 2, nil, nil); err == nil {
+		t.Fatal("invalid clock accepted")
+	}
+
+	if err := kt.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := base.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+}
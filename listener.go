@@ -0,0 +1,260 @@
+// Copyright (c) 2023 cheng-zhongliang. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package event
+
+import (
+	"syscall"
+	"time"
+)
+
+const (
+	// minAcceptBackoff is the initial pause of the listener when it runs out of file descriptors.
+	minAcceptBackoff = 10 * time.Millisecond
+	// maxAcceptBackoff is the maximum pause of the listener when it runs out of file descriptors.
+	maxAcceptBackoff = time.Second
+)
+
+// Listener is the listener to accept connections.
+// It works in a similar manner as evconnlistener of libevent.
+type Listener struct {
+	// ev is the read event of the listening socket.
+	ev *Event
+	// timer is the timer event to resume the paused listener.
+	timer *Event
+	// backoff is the pause of the listener when it runs out of file descriptors.
+	backoff time.Duration
+	// reserveFd is the spare file descriptor released to drop a connection when out of file descriptors.
+	reserveFd int
+	// enabled reports whether the listener is enabled by the user.
+	enabled bool
+	// fd is the listening socket.
+	fd int
+	// network is the network of the listener.
+	network string
+	// address is the address the listener was created with.
+	address string
+	// path is the path of the unix socket to remove when closed.
+	path string
+	// cb is the callback function when a connection is accepted.
+	cb func(fd int, sa syscall.Sockaddr, arg interface{})
+	// errCb is the callback function when accepting fails.
+	errCb func(err error, arg interface{})
+	// arg is the argument passed to the callback functions.
+	arg interface{}
+}
+
+// NewListener creates a new listener on the network address.
+// Network can be "tcp", "tcp4", "tcp6" or "unix".
+// The listening socket is non-blocking and the listener is enabled after it is created.
+// The callback function is called with the non-blocking fd and the peer address
+// of every accepted connection. The fd is owned by the callback.
+func NewListener(base *EventBase, network, address string, callback func(fd int, sa syscall.Sockaddr, arg interface{}), arg interface{}) (*Listener, error) {
+	family, sa, err := resolveSockaddr(network, address)
+	if err != nil {
+		return nil, err
+	}
+	fd, err := listenSocket(family, sa, false)
+	if err != nil {
+		return nil, err
+	}
+	path := ""
+	if family == syscall.AF_UNIX {
+		path = address
+	}
+	return newListener(base, fd, network, address, path, callback, arg)
+}
+
+// NewListenerFd creates a new listener of the listening socket fd.
+// The fd is set to non-blocking and owned by the listener, so it is closed if this fails.
+// A unix socket path is removed when the listener is closed.
+func NewListenerFd(base *EventBase, fd int, callback func(fd int, sa syscall.Sockaddr, arg interface{}), arg interface{}) (*Listener, error) {
+	if err := syscall.SetNonblock(fd, true); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+	sa, err := syscall.Getsockname(fd)
+	if err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+	network, address, path := sockaddrNetwork(sa)
+	return newListener(base, fd, network, address, path, callback, arg)
+}
+
+// newListener creates a listener of the listening socket fd, which is closed if this fails.
+func newListener(base *EventBase, fd int, network, address, path string, callback func(fd int, sa syscall.Sockaddr, arg interface{}), arg interface{}) (*Listener, error) {
+	ln := initListener(base, fd, network, address, path, callback, arg)
+	if err := ln.Enable(); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+// initListener creates a disabled listener of the listening socket fd.
+func initListener(base *EventBase, fd int, network, address, path string, callback func(fd int, sa syscall.Sockaddr, arg interface{}), arg interface{}) *Listener {
+	ln := new(Listener)
+	ln.fd = fd
+	ln.network = network
+	ln.address = address
+	ln.path = path
+	ln.cb = callback
+	ln.arg = arg
+	ln.reserveFd = openReserveFd()
+	ln.ev = New(base, fd, EvRead|EvPersist, ln.onAccept, nil)
+	ln.timer = NewTimer(base, ln.onResume, nil)
+	return ln
+}
+
+// SetErrorCallback sets the callback function when accepting fails.
+// Such as EMFILE when the process runs out of file descriptors.
+// In that case the pending connection is dropped by releasing a reserved fd
+// and the listener is paused for a while before it accepts again.
+func (ln *Listener) SetErrorCallback(callback func(err error, arg interface{})) {
+	ln.errCb = callback
+}
+
+// Enable starts accepting connections.
+func (ln *Listener) Enable() error {
+	ln.enabled = true
+	if ln.ev.flags&evListInserted != 0 || ln.timer.flags&evListInserted != 0 {
+		return nil
+	}
+	return ln.ev.Attach(0)
+}
+
+// Disable stops accepting connections.
+// The pending connections stay in the backlog until the listener is enabled again.
+func (ln *Listener) Disable() error {
+	ln.enabled = false
+	if ln.timer.flags&evListInserted != 0 {
+		ln.timer.Detach()
+	}
+	if ln.ev.flags&evListInserted == 0 {
+		return nil
+	}
+	return ln.ev.Detach()
+}
+
+// Fd returns the file descriptor of the listening socket.
+func (ln *Listener) Fd() int {
+	return ln.fd
+}
+
+// Addr returns the local address of the listening socket.
+func (ln *Listener) Addr() (syscall.Sockaddr, error) {
+	return syscall.Getsockname(ln.fd)
+}
+
+// Close disables the listener and closes the listening socket.
+func (ln *Listener) Close() error {
+	ln.Disable()
+	err := syscall.Close(ln.fd)
+	if ln.reserveFd >= 0 {
+		syscall.Close(ln.reserveFd)
+		ln.reserveFd = -1
+	}
+	if ln.path != "" {
+		syscall.Unlink(ln.path)
+	}
+	return err
+}
+
+func (ln *Listener) onAccept(fd int, events uint32, arg interface{}) {
+	for ln.ev.flags&evListInserted != 0 {
+		nfd, sa, err := accept(fd)
+		if err != nil {
+			if err == syscall.EAGAIN {
+				return
+			}
+			if err == syscall.EINTR || err == syscall.ECONNABORTED {
+				continue
+			}
+			if err == syscall.EMFILE || err == syscall.ENFILE {
+				ln.dropPending()
+				ln.pause()
+			}
+			if ln.errCb != nil {
+				ln.errCb(err, ln.arg)
+			}
+			return
+		}
+		ln.backoff = 0
+		ln.cb(nfd, sa, ln.arg)
+	}
+}
+
+func (ln *Listener) onResume(fd int, events uint32, arg interface{}) {
+	if ln.enabled {
+		ln.ev.Attach(0)
+	}
+}
+
+// dropPending accepts and closes the pending connection with the reserved fd.
+// So that the peer is not left waiting in the backlog.
+func (ln *Listener) dropPending() {
+	if ln.reserveFd < 0 {
+		ln.reserveFd = openReserveFd()
+		return
+	}
+	syscall.Close(ln.reserveFd)
+	if nfd, _, err := accept(ln.fd); err == nil {
+		syscall.Close(nfd)
+	}
+	ln.reserveFd = openReserveFd()
+}
+
+// pause detaches the listener and resumes it after the backoff.
+// The backoff doubles every time the listener is paused without accepting.
+func (ln *Listener) pause() {
+	if ln.backoff == 0 {
+		ln.backoff = minAcceptBackoff
+	} else if ln.backoff < maxAcceptBackoff {
+		ln.backoff <<= 1
+		if ln.backoff > maxAcceptBackoff {
+			ln.backoff = maxAcceptBackoff
+		}
+	}
+	ln.ev.Detach()
+	ln.timer.Attach(ln.backoff)
+}
+
+// listenSocket creates a non-blocking listening socket bound to the address.
+// The reusePort option lets multiple sockets bind to the same address by SO_REUSEPORT.
+func listenSocket(family int, sa syscall.Sockaddr, reusePort bool) (int, error) {
+	fd, err := socket(family, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		return -1, err
+	}
+	if family != syscall.AF_UNIX {
+		if err := syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_REUSEADDR, 1); err != nil {
+			syscall.Close(fd)
+			return -1, err
+		}
+		if reusePort {
+			if err := syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, soReusePort, 1); err != nil {
+				syscall.Close(fd)
+				return -1, err
+			}
+		}
+	}
+	if err := syscall.Bind(fd, sa); err != nil {
+		syscall.Close(fd)
+		return -1, err
+	}
+	if err := syscall.Listen(fd, syscall.SOMAXCONN); err != nil {
+		syscall.Close(fd)
+		return -1, err
+	}
+	return fd, nil
+}
+
+func openReserveFd() int {
+	fd, err := syscall.Open("/dev/null", syscall.O_RDONLY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return -1
+	}
+	return fd
+}
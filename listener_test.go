@@ -0,0 +1,232 @@
+// Copyright (c) 2023 cheng-zhongliang. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package event_test
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	. "github.com/cheng-zhongliang/event"
+)
+
+func TestListener(t *testing.T) {
+	base, err := NewBase()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n := 0
+	ln, err := NewListener(base, "tcp", "127.0.0.1:0", func(fd int, sa syscall.Sockaddr, arg interface{}) {
+		if _, ok := sa.(*syscall.SockaddrInet4); !ok {
+			t.Fatal("peer address not inet4")
+		}
+		if arg != "hello" {
+			t.Fatal("arg not equal")
+		}
+		syscall.Close(fd)
+		n++
+	}, "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sa, err := ln.Addr()
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: sa.(*syscall.SockaddrInet4).Port}
+
+	for i := 0; i < 3; i++ {
+		conn, err := net.DialTCP("tcp", nil, addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+	}
+
+	if err := base.Loop(EvLoopOnce); err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 3 {
+		t.Fatalf("accepted %d connections, want 3", n)
+	}
+
+	if err := ln.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := base.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestListenerUnix(t *testing.T) {
+	base, err := NewBase()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "event")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "event.sock")
+
+	n := 0
+	ln, err := NewListener(base, "unix", path, func(fd int, sa syscall.Sockaddr, arg interface{}) {
+		syscall.Close(fd)
+		n++
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if err := ln.Disable(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := base.Loop(EvLoopOnce | EvLoopNoblock); err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 0 {
+		t.Fatal("accepted while disabled")
+	}
+
+	if err := ln.Enable(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := base.Loop(EvLoopOnce); err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 1 {
+		t.Fatalf("accepted %d connections, want 1", n)
+	}
+
+	if err := ln.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatal("unix socket not removed")
+	}
+
+	if err := base.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestListenerEMFILE(t *testing.T) {
+	base, err := NewBase()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n := 0
+	ln, err := NewListener(base, "tcp", "127.0.0.1:0", func(fd int, sa syscall.Sockaddr, arg interface{}) {
+		syscall.Close(fd)
+		n++
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errs := 0
+	ln.SetErrorCallback(func(err error, arg interface{}) {
+		if err != syscall.EMFILE {
+			t.Fatal(err)
+		}
+		errs++
+	})
+
+	sa, err := ln.Addr()
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: sa.(*syscall.SockaddrInet4).Port}
+
+	conn, err := net.DialTCP("tcp", nil, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	var rlim syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rlim); err != nil {
+		t.Fatal(err)
+	}
+	lim := rlim
+	lim.Cur = 128
+	if err := syscall.Setrlimit(syscall.RLIMIT_NOFILE, &lim); err != nil {
+		t.Fatal(err)
+	}
+	var fds []int
+	for {
+		fd, err := syscall.Dup(ln.Fd())
+		if err != nil {
+			break
+		}
+		fds = append(fds, fd)
+	}
+
+	if err := base.Loop(EvLoopOnce); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, fd := range fds {
+		syscall.Close(fd)
+	}
+	if err := syscall.Setrlimit(syscall.RLIMIT_NOFILE, &rlim); err != nil {
+		t.Fatal(err)
+	}
+
+	if errs != 1 || n != 0 {
+		t.Fatalf("errs %d accepted %d, want 1 and 0", errs, n)
+	}
+
+	if _, err := conn.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatal("pending connection not dropped")
+	}
+
+	conn1, err := net.DialTCP("tcp", nil, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn1.Close()
+
+	for deadline := time.Now().Add(time.Second); n == 0 && time.Now().Before(deadline); {
+		if err := base.Loop(EvLoopOnce); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n != 1 {
+		t.Fatal("listener not resumed")
+	}
+
+	if err := ln.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := base.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+}
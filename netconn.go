@@ -0,0 +1,378 @@
+// Copyright (c) 2023 cheng-zhongliang. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package event
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// maxNetConnBuffer is the size of the buffered input which pauses reading from the socket.
+	maxNetConnBuffer = 1 << 16
+)
+
+var (
+	ErrNotSyscallConn = errors.New("not a syscall.Conn")
+	ErrNetConnClosed  = errors.New("use of closed network connection")
+)
+
+// timeoutError is the error when the deadline of a net.Conn is exceeded.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+// DupFd returns a duplicate of the fd of the Go socket or file,
+// such as *net.TCPConn, *net.TCPListener, *net.UnixConn or *os.File.
+// The duplicate is non-blocking, close-on-exec and owned by the caller.
+// The original can be closed independently.
+func DupFd(c syscall.Conn) (int, error) {
+	rc, err := c.SyscallConn()
+	if err != nil {
+		return -1, err
+	}
+	nfd := -1
+	var dupErr error
+	err = rc.Control(func(fd uintptr) {
+		syscall.ForkLock.RLock()
+		nfd, dupErr = syscall.Dup(int(fd))
+		if dupErr == nil {
+			syscall.CloseOnExec(nfd)
+		}
+		syscall.ForkLock.RUnlock()
+	})
+	if err != nil {
+		return -1, err
+	}
+	if dupErr != nil {
+		return -1, dupErr
+	}
+	if err := syscall.SetNonblock(nfd, true); err != nil {
+		syscall.Close(nfd)
+		return -1, err
+	}
+	return nfd, nil
+}
+
+// NewListenerFrom creates a listener of the listening socket of the Go listener.
+// The socket is duplicated, so the Go listener can be closed afterwards.
+// The unix socket path is removed when the listener is closed, instead of the Go listener.
+func NewListenerFrom(base *EventBase, l net.Listener, callback func(fd int, sa syscall.Sockaddr, arg interface{}), arg interface{}) (*Listener, error) {
+	sc, ok := l.(syscall.Conn)
+	if !ok {
+		return nil, ErrNotSyscallConn
+	}
+	fd, err := DupFd(sc)
+	if err != nil {
+		return nil, err
+	}
+	ln, err := NewListenerFd(base, fd, callback, arg)
+	if err != nil {
+		return nil, err
+	}
+	if ul, ok := l.(*net.UnixListener); ok {
+		ul.SetUnlinkOnClose(false)
+	}
+	return ln, nil
+}
+
+// netConn is the net.Conn of a socket served by the event loop.
+type netConn struct {
+	// base is the event base serving the socket.
+	base *EventBase
+	// fd is the socket.
+	fd int
+	// rev is the read event of the socket.
+	rev *Event
+	// wev is the write event of the socket.
+	wev *Event
+	// laddr is the local address.
+	laddr net.Addr
+	// raddr is the remote address.
+	raddr net.Addr
+	// mu guards the fields below, shared by the loop and the callers.
+	mu sync.Mutex
+	// in is the bytes read from the socket.
+	in Buffer
+	// out is the bytes to write to the socket.
+	out Buffer
+	// queued is the total number of the bytes queued to write.
+	queued int64
+	// written is the total number of the bytes written.
+	written int64
+	// rerr is the error of reading.
+	rerr error
+	// werr is the error of writing.
+	werr error
+	// closed reports whether the connection is closed by the caller.
+	closed bool
+	// fdClosed reports whether the socket is closed by the loop.
+	fdClosed bool
+	// notify is closed and replaced when the state changes.
+	notify chan struct{}
+	// rdeadline is the deadline of reading.
+	rdeadline time.Time
+	// wdeadline is the deadline of writing.
+	wdeadline time.Time
+}
+
+// NewNetConn wraps the connected non-blocking socket into a net.Conn whose Read and Write
+// are served by the event loop. The socket is owned by the net.Conn.
+// It must be called in the goroutine of the loop, or before the loop runs.
+// The net.Conn can be used from any goroutine while the loop runs.
+func NewNetConn(base *EventBase, fd int) (net.Conn, error) {
+	c := &netConn{base: base, fd: fd, notify: make(chan struct{})}
+	if sa, err := syscall.Getsockname(fd); err == nil {
+		c.laddr = sockaddrToAddr(sa)
+	}
+	if sa, err := syscall.Getpeername(fd); err == nil {
+		c.raddr = sockaddrToAddr(sa)
+	}
+	c.rev = New(base, fd, EvRead|EvPersist, c.onRead, nil)
+	c.wev = New(base, fd, EvWrite|EvPersist, c.onWrite, nil)
+	if err := c.rev.Attach(0); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *netConn) Read(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for {
+		if c.closed {
+			return 0, ErrNetConnClosed
+		}
+		if c.in.Len() > 0 {
+			full := c.in.Len() >= maxNetConnBuffer
+			n := copy(p, c.in.Bytes())
+			c.in.Drain(n)
+			if full && c.in.Len() < maxNetConnBuffer {
+				if err := c.post(); err != nil {
+					return n, err
+				}
+			}
+			return n, nil
+		}
+		if c.rerr != nil {
+			return 0, c.rerr
+		}
+		if !c.wait(c.rdeadline) {
+			return 0, timeoutError{}
+		}
+	}
+}
+
+func (c *netConn) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return 0, ErrNetConnClosed
+	}
+	if c.werr != nil {
+		return 0, c.werr
+	}
+	if !c.wdeadline.IsZero() && !time.Now().Before(c.wdeadline) {
+		return 0, timeoutError{}
+	}
+	c.out.Write(p)
+	c.queued += int64(len(p))
+	target := c.queued
+	if err := c.post(); err != nil {
+		return 0, err
+	}
+	for c.written < target {
+		n := len(p) - int(target-c.written)
+		if n < 0 {
+			n = 0
+		}
+		if c.closed {
+			return n, ErrNetConnClosed
+		}
+		if c.werr != nil {
+			return n, c.werr
+		}
+		if !c.wait(c.wdeadline) {
+			return n, timeoutError{}
+		}
+	}
+	return len(p), nil
+}
+
+func (c *netConn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return ErrNetConnClosed
+	}
+	c.closed = true
+	c.broadcast()
+	if err := c.post(); err != nil {
+		if err != ErrBaseShutdown || c.fdClosed {
+			return err
+		}
+		// the loop is gone, so the socket is closed here.
+		c.fdClosed = true
+		return syscall.Close(c.fd)
+	}
+	return nil
+}
+
+func (c *netConn) LocalAddr() net.Addr {
+	return c.laddr
+}
+
+func (c *netConn) RemoteAddr() net.Addr {
+	return c.raddr
+}
+
+func (c *netConn) SetDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.rdeadline = t
+	c.wdeadline = t
+	c.broadcast()
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *netConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.rdeadline = t
+	c.broadcast()
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *netConn) SetWriteDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.wdeadline = t
+	c.broadcast()
+	c.mu.Unlock()
+	return nil
+}
+
+// wait waits for the state to change with the lock released.
+// It returns false if the deadline is exceeded.
+func (c *netConn) wait(deadline time.Time) bool {
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		d := time.Until(deadline)
+		if d <= 0 {
+			return false
+		}
+		t := time.NewTimer(d)
+		defer t.Stop()
+		timeout = t.C
+	}
+	ch := c.notify
+	c.mu.Unlock()
+	defer c.mu.Lock()
+	select {
+	case <-ch:
+		return true
+	case <-timeout:
+		return false
+	}
+}
+
+// broadcast wakes up the waiting callers. It is called with the lock held.
+func (c *netConn) broadcast() {
+	close(c.notify)
+	c.notify = make(chan struct{})
+}
+
+// post queues update to run in the loop. It is called with the lock held.
+// If the base is shut down, the callers fail with ErrBaseShutdown.
+func (c *netConn) post() error {
+	err := c.base.post(&task{fn: c.update, cancel: c.cancel})
+	if err != nil {
+		c.fail(err)
+	}
+	return err
+}
+
+// cancel fails the callers and closes the socket if it is closed by the caller,
+// when the base is shut down before update runs. It runs in the loop.
+func (c *netConn) cancel() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.fail(ErrBaseShutdown)
+	if c.closed && !c.fdClosed {
+		c.fdClosed = true
+		c.rev.Detach()
+		c.wev.Detach()
+		syscall.Close(c.fd)
+	}
+}
+
+// fail sets the error of reading and writing, and wakes up the waiting callers.
+// It is called with the lock held.
+func (c *netConn) fail(err error) {
+	if c.rerr == nil {
+		c.rerr = err
+	}
+	if c.werr == nil {
+		c.werr = err
+	}
+	c.broadcast()
+}
+
+// update attaches or detaches the events by the state. It runs in the loop.
+func (c *netConn) update() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.fdClosed {
+		return
+	}
+	if c.closed {
+		c.fdClosed = true
+		c.rev.Detach()
+		c.wev.Detach()
+		syscall.Close(c.fd)
+		return
+	}
+	if c.out.Len() > 0 {
+		c.wev.Attach(0)
+	}
+	if c.rerr == nil && c.in.Len() < maxNetConnBuffer {
+		c.rev.Attach(0)
+	}
+}
+
+func (c *netConn) onRead(fd int, events uint32, arg interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err := c.in.ReadFd(fd)
+	if err == syscall.EAGAIN {
+		return
+	}
+	if err != nil {
+		c.rerr = err
+		c.rev.Detach()
+	} else if c.in.Len() >= maxNetConnBuffer {
+		c.rev.Detach()
+	}
+	c.broadcast()
+}
+
+func (c *netConn) onWrite(fd int, events uint32, arg interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n, err := c.out.WriteFd(fd)
+	c.written += int64(n)
+	if err != nil && err != syscall.EAGAIN {
+		c.werr = err
+		c.out.Reset()
+	}
+	if c.out.Len() == 0 {
+		c.wev.Detach()
+	}
+	c.broadcast()
+}
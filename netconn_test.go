@@ -0,0 +1,231 @@
+// Copyright (c) 2023 cheng-zhongliang. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package event_test
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	. "github.com/cheng-zhongliang/event"
+)
+
+// loopInBackground runs the event loop in a goroutine until the returned function is called.
+func loopInBackground(t *testing.T, base *EventBase) func() {
+	stopped := int32(0)
+	done := make(chan error)
+	ticker := NewTicker(base, func(fd int, events uint32, arg interface{}) {}, nil)
+	if err := ticker.Attach(5 * time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for atomic.LoadInt32(&stopped) == 0 {
+			if err := base.Loop(EvLoopOnce); err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- nil
+	}()
+	return func() {
+		atomic.StoreInt32(&stopped, 1)
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestNetConn(t *testing.T) {
+	base, err := NewBase()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.SetNonblock(fds[0], true); err != nil {
+		t.Fatal(err)
+	}
+	conn, err := NewNetConn(base, fds[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := os.NewFile(uintptr(fds[1]), "peer")
+	peer, err := net.FileConn(f)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peer.Close()
+
+	stop := loopInBackground(t, base)
+
+	data := bytes.Repeat([]byte("0123456789"), 1<<16)
+	go func() {
+		peer.Write(data)
+		peer.Close()
+	}()
+	got, err := ioutil.ReadAll(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatalf("read %d bytes, want %d", len(got), len(data))
+	}
+
+	conn.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+	if _, err := conn.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("error %v, want EOF", err)
+	}
+	if err := conn.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Write([]byte("x")); err != ErrNetConnClosed {
+		t.Fatalf("error %v, want %v", err, ErrNetConnClosed)
+	}
+
+	stop()
+	if err := base.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNetConnDeadline(t *testing.T) {
+	base, err := NewBase()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer syscall.Close(fds[1])
+	if err := syscall.SetNonblock(fds[0], true); err != nil {
+		t.Fatal(err)
+	}
+	conn, err := NewNetConn(base, fds[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stop := loopInBackground(t, base)
+
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 8)
+	if n, _ := syscall.Read(fds[1], buf); string(buf[:n]) != "ping" {
+		t.Fatalf("read %q, want ping", buf[:n])
+	}
+
+	conn.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+	_, err = conn.Read(buf)
+	if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+		t.Fatalf("error %v, want timeout", err)
+	}
+	conn.Close()
+
+	stop()
+	if err := base.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNetConnShutdown(t *testing.T) {
+	base, err := NewBase()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer syscall.Close(fds[1])
+	if err := syscall.SetNonblock(fds[0], true); err != nil {
+		t.Fatal(err)
+	}
+	conn, err := NewNetConn(base, fds[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := base.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the callers fail instead of waiting for the loop which is gone.
+	done := make(chan error)
+	go func() {
+		_, err := conn.Write([]byte("ping"))
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != ErrBaseShutdown {
+			t.Fatalf("error %v, want %v", err, ErrBaseShutdown)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("write not returned")
+	}
+	if _, err := conn.Read(make([]byte, 1)); err != ErrBaseShutdown {
+		t.Fatalf("error %v, want %v", err, ErrBaseShutdown)
+	}
+
+	// the socket is closed by Close, so the peer reads EOF.
+	if err := conn.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := syscall.Read(fds[1], make([]byte, 1)); n != 0 || err != nil {
+		t.Fatalf("read %d %v, want EOF", n, err)
+	}
+}
+
+func TestNewListenerFrom(t *testing.T) {
+	base, err := NewBase()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	accepted := 0
+	ln, err := NewListenerFrom(base, l, func(fd int, sa syscall.Sockaddr, arg interface{}) {
+		accepted++
+		syscall.Close(fd)
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err := base.Loop(EvLoopOnce); err != nil {
+		t.Fatal(err)
+	}
+	if accepted != 1 {
+		t.Fatalf("accepted %d, want 1", accepted)
+	}
+
+	ln.Close()
+	if err := base.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright (c) 2023 cheng-zhongliang. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package event
+
+import (
+	"errors"
+	"sync"
+	"syscall"
+)
+
+var ErrNotifierClosed = errors.New("notifier closed")
+
+// Notifier is an event triggered from any goroutine.
+// It uses eventfd on Linux and EVFILT_USER on kqueue.
+type Notifier struct {
+	// count is the triggers not reported yet, unused with eventfd.
+	// It is the first field to be 64-bit aligned for the atomic operations.
+	count uint64
+	// ev is the read event of the notifier fd.
+	ev *Event
+	// fd is the eventfd, the private kqueue or the read end of the pipe.
+	fd int
+	// wfd is the write end of the pipe, or -1.
+	wfd int
+	// mu guards the fds against closing while triggering.
+	mu sync.RWMutex
+	// closed reports whether the notifier is closed.
+	closed bool
+	// cb is the callback function when the notifier is triggered.
+	cb func(count uint64, arg interface{})
+	// arg is the argument passed to the callback function.
+	arg interface{}
+}
+
+// NewNotifier creates a notifier on the event base.
+// The callback function is called in the loop once per batch of triggers,
+// with the number of the triggers coalesced into the batch.
+func NewNotifier(base *EventBase, callback func(count uint64, arg interface{}), arg interface{}) (*Notifier, error) {
+	fd, wfd, err := openNotifyFds()
+	if err != nil {
+		return nil, err
+	}
+	n := &Notifier{fd: fd, wfd: wfd, cb: callback, arg: arg}
+	n.ev = New(base, fd, EvRead|EvPersist, n.onNotify, nil)
+	if err := n.ev.Attach(0); err != nil {
+		n.closeFds()
+		return nil, err
+	}
+	return n, nil
+}
+
+// Trigger wakes up the loop to call the callback function.
+// It is safe to call from any goroutine.
+func (n *Notifier) Trigger() error {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	if n.closed {
+		return ErrNotifierClosed
+	}
+	return n.trigger()
+}
+
+// Close detaches the notifier and releases its fds.
+// It must be called in the goroutine of the loop.
+func (n *Notifier) Close() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.closed {
+		return ErrNotifierClosed
+	}
+	n.closed = true
+	n.ev.Detach()
+	return n.closeFds()
+}
+
+func (n *Notifier) onNotify(fd int, events uint32, arg interface{}) {
+	if count := n.drain(); count > 0 {
+		n.cb(count, n.arg)
+	}
+}
+
+func (n *Notifier) closeFds() error {
+	if n.wfd >= 0 {
+		syscall.Close(n.wfd)
+	}
+	return syscall.Close(n.fd)
+}
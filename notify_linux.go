@@ -0,0 +1,41 @@
+// Copyright (c) 2023 cheng-zhongliang. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build linux
+// +build linux
+
+package event
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// openNotifyFds returns a non-blocking and close-on-exec eventfd, which counts the triggers.
+func openNotifyFds() (int, int, error) {
+	fd, _, errno := syscall.Syscall(syscall.SYS_EVENTFD2, 0, syscall.O_NONBLOCK|syscall.O_CLOEXEC, 0)
+	if errno != 0 {
+		return -1, -1, errno
+	}
+	return int(fd), -1, nil
+}
+
+func (n *Notifier) trigger() error {
+	one := uint64(1)
+	_, err := syscall.Write(n.fd, (*[8]byte)(unsafe.Pointer(&one))[:])
+	if err == syscall.EAGAIN {
+		// the counter is saturated, the loop is woken up anyway.
+		return nil
+	}
+	return err
+}
+
+// drain reads and resets the counter of the eventfd.
+func (n *Notifier) drain() uint64 {
+	var count uint64
+	if _, err := syscall.Read(n.fd, (*[8]byte)(unsafe.Pointer(&count))[:]); err != nil {
+		return 0
+	}
+	return count
+}
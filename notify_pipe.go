@@ -0,0 +1,40 @@
+// Copyright (c) 2023 cheng-zhongliang. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build dragonfly || netbsd || openbsd
+// +build dragonfly netbsd openbsd
+
+package event
+
+import (
+	"sync/atomic"
+	"syscall"
+)
+
+// openNotifyFds returns a pipe, as EVFILT_USER is not available.
+func openNotifyFds() (int, int, error) {
+	return pipe()
+}
+
+// trigger writes a byte by the first trigger of a batch.
+func (n *Notifier) trigger() error {
+	if atomic.AddUint64(&n.count, 1) > 1 {
+		return nil
+	}
+	_, err := syscall.Write(n.wfd, []byte{0})
+	if err == syscall.EAGAIN {
+		return nil
+	}
+	return err
+}
+
+func (n *Notifier) drain() uint64 {
+	var buf [64]byte
+	for {
+		if m, _ := syscall.Read(n.fd, buf[:]); m < len(buf) {
+			break
+		}
+	}
+	return atomic.SwapUint64(&n.count, 0)
+}
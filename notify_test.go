@@ -0,0 +1,70 @@
+// Copyright (c) 2023 cheng-zhongliang. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package event_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/cheng-zhongliang/event"
+)
+
+func TestNotifier(t *testing.T) {
+	base, err := NewBase()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	total, calls := uint64(0), 0
+	n, err := NewNotifier(base, func(count uint64, arg interface{}) {
+		total += count
+		calls++
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const goroutines, triggers = 4, 250
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < triggers; j++ {
+				if err := n.Trigger(); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+
+	for deadline := time.Now().Add(time.Second); total < goroutines*triggers; {
+		if time.Now().After(deadline) {
+			t.Fatalf("triggers %d, want %d", total, goroutines*triggers)
+		}
+		if err := base.Loop(EvLoopOnce); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wg.Wait()
+	if total != goroutines*triggers {
+		t.Fatalf("triggers %d, want %d", total, goroutines*triggers)
+	}
+	if calls > goroutines*triggers {
+		t.Fatalf("calls %d, more than the triggers", calls)
+	}
+
+	if err := n.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Trigger(); err != ErrNotifierClosed {
+		t.Fatalf("error %v, want %v", err, ErrNotifierClosed)
+	}
+	if err := base.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,42 @@
+// Copyright (c) 2023 cheng-zhongliang. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build darwin || freebsd
+// +build darwin freebsd
+
+package event
+
+import (
+	"sync/atomic"
+	"syscall"
+)
+
+// userIdent is the ident of the EVFILT_USER filter in the private kqueue.
+const userIdent = 1
+
+// openNotifyFds returns a private kqueue with the EVFILT_USER filter.
+func openNotifyFds() (int, int, error) {
+	var change syscall.Kevent_t
+	syscall.SetKevent(&change, userIdent, syscall.EVFILT_USER, syscall.EV_ADD|syscall.EV_CLEAR)
+	fd, err := openKqueue(change)
+	return fd, -1, err
+}
+
+// trigger fires the filter by the first trigger of a batch.
+func (n *Notifier) trigger() error {
+	if atomic.AddUint64(&n.count, 1) > 1 {
+		return nil
+	}
+	var change syscall.Kevent_t
+	syscall.SetKevent(&change, userIdent, syscall.EVFILT_USER, 0)
+	change.Fflags = syscall.NOTE_TRIGGER
+	_, err := syscall.Kevent(n.fd, []syscall.Kevent_t{change}, nil, nil)
+	return err
+}
+
+func (n *Notifier) drain() uint64 {
+	var changes [1]syscall.Kevent_t
+	readKqueue(n.fd, changes[:])
+	return atomic.SwapUint64(&n.count, 0)
+}
@@ -0,0 +1,50 @@
+// Copyright (c) 2023 cheng-zhongliang. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package event
+
+import (
+	"runtime/debug"
+)
+
+// PanicHandler is the handler of a panic recovered from a callback function.
+// The event is nil for the functions run by Post.
+type PanicHandler func(ev *Event, recovered interface{}, stack []byte)
+
+// SetPanicHandler makes the loop recover the panics of the callback functions and
+// pass them to the handler, instead of tearing down the loop.
+// If detach is set, the event whose callback function panics is detached.
+// A nil handler disables the recovery.
+func (bs *EventBase) SetPanicHandler(handler PanicHandler, detach bool) {
+	bs.panicHandler = handler
+	bs.detachOnPanic = detach
+}
+
+// runCallback calls the callback function of the event, recovering the panic if it is enabled.
+func (bs *EventBase) runCallback(ev *Event) {
+	if bs.panicHandler != nil {
+		defer bs.recoverPanic(ev)
+	}
+	ev.cb(ev.fd, ev.res, ev.arg)
+}
+
+// runTask runs the posted function, recovering the panic if it is enabled.
+func (bs *EventBase) runTask(fn func()) {
+	if bs.panicHandler != nil {
+		defer bs.recoverPanic(nil)
+	}
+	fn()
+}
+
+func (bs *EventBase) recoverPanic(ev *Event) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	stack := debug.Stack()
+	if ev != nil && bs.detachOnPanic {
+		ev.Detach()
+	}
+	bs.panicHandler(ev, r, stack)
+}
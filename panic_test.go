@@ -0,0 +1,83 @@
+// Copyright (c) 2023 cheng-zhongliang. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package event_test
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/cheng-zhongliang/event"
+)
+
+func TestPanicHandler(t *testing.T) {
+	base, err := NewBase()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var events []*Event
+	var recovered []interface{}
+	base.SetPanicHandler(func(ev *Event, r interface{}, stack []byte) {
+		if !strings.Contains(string(stack), "panic_test.go") {
+			t.Errorf("stack without the callback:\n%s", stack)
+		}
+		events = append(events, ev)
+		recovered = append(recovered, r)
+	}, true)
+
+	ticker := NewTicker(base, func(fd int, events uint32, arg interface{}) {
+		panic("ticker")
+	}, nil)
+	if err := ticker.Attach(0); err != nil {
+		t.Fatal(err)
+	}
+	fired := 0
+	timer := NewTimer(base, func(fd int, events uint32, arg interface{}) {
+		fired++
+	}, nil)
+	if err := timer.Attach(0); err != nil {
+		t.Fatal(err)
+	}
+	base.Post(func() {
+		panic("task")
+	})
+	posted := false
+	base.Post(func() {
+		posted = true
+	})
+
+	for i := 0; i < 3; i++ {
+		if err := base.Loop(EvLoopOnce | EvLoopNoblock); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if fired != 1 || !posted {
+		t.Fatalf("timer fired %d, task run %v", fired, posted)
+	}
+	if len(recovered) != 2 {
+		t.Fatalf("recovered %v, want the task and the ticker once", recovered)
+	}
+	for i, r := range recovered {
+		switch r {
+		case "task":
+			if events[i] != nil {
+				t.Fatalf("event %v of the task", events[i])
+			}
+		case "ticker":
+			if events[i] != ticker {
+				t.Fatalf("event %v, want the ticker", events[i])
+			}
+		default:
+			t.Fatalf("recovered %v", r)
+		}
+	}
+	if err := ticker.Detach(); err != ErrEventNotExists {
+		t.Fatalf("error %v, want the ticker detached", err)
+	}
+
+	if err := base.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+}
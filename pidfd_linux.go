@@ -0,0 +1,11 @@
+// Copyright (c) 2023 cheng-zhongliang. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build linux && !mips && !mipsle && !mips64 && !mips64le
+// +build linux,!mips,!mipsle,!mips64,!mips64le
+
+package event
+
+// sysPidfdOpen is the number of pidfd_open in the unified syscall table.
+const sysPidfdOpen = 434
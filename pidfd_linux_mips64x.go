@@ -0,0 +1,12 @@
+// Copyright (c) 2023 cheng-zhongliang. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build linux && (mips64 || mips64le)
+// +build linux
+// +build mips64 mips64le
+
+package event
+
+// sysPidfdOpen is the number of pidfd_open in the n64 syscall table.
+const sysPidfdOpen = 5434
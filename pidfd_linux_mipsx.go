@@ -0,0 +1,12 @@
+// Copyright (c) 2023 cheng-zhongliang. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build linux && (mips || mipsle)
+// +build linux
+// +build mips mipsle
+
+package event
+
+// sysPidfdOpen is the number of pidfd_open in the o32 syscall table.
+const sysPidfdOpen = 4434
@@ -0,0 +1,188 @@
+// Copyright (c) 2023 cheng-zhongliang. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package event
+
+import (
+	"errors"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// The policies when the queue of the worker pool is full.
+const (
+	// RejectAbort rejects the work with ErrPoolFull.
+	RejectAbort = iota
+	// RejectCallerRuns runs the work in the goroutine calling Go.
+	RejectCallerRuns
+	// RejectDiscardOldest discards the oldest queued work, whose done function
+	// is called with ErrWorkDiscarded as the result.
+	RejectDiscardOldest
+)
+
+const (
+	// DefaultPoolQueueSize is the default maximum number of the queued work.
+	DefaultPoolQueueSize = 1024
+)
+
+var (
+	ErrPoolFull      = errors.New("worker pool full")
+	ErrPoolStarted   = errors.New("worker pool started")
+	ErrWorkDiscarded = errors.New("work discarded")
+)
+
+// PoolConfig is the configuration of the worker pool of an event base.
+type PoolConfig struct {
+	// Workers is the number of the goroutines running the work.
+	// Zero means the number of the CPUs.
+	Workers int
+	// QueueSize is the maximum number of the work waiting for a worker.
+	// Zero means DefaultPoolQueueSize.
+	QueueSize int
+	// Policy is the policy when the queue is full. Default is RejectAbort.
+	Policy int
+}
+
+// pool is the worker pool running the work off the loop.
+type pool struct {
+	// base is the event base to call the done functions.
+	base *EventBase
+	// config is the configuration of the pool.
+	config PoolConfig
+	// works is the queue of the work.
+	works chan *work
+	// mu guards the queue against closing while submitting.
+	mu sync.RWMutex
+	// closed reports whether the pool is closed.
+	closed bool
+}
+
+// work is a function run by the worker pool.
+type work struct {
+	// fn is the function to run.
+	fn func() interface{}
+	// done is the function called in the loop with the result.
+	done func(result interface{})
+}
+
+// SetPool configures the worker pool used by Go. It fails once the pool is started.
+func (bs *EventBase) SetPool(config PoolConfig) error {
+	bs.poolMu.Lock()
+	defer bs.poolMu.Unlock()
+	if bs.pool != nil {
+		return ErrPoolStarted
+	}
+	bs.poolConfig = config
+	return nil
+}
+
+// Go runs the work in the worker pool and calls the done function in the loop with its result.
+// The pool is started by the first call. It is safe to call from any goroutine.
+// When the queue is full, the work is handled by the policy of the pool.
+// It returns ErrBaseShutdown after the base is shut down.
+func (bs *EventBase) Go(fn func() interface{}, done func(result interface{})) error {
+	p, err := bs.startPool()
+	if err != nil {
+		return err
+	}
+	return p.submit(&work{fn: fn, done: done})
+}
+
+func (bs *EventBase) startPool() (*pool, error) {
+	bs.poolMu.Lock()
+	defer bs.poolMu.Unlock()
+	if bs.pool != nil {
+		return bs.pool, nil
+	}
+	if atomic.LoadInt32(&bs.closed) != 0 {
+		return nil, ErrBaseShutdown
+	}
+	config := bs.poolConfig
+	if config.Workers <= 0 {
+		config.Workers = runtime.NumCPU()
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = DefaultPoolQueueSize
+	}
+	p := &pool{base: bs, config: config, works: make(chan *work, config.QueueSize)}
+	for i := 0; i < config.Workers; i++ {
+		go p.worker()
+	}
+	bs.pool = p
+	return p, nil
+}
+
+// closePool stops the workers after the queued work is run.
+func (bs *EventBase) closePool() {
+	bs.poolMu.Lock()
+	p := bs.pool
+	bs.poolMu.Unlock()
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.works)
+	}
+	p.mu.Unlock()
+}
+
+func (p *pool) submit(w *work) error {
+	p.mu.RLock()
+	if p.closed {
+		p.mu.RUnlock()
+		return ErrBaseShutdown
+	}
+	select {
+	case p.works <- w:
+		p.mu.RUnlock()
+		return nil
+	default:
+	}
+	if p.config.Policy == RejectCallerRuns {
+		// the work runs without the lock, which would block the shutdown.
+		p.mu.RUnlock()
+		p.run(w)
+		return nil
+	}
+	defer p.mu.RUnlock()
+	switch p.config.Policy {
+	case RejectDiscardOldest:
+		for {
+			select {
+			case old := <-p.works:
+				p.finish(old, ErrWorkDiscarded)
+			default:
+			}
+			select {
+			case p.works <- w:
+				return nil
+			default:
+			}
+		}
+	default:
+		return ErrPoolFull
+	}
+}
+
+func (p *pool) worker() {
+	for w := range p.works {
+		p.run(w)
+	}
+}
+
+func (p *pool) run(w *work) {
+	p.finish(w, w.fn())
+}
+
+// finish posts the done function of the work with the result to the loop.
+func (p *pool) finish(w *work, result interface{}) {
+	if w.done != nil {
+		p.base.Post(func() {
+			w.done(result)
+		})
+	}
+}
@@ -0,0 +1,186 @@
+// Copyright (c) 2023 cheng-zhongliang. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package event_test
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/cheng-zhongliang/event"
+)
+
+// loopUntil runs the loop until the condition holds.
+func loopUntil(t *testing.T, base *EventBase, cond func() bool) {
+	for deadline := time.Now().Add(time.Second); !cond(); {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not reached")
+		}
+		if err := base.Loop(EvLoopOnce); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestGo(t *testing.T) {
+	base, err := NewBase()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const works = 100
+	sum, done := 0, 0
+	for i := 1; i <= works; i++ {
+		i := i
+		err := base.Go(func() interface{} {
+			return i * i
+		}, func(result interface{}) {
+			sum += result.(int)
+			done++
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	loopUntil(t, base, func() bool { return done == works })
+	if want := works * (works + 1) * (2*works + 1) / 6; sum != want {
+		t.Fatalf("sum %d, want %d", sum, want)
+	}
+	if err := base.SetPool(PoolConfig{}); err != ErrPoolStarted {
+		t.Fatalf("error %v, want %v", err, ErrPoolStarted)
+	}
+
+	if err := base.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+	if err := base.Go(func() interface{} { return nil }, nil); err != ErrBaseShutdown {
+		t.Fatalf("error %v, want %v", err, ErrBaseShutdown)
+	}
+}
+
+func TestGoReject(t *testing.T) {
+	for _, policy := range []int{RejectAbort, RejectCallerRuns, RejectDiscardOldest} {
+		base, err := NewBase()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := base.SetPool(PoolConfig{Workers: 1, QueueSize: 1, Policy: policy}); err != nil {
+			t.Fatal(err)
+		}
+
+		// the first work occupies the worker and the second fills the queue.
+		started, release := make(chan struct{}), make(chan struct{})
+		results := map[interface{}]bool{}
+		record := func(result interface{}) {
+			results[result] = true
+		}
+		base.Go(func() interface{} {
+			close(started)
+			<-release
+			return 1
+		}, record)
+		<-started
+		base.Go(func() interface{} { return 2 }, record)
+
+		ran := false
+		err = base.Go(func() interface{} {
+			ran = true
+			return 3
+		}, record)
+		switch policy {
+		case RejectAbort:
+			if err != ErrPoolFull {
+				t.Fatalf("error %v, want %v", err, ErrPoolFull)
+			}
+		case RejectCallerRuns:
+			if err != nil || !ran {
+				t.Fatalf("error %v, ran %v", err, ran)
+			}
+		case RejectDiscardOldest:
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		close(release)
+
+		want := map[int][]interface{}{
+			RejectAbort:         {1, 2},
+			RejectCallerRuns:    {1, 2, 3},
+			RejectDiscardOldest: {1, ErrWorkDiscarded, 3},
+		}[policy]
+		loopUntil(t, base, func() bool { return len(results) == len(want) })
+		for _, result := range want {
+			if !results[result] {
+				t.Fatalf("policy %d: results %v, want %v", policy, results, want)
+			}
+		}
+
+		if err := base.Shutdown(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestGoCallerRunsShutdown(t *testing.T) {
+	base, err := NewBase()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := base.SetPool(PoolConfig{Workers: 1, QueueSize: 1, Policy: RejectCallerRuns}); err != nil {
+		t.Fatal(err)
+	}
+
+	loopDone := make(chan struct{})
+	go func() {
+		for base.Loop(EvLoopOnce) == nil {
+		}
+		close(loopDone)
+	}()
+
+	started, release := make(chan struct{}), make(chan struct{})
+	base.Go(func() interface{} {
+		close(started)
+		<-release
+		return nil
+	}, nil)
+	<-started
+	base.Go(func() interface{} { return nil }, nil)
+
+	// the base is shut down in the loop while the caller runs the work.
+	shut := false
+	err = base.Go(func() interface{} {
+		done := make(chan struct{})
+		base.Post(func() {
+			base.Shutdown()
+			close(done)
+		})
+		select {
+		case <-done:
+			shut = true
+		case <-time.After(time.Second):
+		}
+		return nil
+	}, nil)
+	close(release)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !shut {
+		t.Fatal("shutdown blocked by the work run by the caller")
+	}
+	<-loopDone
+}
+
+func TestGoAfterShutdown(t *testing.T) {
+	base, err := NewBase()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := base.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+	if err := base.Go(func() interface{} { return nil }, nil); err != ErrBaseShutdown {
+		t.Fatalf("error %v, want %v", err, ErrBaseShutdown)
+	}
+}
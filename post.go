@@ -0,0 +1,186 @@
+// Copyright (c) 2023 cheng-zhongliang. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package event
+
+import (
+	"runtime"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+// task is a function posted to run in the loop.
+type task struct {
+	// next is the next task in the queue.
+	next unsafe.Pointer
+	// fn is the function to run.
+	fn func()
+	// cancel is called instead of the function if the base is shut down before it runs.
+	cancel func()
+	// delay is the delay to run the function after it is posted.
+	delay time.Duration
+	// posted is the time when the task is posted with a delay.
+	posted time.Time
+}
+
+// taskQueue is a lock-free multi-producer single-consumer queue of tasks.
+// The producers push to the head, and the loop pops from the tail.
+type taskQueue struct {
+	// head is the task pushed last.
+	head unsafe.Pointer
+	// tail is the task to pop next, owned by the loop.
+	tail *task
+	// stub is the placeholder task which keeps the queue never empty.
+	stub task
+}
+
+func newTaskQueue() *taskQueue {
+	q := new(taskQueue)
+	q.head = unsafe.Pointer(&q.stub)
+	q.tail = &q.stub
+	return q
+}
+
+// push adds the task to the queue. It is safe to call from any goroutine.
+func (q *taskQueue) push(t *task) {
+	atomic.StorePointer(&t.next, nil)
+	prev := (*task)(atomic.SwapPointer(&q.head, unsafe.Pointer(t)))
+	atomic.StorePointer(&prev.next, unsafe.Pointer(t))
+}
+
+// pop removes the task pushed first. It returns nil if the queue is empty,
+// or the next task is being pushed.
+func (q *taskQueue) pop() *task {
+	tail := q.tail
+	next := (*task)(atomic.LoadPointer(&tail.next))
+	if tail == &q.stub {
+		if next == nil {
+			return nil
+		}
+		q.tail = next
+		tail = next
+		next = (*task)(atomic.LoadPointer(&tail.next))
+	}
+	if next != nil {
+		q.tail = next
+		return tail
+	}
+	if tail != (*task)(atomic.LoadPointer(&q.head)) {
+		return nil
+	}
+	q.push(&q.stub)
+	if next = (*task)(atomic.LoadPointer(&tail.next)); next != nil {
+		q.tail = next
+		return tail
+	}
+	return nil
+}
+
+// Post queues the function to run in the loop. It is safe to call from any goroutine.
+// The functions run in the order they are posted.
+// The functions not run yet when the base is shut down are dropped.
+func (bs *EventBase) Post(fn func()) error {
+	return bs.post(&task{fn: fn})
+}
+
+// PostDelayed queues the function to run in the loop after the delay.
+// It is safe to call from any goroutine.
+func (bs *EventBase) PostDelayed(delay time.Duration, fn func()) error {
+	return bs.post(&task{fn: fn, delay: delay, posted: time.Now()})
+}
+
+func (bs *EventBase) post(t *task) error {
+	// Shutdown waits for the posts which have not seen it to push their tasks.
+	atomic.AddInt32(&bs.posting, 1)
+	if atomic.LoadInt32(&bs.closed) != 0 {
+		atomic.AddInt32(&bs.posting, -1)
+		return ErrBaseShutdown
+	}
+	n, err := bs.loadNotifier()
+	if err != nil {
+		atomic.AddInt32(&bs.posting, -1)
+		return err
+	}
+	bs.tasks.push(t)
+	atomic.AddInt32(&bs.posting, -1)
+	// only the first post after the queue is drained wakes up the loop.
+	if !atomic.CompareAndSwapInt32(&bs.posted, 0, 1) {
+		return nil
+	}
+	// the trigger only fails when the base is shut down, which cancels the task.
+	n.Trigger()
+	return nil
+}
+
+// cancelTasks cancels the tasks not run when the base is shut down.
+func (bs *EventBase) cancelTasks() {
+	for atomic.LoadInt32(&bs.posting) != 0 {
+		runtime.Gosched()
+	}
+	for {
+		t := bs.tasks.pop()
+		if t == nil {
+			return
+		}
+		if t.cancel != nil {
+			t.cancel()
+		}
+	}
+}
+
+// loadNotifier returns the notifier of the base, creating it on the first call.
+// The notifier is watched without the state of the loop,
+// so it can be created while the loop is running in another goroutine.
+func (bs *EventBase) loadNotifier() (*Notifier, error) {
+	if n := (*Notifier)(atomic.LoadPointer(&bs.notifier)); n != nil {
+		return n, nil
+	}
+	bs.notifyMu.Lock()
+	defer bs.notifyMu.Unlock()
+	if n := (*Notifier)(atomic.LoadPointer(&bs.notifier)); n != nil {
+		return n, nil
+	}
+	if atomic.LoadInt32(&bs.closed) != 0 {
+		return nil, ErrBaseShutdown
+	}
+	fd, wfd, err := openNotifyFds()
+	if err != nil {
+		return nil, err
+	}
+	n := &Notifier{fd: fd, wfd: wfd, cb: bs.runTasks}
+	n.ev = New(bs, fd, EvRead|EvPersist, n.onNotify, nil)
+	n.ev.SetPriority(HP)
+	if err := bs.poll.addShared(n.ev); err != nil {
+		n.closeFds()
+		return nil, err
+	}
+	atomic.StorePointer(&bs.notifier, unsafe.Pointer(n))
+	return n, nil
+}
+
+// runTasks runs the tasks posted before the loop is woken up.
+// The tasks posted by them run in the next iteration.
+func (bs *EventBase) runTasks(count uint64, arg interface{}) {
+	atomic.StoreInt32(&bs.posted, 0)
+	last := (*task)(atomic.LoadPointer(&bs.tasks.head))
+	for {
+		t := bs.tasks.pop()
+		if t == nil {
+			return
+		}
+		if t.delay > 0 {
+			NewTimer(bs, t.run, bs).Attach(t.delay - time.Since(t.posted))
+		} else {
+			bs.runTask(t.fn)
+		}
+		if t == last {
+			return
+		}
+	}
+}
+
+func (t *task) run(fd int, events uint32, arg interface{}) {
+	arg.(*EventBase).runTask(t.fn)
+}
@@ -0,0 +1,179 @@
+// Copyright (c) 2023 cheng-zhongliang. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package event_test
+
+import (
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	. "github.com/cheng-zhongliang/event"
+)
+
+func TestPost(t *testing.T) {
+	base, err := NewBase()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const goroutines, posts = 4, 1000
+	last := make([]int, goroutines)
+	total := 0
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 1; j <= posts; j++ {
+				j := j
+				err := base.Post(func() {
+					if last[i] != j-1 {
+						t.Errorf("goroutine %d: task %d after %d", i, j, last[i])
+					}
+					last[i] = j
+					total++
+				})
+				if err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(i)
+	}
+
+	for deadline := time.Now().Add(time.Second); total < goroutines*posts; {
+		if time.Now().After(deadline) {
+			t.Fatalf("tasks %d, want %d", total, goroutines*posts)
+		}
+		if err := base.Loop(EvLoopOnce); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wg.Wait()
+
+	if err := base.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+	if err := base.Post(func() {}); err != ErrBaseShutdown {
+		t.Fatalf("error %v, want %v", err, ErrBaseShutdown)
+	}
+}
+
+func TestPostRepost(t *testing.T) {
+	base, err := NewBase()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runs := 0
+	var repost func()
+	repost = func() {
+		runs++
+		base.Post(repost)
+	}
+	base.Post(repost)
+	for i := 1; i <= 3; i++ {
+		if err := base.Loop(EvLoopOnce); err != nil {
+			t.Fatal(err)
+		}
+		if runs != i {
+			t.Fatalf("runs %d after %d iterations", runs, i)
+		}
+	}
+
+	if err := base.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPostDelayed(t *testing.T) {
+	base, err := NewBase()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	var fired time.Time
+	go base.PostDelayed(20*time.Millisecond, func() {
+		fired = time.Now()
+	})
+	for deadline := time.Now().Add(time.Second); fired.IsZero(); {
+		if time.Now().After(deadline) {
+			t.Fatal("delayed task not run")
+		}
+		if err := base.Loop(EvLoopOnce); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if d := fired.Sub(start); d < 20*time.Millisecond {
+		t.Fatalf("delayed task run after %v", d)
+	}
+
+	if err := base.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPostWakeup(t *testing.T) {
+	base, err := NewBase()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- base.Dispatch()
+	}()
+
+	// the loop blocks without any event until the first post creates the notifier.
+	time.Sleep(10 * time.Millisecond)
+	if err := base.Post(func() {
+		base.Shutdown()
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("loop not woken up")
+	}
+	if err := base.Post(func() {}); err != ErrBaseShutdown {
+		t.Fatalf("error %v, want %v", err, ErrBaseShutdown)
+	}
+}
+
+func TestShutdownFromGoroutine(t *testing.T) {
+	base, err := NewBase()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- base.Dispatch()
+	}()
+
+	// the loop is woken up to shut down the base in its goroutine.
+	time.Sleep(10 * time.Millisecond)
+	if err := base.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+	if err := base.Post(func() {}); err != ErrBaseShutdown {
+		t.Fatalf("error %v, want %v", err, ErrBaseShutdown)
+	}
+	select {
+	case err := <-done:
+		if err != syscall.EBADF {
+			t.Fatalf("error %v, want %v", err, syscall.EBADF)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("loop not shut down")
+	}
+	if err := base.Shutdown(); err != ErrBaseShutdown {
+		t.Fatalf("error %v, want %v", err, ErrBaseShutdown)
+	}
+}
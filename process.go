@@ -0,0 +1,298 @@
+// Copyright (c) 2023 cheng-zhongliang. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package event
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+const (
+	// childReadSize is the size of the buffer to read the output of a child process.
+	childReadSize = 0x1000
+	// reapRetryInterval is the pause before reaping again a process not ready to be reaped.
+	reapRetryInterval = 10 * time.Millisecond
+	// reapFailedStatus is the status reported when the process cannot be reaped, as exit code 255.
+	reapFailedStatus syscall.WaitStatus = 0xff << 8
+)
+
+// Pipe creates a non-blocking and close-on-exec pipe.
+// It returns the read end and the write end.
+func Pipe() (int, int, error) {
+	return pipe()
+}
+
+// Socketpair creates a pair of connected non-blocking and close-on-exec unix stream sockets.
+func Socketpair() (int, int, error) {
+	return socketpair()
+}
+
+// ExitEvent is the event when a process exits.
+// It uses pidfd on Linux and EVFILT_PROC on kqueue.
+type ExitEvent struct {
+	// ev is the read event of the exit fd.
+	ev *Event
+	// timer is the timer event to retry reaping the process.
+	timer *Event
+	// pid is the process id.
+	pid int
+	// fd is the fd readable when the process exits.
+	fd int
+	// done reports whether the exit is reported or the event is closed.
+	done bool
+	// cb is the callback function when the process exits.
+	cb func(pid int, status syscall.WaitStatus, arg interface{})
+	// arg is the argument passed to the callback function.
+	arg interface{}
+}
+
+// NewExitEvent watches the exit of the child process.
+// The callback function is called once with the exit status, and the process is reaped.
+// If it cannot be reaped, such as when it is reaped elsewhere, the status is exit code 255.
+// On Linux it requires pidfd_open of Linux 5.3, and fails with ErrPidfdUnsupported on older kernels.
+func NewExitEvent(base *EventBase, pid int, callback func(pid int, status syscall.WaitStatus, arg interface{}), arg interface{}) (*ExitEvent, error) {
+	fd, err := openExitFd(pid)
+	if err != nil {
+		return nil, err
+	}
+	ee := &ExitEvent{pid: pid, fd: fd, cb: callback, arg: arg}
+	ee.ev = New(base, fd, EvRead, ee.onExit, nil)
+	ee.timer = NewTimer(base, ee.onExit, nil)
+	if err := ee.ev.Attach(0); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+	return ee, nil
+}
+
+// Pid returns the process id.
+func (ee *ExitEvent) Pid() int {
+	return ee.pid
+}
+
+// Close stops watching the process. The process is not reaped.
+func (ee *ExitEvent) Close() error {
+	if ee.done {
+		return nil
+	}
+	ee.done = true
+	ee.ev.Detach()
+	ee.timer.Detach()
+	return syscall.Close(ee.fd)
+}
+
+func (ee *ExitEvent) onExit(fd int, events uint32, arg interface{}) {
+	if ee.done {
+		return
+	}
+	var status syscall.WaitStatus
+	for {
+		pid, err := syscall.Wait4(ee.pid, &status, syscall.WNOHANG, nil)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err == nil && pid == 0 {
+			// the fd fired before the process can be reaped, wait a moment.
+			ee.timer.Attach(reapRetryInterval)
+			return
+		}
+		if err != nil {
+			status = reapFailedStatus
+		}
+		break
+	}
+	ee.Close()
+	ee.cb(ee.pid, status, ee.arg)
+}
+
+// ChildAttr is the attributes of a child process.
+type ChildAttr struct {
+	// Dir is the working directory. Empty means the current directory.
+	Dir string
+	// Env is the environment. Nil means the environment of the current process.
+	Env []string
+	// Stdin creates a pipe for the standard input, written by Child.Stdin.
+	// Otherwise the standard input is inherited.
+	Stdin bool
+	// Output is the callback function of the standard output (fd 1) and error (fd 2).
+	// The data is only valid until the callback returns.
+	// Nil means the standard output and error are inherited.
+	Output func(c *Child, fd int, data []byte, arg interface{})
+	// Exit is the callback function when the child exits.
+	// It is called after the output is read to the end.
+	Exit func(c *Child, status syscall.WaitStatus, arg interface{})
+	// Arg is the argument passed to the callback functions.
+	Arg interface{}
+}
+
+// Child is a child process with the standard I/O connected to the event loop.
+type Child struct {
+	// attr is the attributes of the child.
+	attr ChildAttr
+	// pid is the process id.
+	pid int
+	// stdin is the write end of the standard input pipe, or -1.
+	stdin int
+	// outputs is the read events of the standard output and error pipes.
+	outputs []*Event
+	// exit is the exit event of the child.
+	exit *ExitEvent
+	// exited reports whether the child exits.
+	exited bool
+	// status is the exit status of the child.
+	status syscall.WaitStatus
+	// buf is the buffer to read the output.
+	buf []byte
+}
+
+// Spawn starts the executable as a child process with the attributes.
+// The output of the child is read by the event loop and its exit is watched by an ExitEvent.
+func Spawn(base *EventBase, path string, args []string, attr *ChildAttr) (*Child, error) {
+	c := &Child{stdin: -1}
+	if attr != nil {
+		c.attr = *attr
+	}
+	files := []uintptr{0, 1, 2}
+	var closeAfter []int
+	defer func() {
+		for _, fd := range closeAfter {
+			syscall.Close(fd)
+		}
+	}()
+	if c.attr.Stdin {
+		r, w, err := pipe()
+		if err != nil {
+			return nil, err
+		}
+		syscall.SetNonblock(r, false)
+		files[0] = uintptr(r)
+		closeAfter = append(closeAfter, r)
+		c.stdin = w
+	}
+	var outFds []int
+	if c.attr.Output != nil {
+		for i := 1; i <= 2; i++ {
+			r, w, err := pipe()
+			if err != nil {
+				c.closeFds(outFds)
+				return nil, err
+			}
+			syscall.SetNonblock(w, false)
+			files[i] = uintptr(w)
+			closeAfter = append(closeAfter, w)
+			outFds = append(outFds, r)
+		}
+	}
+	env := c.attr.Env
+	if env == nil {
+		env = os.Environ()
+	}
+	pid, err := syscall.ForkExec(path, args, &syscall.ProcAttr{Dir: c.attr.Dir, Env: env, Files: files})
+	if err != nil {
+		c.closeFds(outFds)
+		return nil, err
+	}
+	c.pid = pid
+	if c.exit, err = NewExitEvent(base, pid, c.onExit, nil); err != nil {
+		c.kill(outFds)
+		return nil, err
+	}
+	for i, fd := range outFds {
+		ev := New(base, fd, EvRead|EvPersist, c.onOutput, i+1)
+		if err := ev.Attach(0); err != nil {
+			c.exit.Close()
+			c.kill(outFds)
+			return nil, err
+		}
+		c.outputs = append(c.outputs, ev)
+	}
+	return c, nil
+}
+
+// Pid returns the process id of the child.
+func (c *Child) Pid() int {
+	return c.pid
+}
+
+// Stdin returns the non-blocking write end of the standard input pipe, or -1 if there is none.
+func (c *Child) Stdin() int {
+	return c.stdin
+}
+
+// CloseStdin closes the standard input pipe, so the child reads the end of file.
+func (c *Child) CloseStdin() error {
+	if c.stdin < 0 {
+		return nil
+	}
+	err := syscall.Close(c.stdin)
+	c.stdin = -1
+	return err
+}
+
+// Signal sends the signal to the child.
+func (c *Child) Signal(sig syscall.Signal) error {
+	if c.exited {
+		return syscall.ESRCH
+	}
+	return syscall.Kill(c.pid, sig)
+}
+
+func (c *Child) onOutput(fd int, events uint32, arg interface{}) {
+	if c.buf == nil {
+		c.buf = make([]byte, childReadSize)
+	}
+	n, err := syscall.Read(fd, c.buf)
+	if err == syscall.EAGAIN || err == syscall.EINTR {
+		return
+	}
+	if n > 0 {
+		c.attr.Output(c, arg.(int), c.buf[:n], c.attr.Arg)
+		return
+	}
+	// the pipe is closed by the child, or broken.
+	for i, ev := range c.outputs {
+		if ev.Fd() == fd {
+			ev.Detach()
+			syscall.Close(fd)
+			c.outputs = append(c.outputs[:i], c.outputs[i+1:]...)
+			break
+		}
+	}
+	c.report()
+}
+
+func (c *Child) onExit(pid int, status syscall.WaitStatus, arg interface{}) {
+	c.exited = true
+	c.status = status
+	c.report()
+}
+
+// report calls the exit callback once the child exits and the output is read to the end.
+func (c *Child) report() {
+	if !c.exited || len(c.outputs) > 0 {
+		return
+	}
+	c.CloseStdin()
+	if c.attr.Exit != nil {
+		c.attr.Exit(c, c.status, c.attr.Arg)
+	}
+}
+
+// kill kills and reaps the child when it cannot be watched, and releases the output pipes.
+func (c *Child) kill(outFds []int) {
+	syscall.Kill(c.pid, syscall.SIGKILL)
+	syscall.Wait4(c.pid, nil, 0, nil)
+	for _, ev := range c.outputs {
+		ev.Detach()
+	}
+	c.outputs = nil
+	c.closeFds(outFds)
+}
+
+func (c *Child) closeFds(fds []int) {
+	closeFds(fds)
+	c.CloseStdin()
+}
@@ -0,0 +1,125 @@
+// Copyright (c) 2023 cheng-zhongliang. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package event_test
+
+import (
+	"syscall"
+	"testing"
+	"time"
+
+	. "github.com/cheng-zhongliang/event"
+)
+
+func TestSpawn(t *testing.T) {
+	base, err := NewBase()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	outputs := map[int]string{}
+	status := syscall.WaitStatus(0)
+	exited := false
+	c, err := Spawn(base, "/bin/sh", []string{"sh", "-c", "cat; echo oops >&2; exit 3"}, &ChildAttr{
+		Stdin: true,
+		Output: func(c *Child, fd int, data []byte, arg interface{}) {
+			outputs[fd] += string(data)
+		},
+		Exit: func(c *Child, ws syscall.WaitStatus, arg interface{}) {
+			status = ws
+			exited = true
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := syscall.Write(c.Stdin(), []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	c.CloseStdin()
+
+	for deadline := time.Now().Add(5 * time.Second); !exited; {
+		if time.Now().After(deadline) {
+			t.Fatal("child not exited")
+		}
+		if err := base.Loop(EvLoopOnce); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if outputs[1] != "hello" || outputs[2] != "oops\n" {
+		t.Fatalf("outputs %q not equal", outputs)
+	}
+	if !status.Exited() || status.ExitStatus() != 3 {
+		t.Fatalf("status %v, want exit 3", status)
+	}
+
+	if err := base.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExitEvent(t *testing.T) {
+	base, err := NewBase()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pid, err := syscall.ForkExec("/bin/sh", []string{"sh", "-c", "kill -TERM $$"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signaled := false
+	_, err = NewExitEvent(base, pid, func(p int, ws syscall.WaitStatus, arg interface{}) {
+		signaled = p == pid && ws.Signaled() && ws.Signal() == syscall.SIGTERM
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := base.Loop(EvLoopOnce); err != nil {
+		t.Fatal(err)
+	}
+	if !signaled {
+		t.Fatal("exit not reported")
+	}
+
+	if err := base.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExitEventReapedElsewhere(t *testing.T) {
+	base, err := NewBase()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pid, err := syscall.ForkExec("/bin/sh", []string{"sh", "-c", "exit 0"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var status syscall.WaitStatus
+	reported := false
+	_, err = NewExitEvent(base, pid, func(p int, ws syscall.WaitStatus, arg interface{}) {
+		reported = true
+		status = ws
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the exit is not reported as a success when the process cannot be reaped.
+	if _, err := syscall.Wait4(pid, nil, 0, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := base.Loop(EvLoopOnce); err != nil {
+		t.Fatal(err)
+	}
+	if !reported || status.ExitStatus() != 255 {
+		t.Fatalf("reported %v status %d, want exit code 255", reported, status.ExitStatus())
+	}
+
+	if err := base.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,466 @@
+// Copyright (c) 2023 cheng-zhongliang. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package event
+
+import (
+	"bufio"
+	"crypto/rand"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// defaultResolveTimeout is the timeout of every attempt of a query.
+	defaultResolveTimeout = 5 * time.Second
+	// defaultResolveAttempts is the number of attempts on every nameserver.
+	defaultResolveAttempts = 2
+	// maxDNSCacheEntries is the maximum number of the names in the cache.
+	maxDNSCacheEntries = 1024
+)
+
+// Resolver is the asynchronous DNS stub resolver.
+// The queries are sent on non-blocking UDP sockets registered with the event base.
+type Resolver struct {
+	// base is the event base of the resolver.
+	base *EventBase
+	// servers is the addresses of the nameservers.
+	servers []syscall.Sockaddr
+	// conns is the sockets connected to the nameservers.
+	conns []*Event
+	// timeout is the timeout of every attempt of a query.
+	timeout time.Duration
+	// attempts is the number of attempts on every nameserver.
+	attempts int
+	// hosts is the static addresses of the hosts file.
+	hosts map[string][]net.IP
+	// cache is the cache of the answered names.
+	cache map[string]*dnsCacheEntry
+	// queries is the outstanding queries by id.
+	queries map[uint16]*dnsQuery
+	// pending is the outstanding queries by name.
+	pending map[string]*dnsQuery
+	// buf is the buffer to receive responses.
+	buf []byte
+}
+
+// dnsCacheEntry is the cached addresses of a name.
+type dnsCacheEntry struct {
+	// ips is the addresses of the name.
+	ips []net.IP
+	// expire is the time when the entry expires.
+	expire time.Time
+}
+
+// dnsLookup is the lookup waiting for a query.
+type dnsLookup struct {
+	// cb is the callback function when the lookup completes.
+	cb func(addrs []net.IP, err error, arg interface{})
+	// arg is the argument passed to the callback function.
+	arg interface{}
+}
+
+// dnsQuery is the A and AAAA queries of a name.
+type dnsQuery struct {
+	// r is the resolver of the query.
+	r *Resolver
+	// name is the absolute name to query.
+	name string
+	// ids is the ids of the A and AAAA queries. Zero means answered.
+	ids [2]uint16
+	// server is the index of the nameserver to query.
+	server int
+	// tries is the number of the timed out attempts.
+	tries int
+	// timer is the timer event of the attempt.
+	timer *Event
+	// ips is the addresses answered.
+	ips []net.IP
+	// ttl is the minimum ttl of the answers.
+	ttl uint32
+	// lookups is the lookups waiting for the query.
+	lookups []dnsLookup
+}
+
+// NewResolver creates a new resolver.
+// The nameservers and options are loaded from /etc/resolv.conf and the static
+// addresses from /etc/hosts. Missing files are ignored and the local nameserver is used.
+func NewResolver(base *EventBase) (*Resolver, error) {
+	r := new(Resolver)
+	r.base = base
+	r.timeout = defaultResolveTimeout
+	r.attempts = defaultResolveAttempts
+	r.hosts = make(map[string][]net.IP)
+	r.cache = make(map[string]*dnsCacheEntry)
+	r.queries = make(map[uint16]*dnsQuery)
+	r.pending = make(map[string]*dnsQuery)
+	r.buf = make([]byte, dnsMaxMsgLen)
+	if err := r.LoadResolvConf("/etc/resolv.conf"); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if len(r.servers) == 0 {
+		if err := r.SetNameservers("127.0.0.1", "::1"); err != nil {
+			return nil, err
+		}
+	}
+	if err := r.LoadHosts("/etc/hosts"); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return r, nil
+}
+
+// LoadResolvConf loads the nameservers and the timeout and attempts options from the resolv.conf file.
+// The search list is not applied, names are always resolved as absolute names.
+func (r *Resolver) LoadResolvConf(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var servers []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0][0] == '#' || fields[0][0] == ';' {
+			continue
+		}
+		switch fields[0] {
+		case "nameserver":
+			servers = append(servers, fields[1])
+		case "options":
+			for _, opt := range fields[1:] {
+				switch {
+				case strings.HasPrefix(opt, "timeout:"):
+					if n, err := strconv.Atoi(opt[len("timeout:"):]); err == nil && n > 0 {
+						r.timeout = time.Duration(n) * time.Second
+					}
+				case strings.HasPrefix(opt, "attempts:"):
+					if n, err := strconv.Atoi(opt[len("attempts:"):]); err == nil && n > 0 {
+						r.attempts = n
+					}
+				}
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if len(servers) == 0 {
+		return nil
+	}
+	return r.SetNameservers(servers...)
+}
+
+// LoadHosts loads the static addresses from the hosts file.
+func (r *Resolver) LoadHosts(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	hosts := make(map[string][]net.IP)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		ip := net.ParseIP(fields[0])
+		if ip == nil {
+			continue
+		}
+		for _, name := range fields[1:] {
+			name = absDomainName(name)
+			hosts[name] = append(hosts[name], ip)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	r.hosts = hosts
+	return nil
+}
+
+// SetNameservers sets the nameservers.
+// The address is an IP address with an optional port. Default port is 53.
+// The outstanding queries are sent to the new nameservers on their next attempts.
+func (r *Resolver) SetNameservers(servers ...string) error {
+	if len(servers) == 0 {
+		return syscall.EINVAL
+	}
+	addrs := make([]syscall.Sockaddr, 0, len(servers))
+	for _, server := range servers {
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(server, "53")
+		}
+		_, sa, err := resolveSockaddr("udp", server)
+		if err != nil {
+			return err
+		}
+		addrs = append(addrs, sa)
+	}
+	r.closeConns()
+	r.servers = addrs
+	r.conns = make([]*Event, len(addrs))
+	for _, q := range r.pending {
+		if q.server >= len(addrs) {
+			q.server = 0
+		}
+	}
+	return nil
+}
+
+// SetTimeout sets the timeout of every attempt of a query.
+func (r *Resolver) SetTimeout(timeout time.Duration) {
+	r.timeout = timeout
+}
+
+// SetAttempts sets the number of attempts on every nameserver.
+func (r *Resolver) SetAttempts(attempts int) {
+	r.attempts = attempts
+}
+
+// LookupHost looks up the IPv4 and IPv6 addresses of the host.
+// The callback function is called in the event loop with the addresses,
+// or with the error such as ErrHostNotFound or ErrResolveTimeout.
+// The addresses of the hosts file and the cache are used before querying the nameservers.
+func (r *Resolver) LookupHost(host string, callback func(addrs []net.IP, err error, arg interface{}), arg interface{}) error {
+	if ip := net.ParseIP(host); ip != nil {
+		return r.deliver([]net.IP{ip}, nil, callback, arg)
+	}
+	name := absDomainName(host)
+	if ips, ok := r.hosts[name]; ok {
+		return r.deliver(ips, nil, callback, arg)
+	}
+	if entry, ok := r.cache[name]; ok {
+		if r.base.Now().Before(entry.expire) {
+			return r.deliver(entry.ips, nil, callback, arg)
+		}
+		delete(r.cache, name)
+	}
+	if _, err := appendDNSQuery(nil, 0, name, dnsTypeA); err != nil {
+		return r.deliver(nil, ErrHostNotFound, callback, arg)
+	}
+	lookup := dnsLookup{cb: callback, arg: arg}
+	if q, ok := r.pending[name]; ok {
+		q.lookups = append(q.lookups, lookup)
+		return nil
+	}
+	q := &dnsQuery{r: r, name: name, lookups: []dnsLookup{lookup}}
+	for i := range q.ids {
+		id, err := r.newID()
+		if err != nil {
+			q.remove()
+			return err
+		}
+		q.ids[i] = id
+		r.queries[id] = q
+	}
+	r.pending[name] = q
+	if err := q.send(); err != nil {
+		q.remove()
+		return err
+	}
+	q.timer = NewTimer(r.base, q.onTimeout, nil)
+	return q.timer.Attach(r.timeout)
+}
+
+// Close closes the sockets and drops the outstanding queries without calling the callbacks.
+func (r *Resolver) Close() error {
+	for _, q := range r.pending {
+		q.timer.Detach()
+		q.remove()
+	}
+	r.closeConns()
+	return nil
+}
+
+func (r *Resolver) deliver(ips []net.IP, err error, callback func(addrs []net.IP, err error, arg interface{}), arg interface{}) error {
+	ev := NewTimer(r.base, func(fd int, events uint32, _ interface{}) {
+		callback(ips, err, arg)
+	}, nil)
+	return ev.Attach(0)
+}
+
+// newID returns an unpredictable id not used by the outstanding queries.
+func (r *Resolver) newID() (uint16, error) {
+	var b [2]byte
+	for {
+		if _, err := rand.Read(b[:]); err != nil {
+			return 0, err
+		}
+		id := uint16(b[0])<<8 | uint16(b[1])
+		if _, ok := r.queries[id]; !ok && id != 0 {
+			return id, nil
+		}
+	}
+}
+
+// cacheAnswer caches the addresses of the name until the ttl expires.
+// The expired names are swept when the cache is full, then any names are evicted.
+func (r *Resolver) cacheAnswer(name string, ips []net.IP, ttl uint32) {
+	now := r.base.Now()
+	if len(r.cache) >= maxDNSCacheEntries {
+		for key, entry := range r.cache {
+			if !now.Before(entry.expire) {
+				delete(r.cache, key)
+			}
+		}
+	}
+	for key := range r.cache {
+		if len(r.cache) < maxDNSCacheEntries {
+			break
+		}
+		delete(r.cache, key)
+	}
+	r.cache[name] = &dnsCacheEntry{ips: ips, expire: now.Add(time.Duration(ttl) * time.Second)}
+}
+
+func (r *Resolver) conn(i int) (*Event, error) {
+	if r.conns[i] != nil {
+		return r.conns[i], nil
+	}
+	family := syscall.AF_INET
+	if _, ok := r.servers[i].(*syscall.SockaddrInet6); ok {
+		family = syscall.AF_INET6
+	}
+	fd, err := socket(family, syscall.SOCK_DGRAM, 0)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Connect(fd, r.servers[i]); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+	ev := New(r.base, fd, EvRead|EvPersist, r.onRead, nil)
+	if err := ev.Attach(0); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+	r.conns[i] = ev
+	return ev, nil
+}
+
+func (r *Resolver) closeConns() {
+	for i, ev := range r.conns {
+		if ev != nil {
+			ev.Detach()
+			syscall.Close(ev.fd)
+			r.conns[i] = nil
+		}
+	}
+}
+
+func (r *Resolver) onRead(fd int, events uint32, arg interface{}) {
+	for {
+		n, err := syscall.Read(fd, r.buf)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			return
+		}
+		resp, err := parseDNSResponse(r.buf[:n])
+		if err != nil {
+			continue
+		}
+		q, ok := r.queries[resp.id]
+		if !ok || !strings.EqualFold(resp.name, q.name) {
+			continue
+		}
+		q.onResponse(resp)
+	}
+}
+
+func (q *dnsQuery) send() error {
+	ev, err := q.r.conn(q.server)
+	if err != nil {
+		return err
+	}
+	qtypes := [2]uint16{dnsTypeA, dnsTypeAAAA}
+	for i, id := range q.ids {
+		if id == 0 {
+			continue
+		}
+		msg, _ := appendDNSQuery(nil, id, q.name, qtypes[i])
+		syscall.Write(ev.fd, msg)
+	}
+	return nil
+}
+
+func (q *dnsQuery) onResponse(resp *dnsResponse) {
+	i := 0
+	if resp.qtype == dnsTypeAAAA {
+		i = 1
+	}
+	if q.ids[i] != resp.id {
+		return
+	}
+	if resp.rcode != dnsRcodeSuccess && resp.rcode != dnsRcodeNameError {
+		return
+	}
+	delete(q.r.queries, resp.id)
+	q.ids[i] = 0
+	if len(resp.ips) > 0 {
+		if len(q.ips) == 0 || resp.ttl < q.ttl {
+			q.ttl = resp.ttl
+		}
+		q.ips = append(q.ips, resp.ips...)
+	}
+	if q.ids[0] == 0 && q.ids[1] == 0 {
+		q.timer.Detach()
+		q.finish(nil)
+	}
+}
+
+func (q *dnsQuery) onTimeout(fd int, events uint32, arg interface{}) {
+	q.tries++
+	if q.tries >= q.r.attempts*len(q.r.servers) {
+		q.finish(ErrResolveTimeout)
+		return
+	}
+	q.server = (q.server + 1) % len(q.r.servers)
+	q.send()
+	q.timer.Attach(q.r.timeout)
+}
+
+func (q *dnsQuery) finish(err error) {
+	q.remove()
+	if len(q.ips) > 0 {
+		err = nil
+		if q.ttl > 0 {
+			q.r.cacheAnswer(q.name, q.ips, q.ttl)
+		}
+	} else if err == nil {
+		err = ErrHostNotFound
+	}
+	for _, lookup := range q.lookups {
+		lookup.cb(q.ips, err, lookup.arg)
+	}
+}
+
+func (q *dnsQuery) remove() {
+	for _, id := range q.ids {
+		if id != 0 {
+			delete(q.r.queries, id)
+		}
+	}
+	delete(q.r.pending, q.name)
+}
+
+func absDomainName(name string) string {
+	name = strings.ToLower(name)
+	if !strings.HasSuffix(name, ".") {
+		name += "."
+	}
+	return name
+}
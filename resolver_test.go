@@ -0,0 +1,319 @@
+// Copyright (c) 2023 cheng-zhongliang. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package event_test
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	. "github.com/cheng-zhongliang/event"
+)
+
+// serveDNS answers the A queries of example.test. with 192.0.2.1
+// and the other queries with no answers.
+func serveDNS(conn net.PacketConn, queries *int32) {
+	buf := make([]byte, 512)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		atomic.AddInt32(queries, 1)
+		q := buf[:n]
+		end := 12
+		for q[end] != 0 {
+			end += int(q[end]) + 1
+		}
+		name := string(q[12:end])
+		qtype := binary.BigEndian.Uint16(q[end+1:])
+		msg := append([]byte(nil), q[:end+5]...)
+		msg[2] |= 0x80
+		if name != "\x07example\x04test" {
+			msg[3] |= 3
+		} else if qtype == 1 {
+			msg[7] = 1
+			msg = append(msg, 0xc0, 12, 0, 1, 0, 1, 0, 0, 0, 60, 0, 4, 192, 0, 2, 1)
+		}
+		conn.WriteTo(msg, addr)
+	}
+}
+
+func TestResolver(t *testing.T) {
+	base, err := NewBase()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	queries := int32(0)
+	go serveDNS(conn, &queries)
+
+	r, err := NewResolver(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.SetNameservers(conn.LocalAddr().String()); err != nil {
+		t.Fatal(err)
+	}
+	r.SetTimeout(time.Second)
+
+	n := 0
+	for _, host := range []string{"example.test", "EXAMPLE.test."} {
+		err = r.LookupHost(host, func(addrs []net.IP, err error, arg interface{}) {
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(addrs) != 1 || !addrs[0].Equal(net.IPv4(192, 0, 2, 1)) {
+				t.Fatal("addrs not equal")
+			}
+			if arg != "hello" {
+				t.Fatal("arg not equal")
+			}
+			n++
+		}, "hello")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = r.LookupHost("missing.test", func(addrs []net.IP, err error, arg interface{}) {
+		if err != ErrHostNotFound {
+			t.Fatal(err)
+		}
+		n++
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for deadline := time.Now().Add(time.Second); n < 3 && time.Now().Before(deadline); {
+		if err := base.Loop(EvLoopOnce); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n != 3 {
+		t.Fatalf("%d lookups completed, want 3", n)
+	}
+
+	if q := atomic.LoadInt32(&queries); q != 4 {
+		t.Fatalf("%d queries sent, want 4", q)
+	}
+
+	err = r.LookupHost("example.test", func(addrs []net.IP, err error, arg interface{}) {
+		if err != nil || len(addrs) != 1 {
+			t.Fatal("cached addrs not equal")
+		}
+		n++
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := base.Loop(EvLoopOnce); err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 4 || atomic.LoadInt32(&queries) != 4 {
+		t.Fatal("cache not used")
+	}
+
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := base.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestResolverHosts(t *testing.T) {
+	base, err := NewBase()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "event")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := dir + "/hosts"
+	if err := ioutil.WriteFile(path, []byte("# comment\n192.0.2.7 static.test alias.test # trailing\n::1 static.test\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewResolver(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.LoadHosts(path); err != nil {
+		t.Fatal(err)
+	}
+
+	n := 0
+	err = r.LookupHost("static.test", func(addrs []net.IP, err error, arg interface{}) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(addrs) != 2 || !addrs[0].Equal(net.IPv4(192, 0, 2, 7)) || !addrs[1].Equal(net.IPv6loopback) {
+			t.Fatal("addrs not equal")
+		}
+		n++
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := base.Loop(EvLoopOnce); err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 1 {
+		t.FailNow()
+	}
+
+	if err := base.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestResolverTimeout(t *testing.T) {
+	base, err := NewBase()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	r, err := NewResolver(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.SetNameservers(conn.LocalAddr().String()); err != nil {
+		t.Fatal(err)
+	}
+	r.SetTimeout(10 * time.Millisecond)
+	r.SetAttempts(2)
+
+	n := 0
+	err = r.LookupHost("example.test", func(addrs []net.IP, err error, arg interface{}) {
+		if err != ErrResolveTimeout {
+			t.Fatal(err)
+		}
+		n++
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for deadline := time.Now().Add(time.Second); n == 0 && time.Now().Before(deadline); {
+		if err := base.Loop(EvLoopOnce); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n != 1 {
+		t.FailNow()
+	}
+
+	buf := make([]byte, 512)
+	for i := 0; i < 4; i++ {
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		if _, _, err := conn.ReadFrom(buf); err != nil {
+			t.Fatalf("query %d not retried: %v", i, err)
+		}
+	}
+
+	if err := base.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestResolverNameserversShrink(t *testing.T) {
+	base, err := NewBase()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var conns []net.PacketConn
+	for i := 0; i < 2; i++ {
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		conns = append(conns, conn)
+	}
+
+	r, err := NewResolver(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.SetNameservers(); err != syscall.EINVAL {
+		t.Fatalf("error %v, want %v", err, syscall.EINVAL)
+	}
+	if err := r.SetNameservers(conns[0].LocalAddr().String(), conns[1].LocalAddr().String()); err != nil {
+		t.Fatal(err)
+	}
+	r.SetTimeout(10 * time.Millisecond)
+	r.SetAttempts(3)
+
+	n := 0
+	err = r.LookupHost("example.test", func(addrs []net.IP, err error, arg interface{}) {
+		if err != ErrResolveTimeout {
+			t.Fatal(err)
+		}
+		n++
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the query moves to the second nameserver, which is removed before the next attempt.
+	buf := make([]byte, 512)
+	for deadline := time.Now().Add(time.Second); ; {
+		if time.Now().After(deadline) {
+			t.Fatal("query not sent to the second nameserver")
+		}
+		if err := base.Loop(EvLoopOnce); err != nil {
+			t.Fatal(err)
+		}
+		conns[1].SetReadDeadline(time.Now().Add(time.Millisecond))
+		if _, _, err := conns[1].ReadFrom(buf); err == nil {
+			break
+		}
+	}
+	if err := r.SetNameservers(conns[0].LocalAddr().String()); err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(time.Second); n == 0 && time.Now().Before(deadline); {
+		if err := base.Loop(EvLoopOnce); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n != 1 {
+		t.Fatal("lookup not completed")
+	}
+
+	if err := base.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+}
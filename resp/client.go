@@ -0,0 +1,180 @@
+// Copyright (c) 2023 cheng-zhongliang. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package resp
+
+import (
+	"errors"
+	"io"
+	"syscall"
+	"time"
+
+	"github.com/cheng-zhongliang/event"
+)
+
+var (
+	ErrClientClosed = errors.New("resp client closed")
+)
+
+// Client is the pipelined asynchronous client of the protocol.
+// The commands are sent immediately and the replies are delivered in order.
+type Client struct {
+	// fd is the socket of the client.
+	fd int
+	// rev is the read event of the socket.
+	rev *event.Event
+	// wev is the write event of the socket.
+	wev *event.Event
+	// in is the bytes read from the socket.
+	in event.Buffer
+	// scan is the progress of the reply being read.
+	scan scanner
+	// out is the bytes to write to the socket.
+	out event.Buffer
+	// buf is the scratch space to encode the commands.
+	buf []byte
+	// pending is the callbacks of the commands waiting for the replies.
+	pending []clientCall
+	// closed reports whether the client is closed.
+	closed bool
+	// pushCb is the callback function of the push values.
+	pushCb func(v Value)
+}
+
+// clientCall is a command waiting for the reply.
+type clientCall struct {
+	cb  func(v Value, err error, arg interface{})
+	arg interface{}
+}
+
+// Dial connects to the server and calls the callback with the client.
+// The address must be numeric as the connection is made by event.Connect.
+func Dial(base *event.EventBase, network, address string, timeout time.Duration, callback func(c *Client, err error, arg interface{}), arg interface{}) error {
+	return event.Connect(base, network, address, timeout, func(fd int, err error, _ interface{}) {
+		if err != nil {
+			callback(nil, err, arg)
+			return
+		}
+		c, err := NewClient(base, fd)
+		if err != nil {
+			syscall.Close(fd)
+			callback(nil, err, arg)
+			return
+		}
+		callback(c, nil, arg)
+	}, nil)
+}
+
+// NewClient creates a client of the connected non-blocking socket.
+func NewClient(base *event.EventBase, fd int) (*Client, error) {
+	c := &Client{fd: fd}
+	c.rev = event.New(base, fd, event.EvRead|event.EvPersist, c.onRead, nil)
+	c.wev = event.New(base, fd, event.EvWrite|event.EvPersist, c.onWrite, nil)
+	if err := c.rev.Attach(0); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// SetPushCallback sets the callback function of the RESP3 push values, such as pub/sub messages.
+func (c *Client) SetPushCallback(callback func(v Value)) {
+	c.pushCb = callback
+}
+
+// Do sends the command and calls the callback with the reply.
+// The error is an Error if the server replies with an error.
+func (c *Client) Do(args []string, callback func(v Value, err error, arg interface{}), arg interface{}) error {
+	if c.closed {
+		return ErrClientClosed
+	}
+	c.buf = appendCommand(c.buf[:0], args)
+	c.out.Write(c.buf)
+	c.pending = append(c.pending, clientCall{cb: callback, arg: arg})
+	c.flush()
+	return nil
+}
+
+// Close closes the client. The pending commands fail with ErrClientClosed.
+func (c *Client) Close() error {
+	c.fail(ErrClientClosed)
+	return nil
+}
+
+func (c *Client) onRead(fd int, events uint32, arg interface{}) {
+	_, err := c.in.ReadFd(fd)
+	if err == syscall.EAGAIN {
+		return
+	}
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		c.fail(err)
+		return
+	}
+	for !c.closed {
+		v, n, err := c.scan.parse(c.in.Bytes(), maxBulkSize)
+		if err != nil {
+			c.fail(err)
+			return
+		}
+		if n == 0 {
+			return
+		}
+		c.in.Drain(n)
+		if v.Type == TypePush {
+			if c.pushCb != nil {
+				c.pushCb(v)
+			}
+			continue
+		}
+		if len(c.pending) == 0 {
+			c.fail(errProtocol)
+			return
+		}
+		call := c.pending[0]
+		c.pending = c.pending[1:]
+		switch v.Type {
+		case TypeError, TypeBulkError:
+			call.cb(v, Error(v.Str), call.arg)
+		default:
+			call.cb(v, nil, call.arg)
+		}
+	}
+}
+
+func (c *Client) onWrite(fd int, events uint32, arg interface{}) {
+	c.flush()
+}
+
+func (c *Client) flush() {
+	if c.closed {
+		return
+	}
+	_, err := c.out.WriteFd(c.fd)
+	if err == syscall.EAGAIN {
+		c.wev.Attach(0)
+		return
+	}
+	c.wev.Detach()
+	if err != nil {
+		c.fail(err)
+	}
+}
+
+// fail closes the socket and fails the pending commands with the error.
+func (c *Client) fail(err error) {
+	if c.closed {
+		return
+	}
+	c.closed = true
+	c.rev.Detach()
+	c.wev.Detach()
+	syscall.Close(c.fd)
+	pending := c.pending
+	c.pending = nil
+	for _, call := range pending {
+		call.cb(Value{}, err, call.arg)
+	}
+}
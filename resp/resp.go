@@ -0,0 +1,453 @@
+// Copyright (c) 2023 cheng-zhongliang. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package resp implements the Redis serialization protocol with a server and a client on the event loop.
+// Both RESP2 and RESP3 are supported.
+package resp
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"strconv"
+)
+
+// The types of the values. They are the leading bytes of the encoded values.
+const (
+	TypeSimpleString = '+'
+	TypeError        = '-'
+	TypeInteger      = ':'
+	TypeBulkString   = '$'
+	TypeArray        = '*'
+	TypeNull         = '_'
+	TypeBoolean      = '#'
+	TypeDouble       = ','
+	TypeBigNumber    = '('
+	TypeBulkError    = '!'
+	TypeVerbatim     = '='
+	TypeMap          = '%'
+	TypeSet          = '~'
+	TypePush         = '>'
+	typeAttribute    = '|'
+)
+
+const (
+	// maxBulkSize is the default maximum size of a bulk string, the same as Redis.
+	maxBulkSize = 512 << 20
+	// maxDepth is the maximum nesting depth of the aggregate values.
+	maxDepth = 32
+	// maxInlineSize is the maximum size of an inline command.
+	maxInlineSize = 64 << 10
+)
+
+var errProtocol = errors.New("resp protocol error")
+
+// Value is a value of the protocol.
+type Value struct {
+	// Type is the type of the value.
+	Type byte
+	// Str is the bytes of the strings, errors, big numbers and verbatim strings.
+	Str []byte
+	// Int is the integer.
+	Int int64
+	// Float is the double.
+	Float float64
+	// Bool is the boolean.
+	Bool bool
+	// Elems is the elements of the arrays, sets and pushes.
+	// The map entries are flattened as key, value, key, value.
+	Elems []Value
+}
+
+// Error is the error reply of the server.
+type Error string
+
+func (e Error) Error() string {
+	return string(e)
+}
+
+// SimpleString returns a simple string value.
+func SimpleString(s string) Value {
+	return Value{Type: TypeSimpleString, Str: []byte(s)}
+}
+
+// ErrorValue returns an error value.
+func ErrorValue(s string) Value {
+	return Value{Type: TypeError, Str: []byte(s)}
+}
+
+// Integer returns an integer value.
+func Integer(n int64) Value {
+	return Value{Type: TypeInteger, Int: n}
+}
+
+// Bulk returns a bulk string value.
+func Bulk(b []byte) Value {
+	return Value{Type: TypeBulkString, Str: b}
+}
+
+// Array returns an array value.
+func Array(elems ...Value) Value {
+	return Value{Type: TypeArray, Elems: elems}
+}
+
+// Null returns the null value.
+func Null() Value {
+	return Value{Type: TypeNull}
+}
+
+// String returns the bytes of a string value as a string.
+func (v Value) String() string {
+	switch v.Type {
+	case TypeInteger:
+		return strconv.FormatInt(v.Int, 10)
+	case TypeDouble:
+		return formatDouble(v.Float)
+	case TypeBoolean:
+		return strconv.FormatBool(v.Bool)
+	}
+	return string(v.Str)
+}
+
+// Parse parses the first value in p and returns the number of bytes it occupies.
+// The number is 0 if the value is not complete yet.
+// Parse starts over on every call; the server and the client scan the bytes
+// arriving in pieces only once before they parse the complete value.
+func Parse(p []byte) (Value, int, error) {
+	return parse(p, 0, maxBulkSize)
+}
+
+func parse(p []byte, depth int, maxBulk int) (Value, int, error) {
+	if depth > maxDepth {
+		return Value{}, 0, errProtocol
+	}
+	line, n := readLine(p)
+	if n == 0 {
+		if len(p) > maxInlineSize {
+			return Value{}, 0, errProtocol
+		}
+		return Value{}, 0, nil
+	}
+	if len(line) == 0 {
+		return Value{}, 0, errProtocol
+	}
+	v := Value{Type: line[0]}
+	body := line[1:]
+	switch v.Type {
+	case TypeSimpleString, TypeError, TypeBigNumber:
+		v.Str = append([]byte(nil), body...)
+	case TypeInteger:
+		i, err := strconv.ParseInt(string(body), 10, 64)
+		if err != nil {
+			return Value{}, 0, errProtocol
+		}
+		v.Int = i
+	case TypeNull:
+		if len(body) != 0 {
+			return Value{}, 0, errProtocol
+		}
+	case TypeBoolean:
+		if len(body) != 1 || body[0] != 't' && body[0] != 'f' {
+			return Value{}, 0, errProtocol
+		}
+		v.Bool = body[0] == 't'
+	case TypeDouble:
+		f, err := strconv.ParseFloat(string(body), 64)
+		if err != nil {
+			return Value{}, 0, errProtocol
+		}
+		v.Float = f
+	case TypeBulkString, TypeBulkError, TypeVerbatim:
+		size, err := strconv.Atoi(string(body))
+		if err != nil || size < -1 || size > maxBulk {
+			return Value{}, 0, errProtocol
+		}
+		if size == -1 {
+			return Value{Type: TypeNull}, n, nil
+		}
+		if len(p) < n+size+2 {
+			return Value{}, 0, nil
+		}
+		if p[n+size] != '\r' || p[n+size+1] != '\n' {
+			return Value{}, 0, errProtocol
+		}
+		v.Str = append([]byte(nil), p[n:n+size]...)
+		n += size + 2
+	case TypeArray, TypeSet, TypePush, TypeMap, typeAttribute:
+		count, err := strconv.Atoi(string(body))
+		if err != nil || count < -1 {
+			return Value{}, 0, errProtocol
+		}
+		if count == -1 {
+			return Value{Type: TypeNull}, n, nil
+		}
+		if v.Type == TypeMap || v.Type == typeAttribute {
+			count *= 2
+		}
+		// every element takes at least 3 bytes, which bounds the allocation.
+		if count > (len(p)-n)/3 {
+			if count > maxBulkSize {
+				return Value{}, 0, errProtocol
+			}
+			v.Elems = make([]Value, 0, (len(p)-n)/3)
+		} else {
+			v.Elems = make([]Value, 0, count)
+		}
+		for i := 0; i < count; i++ {
+			elem, m, err := parse(p[n:], depth+1, maxBulk)
+			if err != nil || m == 0 {
+				return Value{}, 0, err
+			}
+			v.Elems = append(v.Elems, elem)
+			n += m
+		}
+		if v.Type == typeAttribute {
+			// the attributes are skipped and the value which follows is returned.
+			next, m, err := parse(p[n:], depth, maxBulk)
+			if err != nil || m == 0 {
+				return Value{}, 0, err
+			}
+			return next, n + m, nil
+		}
+	default:
+		return Value{}, 0, errProtocol
+	}
+	return v, n, nil
+}
+
+// scanner finds the end of the first value in the bytes arriving in pieces.
+// It keeps its progress between the calls, so every byte is scanned once however the value is split.
+type scanner struct {
+	// pos is the number of bytes scanned.
+	pos int
+	// counts is the number of the elements left in the open aggregate values.
+	counts []int
+}
+
+// scan returns the number of bytes the first value in p occupies.
+// The number is 0 if the value is not complete yet.
+// The p must begin with the bytes passed before, until the value is complete.
+func (s *scanner) scan(p []byte, maxBulk int) (int, error) {
+	for {
+		if len(s.counts) > maxDepth {
+			return 0, errProtocol
+		}
+		line, n := readLine(p[s.pos:])
+		if n == 0 {
+			if len(p)-s.pos > maxInlineSize {
+				return 0, errProtocol
+			}
+			return 0, nil
+		}
+		if len(line) == 0 {
+			return 0, errProtocol
+		}
+		count := 0
+		switch line[0] {
+		case TypeBulkString, TypeBulkError, TypeVerbatim:
+			size, err := strconv.Atoi(string(line[1:]))
+			if err != nil || size < -1 || size > maxBulk {
+				return 0, errProtocol
+			}
+			if size >= 0 {
+				// the header is scanned again until the whole bulk string arrives.
+				if len(p)-s.pos < n+size+2 {
+					return 0, nil
+				}
+				n += size + 2
+			}
+		case TypeArray, TypeSet, TypePush, TypeMap, typeAttribute:
+			c, err := strconv.Atoi(string(line[1:]))
+			if err != nil || c < -1 || c > maxBulkSize {
+				return 0, errProtocol
+			}
+			count = c
+			if line[0] == TypeMap || line[0] == typeAttribute {
+				count *= 2
+			}
+			if line[0] == typeAttribute {
+				// the value which follows the attributes belongs to them.
+				count++
+			}
+		}
+		s.pos += n
+		if count > 0 {
+			s.counts = append(s.counts, count)
+			continue
+		}
+		// the complete value may complete the aggregate values it ends.
+		for len(s.counts) > 0 {
+			top := len(s.counts) - 1
+			if s.counts[top]--; s.counts[top] > 0 {
+				break
+			}
+			s.counts = s.counts[:top]
+		}
+		if len(s.counts) == 0 {
+			n := s.pos
+			s.pos = 0
+			return n, nil
+		}
+	}
+}
+
+// parse parses the first value in p once it is complete.
+func (s *scanner) parse(p []byte, maxBulk int) (Value, int, error) {
+	n, err := s.scan(p, maxBulk)
+	if err != nil || n == 0 {
+		return Value{}, 0, err
+	}
+	v, m, err := parse(p[:n], 0, maxBulk)
+	if err == nil && m != n {
+		err = errProtocol
+	}
+	return v, n, err
+}
+
+// parseCommand parses the first command in p, as an array of bulk strings or an inline command.
+// It returns nil arguments for an empty inline command.
+func (s *scanner) parseCommand(p []byte, maxBulk int) ([][]byte, int, error) {
+	if len(p) > 0 && p[0] != TypeArray {
+		line, n := readLine(p)
+		if n == 0 {
+			if len(p) > maxInlineSize {
+				return nil, 0, errProtocol
+			}
+			return nil, 0, nil
+		}
+		return bytes.Fields(line), n, nil
+	}
+	v, n, err := s.parse(p, maxBulk)
+	if err != nil || n == 0 {
+		return nil, n, err
+	}
+	if v.Type != TypeArray {
+		return nil, 0, errProtocol
+	}
+	args := make([][]byte, len(v.Elems))
+	for i, elem := range v.Elems {
+		if elem.Type != TypeBulkString {
+			return nil, 0, errProtocol
+		}
+		args[i] = elem.Str
+	}
+	return args, n, nil
+}
+
+// readLine returns the first line in p without "\r\n" and the number of bytes it occupies.
+func readLine(p []byte) ([]byte, int) {
+	i := bytes.Index(p, []byte("\r\n"))
+	if i < 0 {
+		return nil, 0
+	}
+	return p[:i], i + 2
+}
+
+// AppendValue appends the encoded value to dst.
+// The proto is the protocol version 2 or 3. The RESP3 types are downgraded for RESP2.
+func AppendValue(dst []byte, v Value, proto int) []byte {
+	switch v.Type {
+	case TypeSimpleString, TypeError:
+		dst = append(dst, v.Type)
+		dst = append(dst, v.Str...)
+		return append(dst, '\r', '\n')
+	case TypeInteger:
+		dst = append(dst, TypeInteger)
+		dst = strconv.AppendInt(dst, v.Int, 10)
+		return append(dst, '\r', '\n')
+	case TypeNull:
+		if proto < 3 {
+			return append(dst, "$-1\r\n"...)
+		}
+		return append(dst, "_\r\n"...)
+	case TypeBoolean:
+		if proto < 3 {
+			if v.Bool {
+				return append(dst, ":1\r\n"...)
+			}
+			return append(dst, ":0\r\n"...)
+		}
+		if v.Bool {
+			return append(dst, "#t\r\n"...)
+		}
+		return append(dst, "#f\r\n"...)
+	case TypeDouble:
+		if proto < 3 {
+			return appendBulk(dst, TypeBulkString, []byte(formatDouble(v.Float)))
+		}
+		dst = append(dst, TypeDouble)
+		dst = append(dst, formatDouble(v.Float)...)
+		return append(dst, '\r', '\n')
+	case TypeBigNumber:
+		if proto < 3 {
+			return appendBulk(dst, TypeBulkString, v.Str)
+		}
+		dst = append(dst, TypeBigNumber)
+		dst = append(dst, v.Str...)
+		return append(dst, '\r', '\n')
+	case TypeBulkError:
+		if proto < 3 {
+			dst = append(dst, TypeError)
+			dst = append(dst, bytes.Replace(v.Str, []byte("\r\n"), []byte(" "), -1)...)
+			return append(dst, '\r', '\n')
+		}
+		return appendBulk(dst, TypeBulkError, v.Str)
+	case TypeVerbatim:
+		if proto < 3 {
+			return appendBulk(dst, TypeBulkString, v.Str)
+		}
+		return appendBulk(dst, TypeVerbatim, v.Str)
+	case TypeArray, TypeSet, TypePush, TypeMap:
+		t, count := v.Type, len(v.Elems)
+		if t == TypeMap {
+			count /= 2
+		}
+		if proto < 3 {
+			t, count = TypeArray, len(v.Elems)
+		}
+		dst = append(dst, t)
+		dst = strconv.AppendInt(dst, int64(count), 10)
+		dst = append(dst, '\r', '\n')
+		for _, elem := range v.Elems {
+			dst = AppendValue(dst, elem, proto)
+		}
+		return dst
+	}
+	return appendBulk(dst, TypeBulkString, v.Str)
+}
+
+func appendBulk(dst []byte, t byte, b []byte) []byte {
+	dst = append(dst, t)
+	dst = strconv.AppendInt(dst, int64(len(b)), 10)
+	dst = append(dst, '\r', '\n')
+	dst = append(dst, b...)
+	return append(dst, '\r', '\n')
+}
+
+// appendCommand appends the command as an array of bulk strings.
+func appendCommand(dst []byte, args []string) []byte {
+	dst = append(dst, TypeArray)
+	dst = strconv.AppendInt(dst, int64(len(args)), 10)
+	dst = append(dst, '\r', '\n')
+	for _, arg := range args {
+		dst = append(dst, TypeBulkString)
+		dst = strconv.AppendInt(dst, int64(len(arg)), 10)
+		dst = append(dst, '\r', '\n')
+		dst = append(dst, arg...)
+		dst = append(dst, '\r', '\n')
+	}
+	return dst
+}
+
+func formatDouble(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	case math.IsNaN(f):
+		return "nan"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,242 @@
+// Copyright (c) 2023 cheng-zhongliang. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package resp_test
+
+import (
+	"math"
+	"strconv"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/cheng-zhongliang/event"
+	. "github.com/cheng-zhongliang/event/resp"
+)
+
+func TestParse(t *testing.T) {
+	for _, c := range []struct {
+		in   string
+		typ  byte
+		str  string
+		size int
+	}{
+		{"+OK\r\n", TypeSimpleString, "OK", 0},
+		{"-ERR bad\r\n", TypeError, "ERR bad", 0},
+		{":42\r\n", TypeInteger, "42", 0},
+		{"$5\r\nhello\r\n", TypeBulkString, "hello", 0},
+		{"$-1\r\n", TypeNull, "", 0},
+		{"*2\r\n$1\r\na\r\n:1\r\n", TypeArray, "", 2},
+		{"_\r\n", TypeNull, "", 0},
+		{"#t\r\n", TypeBoolean, "true", 0},
+		{",-inf\r\n", TypeDouble, "-inf", 0},
+		{"%1\r\n+k\r\n+v\r\n", TypeMap, "", 2},
+		{"|1\r\n+ttl\r\n:3\r\n:7\r\n", TypeInteger, "7", 0},
+		{">2\r\n+message\r\n+hi\r\n", TypePush, "", 2},
+	} {
+		v, n, err := Parse([]byte(c.in))
+		if err != nil || n != len(c.in) {
+			t.Fatalf("parse %q: %d %v", c.in, n, err)
+		}
+		if v.Type != c.typ || v.String() != c.str || len(v.Elems) != c.size {
+			t.Fatalf("parse %q: %c %q %d", c.in, v.Type, v.String(), len(v.Elems))
+		}
+		if v, n, err := Parse([]byte(c.in[:len(c.in)-1])); err != nil || n != 0 || v.Type != 0 {
+			t.Fatalf("parse incomplete %q: %d %v", c.in, n, err)
+		}
+	}
+	for _, in := range []string{"?\r\n", ":x\r\n", "$3\r\nabcde\r\n", "#x\r\n"} {
+		if _, _, err := Parse([]byte(in)); err == nil {
+			t.Fatalf("parse %q: no error", in)
+		}
+	}
+}
+
+func TestAppendValue(t *testing.T) {
+	v := Value{Type: TypeMap, Elems: []Value{
+		Bulk([]byte("a")), {Type: TypeDouble, Float: math.Inf(1)},
+		Bulk([]byte("b")), Null(),
+	}}
+	if s := string(AppendValue(nil, v, 3)); s != "%2\r\n$1\r\na\r\n,inf\r\n$1\r\nb\r\n_\r\n" {
+		t.Fatalf("resp3 %q not equal", s)
+	}
+	if s := string(AppendValue(nil, v, 2)); s != "*4\r\n$1\r\na\r\n$3\r\ninf\r\n$1\r\nb\r\n$-1\r\n" {
+		t.Fatalf("resp2 %q not equal", s)
+	}
+}
+
+func TestServerClient(t *testing.T) {
+	base, err := event.NewBase()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := map[string][]byte{}
+	s := NewServer(base)
+	s.Handle("set", func(c *ServerConn, args [][]byte) Value {
+		if len(args) != 3 {
+			return ErrorValue("ERR wrong number of arguments")
+		}
+		store[string(args[1])] = append([]byte(nil), args[2]...)
+		return SimpleString("OK")
+	})
+	s.Handle("get", func(c *ServerConn, args [][]byte) Value {
+		if v, ok := store[string(args[1])]; ok {
+			return Bulk(v)
+		}
+		return Null()
+	})
+	s.Handle("subscribe", func(c *ServerConn, args [][]byte) Value {
+		c.Push(Bulk([]byte("message")), Bulk(args[1]))
+		return SimpleString("OK")
+	})
+	ln, err := s.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sa, err := ln.Addr()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var replies []string
+	var pushes []string
+	done := int32(0)
+	err = Dial(base, "tcp", "127.0.0.1:"+strconv.Itoa(sa.(*syscall.SockaddrInet4).Port), time.Second, func(c *Client, err error, arg interface{}) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.SetPushCallback(func(v Value) {
+			pushes = append(pushes, v.Elems[1].String())
+		})
+		record := func(v Value, err error, arg interface{}) {
+			if err != nil {
+				replies = append(replies, "error "+err.Error())
+				return
+			}
+			replies = append(replies, string(v.Type)+v.String())
+		}
+		c.Do([]string{"HELLO", "3"}, record, nil)
+		c.Do([]string{"SET", "k", "v"}, record, nil)
+		c.Do([]string{"GET", "k"}, record, nil)
+		c.Do([]string{"GET", "x"}, record, nil)
+		c.Do([]string{"NOPE"}, record, nil)
+		c.Do([]string{"SUBSCRIBE", "ch"}, record, nil)
+		c.Do([]string{"QUIT"}, func(v Value, err error, arg interface{}) {
+			record(v, err, arg)
+			atomic.StoreInt32(&done, 1)
+		}, nil)
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for deadline := time.Now().Add(5 * time.Second); atomic.LoadInt32(&done) == 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("test timed out")
+		}
+		if err := base.Loop(event.EvLoopOnce); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := []string{"%", "+OK", "$v", "_", "error ERR unknown command 'NOPE'", "+OK", "+OK"}
+	if len(replies) != len(want) {
+		t.Fatalf("replies %q, want %q", replies, want)
+	}
+	for i := range want {
+		if replies[i] != want[i] {
+			t.Fatalf("replies %q, want %q", replies, want)
+		}
+	}
+	if len(pushes) != 1 || pushes[0] != "ch" {
+		t.Fatalf("pushes %q not equal", pushes)
+	}
+
+	s.Close()
+	if err := base.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestServerCommandInPieces(t *testing.T) {
+	base, err := event.NewBase()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pair, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer syscall.Close(pair[0])
+	if err := syscall.SetNonblock(pair[1], true); err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewServer(base)
+	if err := s.SetMaxBulkSize(16); err != nil {
+		t.Fatal(err)
+	}
+	s.Handle("count", func(c *ServerConn, args [][]byte) Value {
+		return Integer(int64(len(args)))
+	})
+	if err := s.ServeConn(pair[1]); err != nil {
+		t.Fatal(err)
+	}
+
+	args := make([]string, 1000)
+	args[0] = "COUNT"
+	for i := 1; i < len(args); i++ {
+		args[i] = strconv.Itoa(i)
+	}
+	var cmd []byte
+	for i := 0; i < 2; i++ {
+		cmd = append(cmd, "*"+strconv.Itoa(len(args))+"\r\n"...)
+		for _, arg := range args {
+			cmd = append(cmd, "$"+strconv.Itoa(len(arg))+"\r\n"+arg+"\r\n"...)
+		}
+	}
+	cmd = append(cmd, "*2\r\n$5\r\nCOUNT\r\n$17\r\n01234567890123456\r\n"...)
+	// the commands arrive in pieces, every one of which is read by the server.
+	// The server closes the connection on the bulk string too large.
+	for len(cmd) > 0 {
+		n := 5
+		if n > len(cmd) {
+			n = len(cmd)
+		}
+		if _, err := syscall.Write(pair[0], cmd[:n]); err == syscall.EPIPE {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		cmd = cmd[n:]
+		if err := base.Loop(event.EvLoopOnce | event.EvLoopNoblock); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	buf := make([]byte, 64)
+	var out []byte
+	for {
+		n, err := syscall.Read(pair[0], buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n == 0 {
+			break
+		}
+		out = append(out, buf[:n]...)
+	}
+	if want := ":1000\r\n:1000\r\n-ERR Protocol error\r\n"; string(out) != want {
+		t.Fatalf("replies %q, want %q", out, want)
+	}
+
+	if err := s.SetMaxBulkSize(-1); err != syscall.EINVAL {
+		t.Fatalf("error %v, want %v", err, syscall.EINVAL)
+	}
+	if err := base.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,248 @@
+// Copyright (c) 2023 cheng-zhongliang. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package resp
+
+import (
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/cheng-zhongliang/event"
+)
+
+// HandlerFunc handles a command and returns the reply.
+// The args[0] is the command name. The args are only valid until the handler returns.
+type HandlerFunc func(c *ServerConn, args [][]byte) Value
+
+// Server is the command-dispatch server of the protocol.
+// The commands HELLO and QUIT are handled by the server.
+type Server struct {
+	// base is the event base of the server.
+	base *event.EventBase
+	// handlers is the handlers by the upper case command names.
+	handlers map[string]HandlerFunc
+	// listeners is the listeners of the server.
+	listeners []*event.Listener
+	// conns is the open connections.
+	conns map[*ServerConn]struct{}
+	// maxBulk is the maximum size of a bulk string in the commands.
+	maxBulk int
+}
+
+// ServerConn is a client connection of the server.
+type ServerConn struct {
+	// Context is the state of the connection set by the handlers.
+	Context interface{}
+
+	// srv is the server of the connection.
+	srv *Server
+	// fd is the socket of the connection.
+	fd int
+	// proto is the protocol version of the connection.
+	proto int
+	// rev is the read event of the socket.
+	rev *event.Event
+	// wev is the write event of the socket.
+	wev *event.Event
+	// in is the bytes read from the socket.
+	in event.Buffer
+	// scan is the progress of the command being read.
+	scan scanner
+	// out is the bytes to write to the socket.
+	out event.Buffer
+	// buf is the scratch space to encode the replies.
+	buf []byte
+	// closing reports whether the socket is closed after the output is written.
+	closing bool
+	// closed reports whether the connection is closed.
+	closed bool
+}
+
+// NewServer creates a server on the event base.
+func NewServer(base *event.EventBase) *Server {
+	return &Server{
+		base:     base,
+		handlers: make(map[string]HandlerFunc),
+		conns:    make(map[*ServerConn]struct{}),
+		maxBulk:  maxBulkSize,
+	}
+}
+
+// SetMaxBulkSize sets the maximum size of a bulk string in the commands, 512MB by default.
+// The connection sending a larger one is closed with a protocol error.
+func (s *Server) SetMaxBulkSize(n int) error {
+	if n < 0 {
+		return syscall.EINVAL
+	}
+	s.maxBulk = n
+	return nil
+}
+
+// Handle registers the handler of the command. The name is case insensitive.
+func (s *Server) Handle(name string, handler HandlerFunc) {
+	s.handlers[strings.ToUpper(name)] = handler
+}
+
+// Listen starts accepting the connections on the address.
+func (s *Server) Listen(network, address string) (*event.Listener, error) {
+	ln, err := event.NewListener(s.base, network, address, s.onAccept, nil)
+	if err != nil {
+		return nil, err
+	}
+	s.listeners = append(s.listeners, ln)
+	return ln, nil
+}
+
+// ServeConn serves the accepted non-blocking socket.
+func (s *Server) ServeConn(fd int) error {
+	c := &ServerConn{srv: s, fd: fd, proto: 2}
+	c.rev = event.New(s.base, fd, event.EvRead|event.EvPersist, c.onRead, nil)
+	c.wev = event.New(s.base, fd, event.EvWrite|event.EvPersist, c.onWrite, nil)
+	if err := c.rev.Attach(0); err != nil {
+		return err
+	}
+	s.conns[c] = struct{}{}
+	return nil
+}
+
+// Close closes the listeners and the connections.
+func (s *Server) Close() error {
+	for _, ln := range s.listeners {
+		ln.Close()
+	}
+	s.listeners = nil
+	for c := range s.conns {
+		c.finish()
+	}
+	return nil
+}
+
+func (s *Server) onAccept(fd int, sa syscall.Sockaddr, arg interface{}) {
+	if err := s.ServeConn(fd); err != nil {
+		syscall.Close(fd)
+	}
+}
+
+// Proto returns the protocol version of the connection, 2 or 3.
+func (c *ServerConn) Proto() int {
+	return c.proto
+}
+
+// Push sends an out-of-band push value, such as a pub/sub message.
+// It is sent as an array for RESP2.
+func (c *ServerConn) Push(elems ...Value) {
+	if c.closed || c.closing {
+		return
+	}
+	c.reply(Value{Type: TypePush, Elems: elems})
+	c.flush()
+}
+
+// Close closes the connection after the pending replies are sent.
+func (c *ServerConn) Close() {
+	if c.closed || c.closing {
+		return
+	}
+	c.closing = true
+	c.rev.Detach()
+	c.flush()
+}
+
+func (c *ServerConn) onRead(fd int, events uint32, arg interface{}) {
+	_, err := c.in.ReadFd(fd)
+	if err == syscall.EAGAIN {
+		return
+	}
+	if err != nil {
+		c.finish()
+		return
+	}
+	for !c.closing && !c.closed {
+		args, n, err := c.scan.parseCommand(c.in.Bytes(), c.srv.maxBulk)
+		if err != nil {
+			c.reply(ErrorValue("ERR Protocol error"))
+			c.Close()
+			return
+		}
+		if n == 0 {
+			break
+		}
+		if len(args) > 0 {
+			c.reply(c.dispatch(args))
+		}
+		c.in.Drain(n)
+	}
+	c.flush()
+}
+
+func (c *ServerConn) onWrite(fd int, events uint32, arg interface{}) {
+	c.flush()
+}
+
+// dispatch calls the handler of the command and returns the reply.
+func (c *ServerConn) dispatch(args [][]byte) Value {
+	name := strings.ToUpper(string(args[0]))
+	switch name {
+	case "HELLO":
+		return c.hello(args)
+	case "QUIT":
+		c.closing = true
+		c.rev.Detach()
+		return SimpleString("OK")
+	}
+	handler, ok := c.srv.handlers[name]
+	if !ok {
+		return ErrorValue("ERR unknown command '" + string(args[0]) + "'")
+	}
+	return handler(c, args)
+}
+
+// hello switches the protocol version and returns the server properties.
+func (c *ServerConn) hello(args [][]byte) Value {
+	if len(args) > 1 {
+		proto, err := strconv.Atoi(string(args[1]))
+		if err != nil || proto < 2 || proto > 3 {
+			return ErrorValue("NOPROTO unsupported protocol version")
+		}
+		c.proto = proto
+	}
+	return Value{Type: TypeMap, Elems: []Value{
+		Bulk([]byte("server")), Bulk([]byte("event")),
+		Bulk([]byte("proto")), Integer(int64(c.proto)),
+	}}
+}
+
+// reply appends the encoded value to the output.
+func (c *ServerConn) reply(v Value) {
+	c.buf = AppendValue(c.buf[:0], v, c.proto)
+	c.out.Write(c.buf)
+}
+
+func (c *ServerConn) flush() {
+	if c.closed {
+		return
+	}
+	_, err := c.out.WriteFd(c.fd)
+	if err == syscall.EAGAIN {
+		c.wev.Attach(0)
+		return
+	}
+	c.wev.Detach()
+	if err != nil || c.closing {
+		c.finish()
+	}
+}
+
+// finish closes the socket of the connection.
+func (c *ServerConn) finish() {
+	if c.closed {
+		return
+	}
+	c.closed = true
+	c.rev.Detach()
+	c.wev.Detach()
+	syscall.Close(c.fd)
+	delete(c.srv.conns, c)
+}
@@ -0,0 +1,278 @@
+// Copyright (c) 2023 cheng-zhongliang. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package event
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// ListenFdsEnv is the environment variable describing the listeners inherited from the parent process.
+// The value is "fd=network:address" separated by ';'.
+const ListenFdsEnv = "EVENT_LISTEN_FDS"
+
+// ListenParentEnv is the environment variable of the pid of the process which passed the listeners.
+// Only its child adopts them, so the processes started by the child do not.
+const ListenParentEnv = "EVENT_LISTEN_PARENT"
+
+const (
+	// maxHandoffMsg is the maximum size of the listener description sent over a unix socket.
+	maxHandoffMsg = 1 << 16
+	// maxHandoffFds is the maximum number of the listeners sent over a unix socket.
+	maxHandoffFds = 64
+)
+
+var (
+	ErrHandoffMsg = errors.New("malformed listener handoff message")
+
+	// inheritedMu guards inherited, which is shared by all the event bases of the process.
+	inheritedMu sync.Mutex
+	// inherited is the listening sockets inherited from the parent process by network and address.
+	inherited map[string]int
+)
+
+// StartProcess starts the executable with the listening sockets of the listeners inherited.
+// The new process gets the listeners by InheritListener. The standard I/O is shared.
+// The unix socket paths of the listeners are no longer removed when they are closed,
+// as they are owned by the new process.
+func StartProcess(path string, args []string, listeners ...*Listener) (*os.Process, error) {
+	files := []uintptr{0, 1, 2}
+	descs := make([]string, 0, len(listeners))
+	for i, ln := range listeners {
+		files = append(files, uintptr(ln.fd))
+		descs = append(descs, strconv.Itoa(3+i)+"="+ln.network+":"+ln.address)
+	}
+	env := make([]string, 0, len(os.Environ())+2)
+	for _, kv := range os.Environ() {
+		if !strings.HasPrefix(kv, ListenFdsEnv+"=") && !strings.HasPrefix(kv, ListenParentEnv+"=") {
+			env = append(env, kv)
+		}
+	}
+	env = append(env, ListenFdsEnv+"="+strings.Join(descs, ";"), ListenParentEnv+"="+strconv.Itoa(os.Getpid()))
+	pid, err := syscall.ForkExec(path, args, &syscall.ProcAttr{Env: env, Files: files})
+	if err != nil {
+		return nil, err
+	}
+	for _, ln := range listeners {
+		ln.path = ""
+	}
+	return os.FindProcess(pid)
+}
+
+// SendListeners sends the listening sockets of the listeners over the unix socket.
+// The receiving process gets the listeners by RecvListeners and InheritListener.
+// The unix socket paths of the listeners are no longer removed when they are closed.
+func SendListeners(fd int, listeners ...*Listener) error {
+	if len(listeners) == 0 || len(listeners) > maxHandoffFds {
+		return ErrHandoffMsg
+	}
+	fds := make([]int, 0, len(listeners))
+	descs := make([]string, 0, len(listeners))
+	for _, ln := range listeners {
+		fds = append(fds, ln.fd)
+		descs = append(descs, ln.network+":"+ln.address)
+	}
+	if _, err := SendFds(fd, []byte(strings.Join(descs, ";")), fds...); err != nil {
+		return err
+	}
+	for _, ln := range listeners {
+		ln.path = ""
+	}
+	return nil
+}
+
+// RecvListeners receives the listening sockets sent by SendListeners from the unix socket.
+// They are used by InheritListener afterwards.
+func RecvListeners(fd int) error {
+	buf := make([]byte, maxHandoffMsg)
+	n, fds, err := RecvFds(fd, buf, maxHandoffFds)
+	if err != nil {
+		return err
+	}
+	descs := strings.Split(string(buf[:n]), ";")
+	if len(descs) != len(fds) {
+		closeFds(fds)
+		return ErrHandoffMsg
+	}
+	inheritedMu.Lock()
+	defer inheritedMu.Unlock()
+	loadInherited()
+	for i, desc := range descs {
+		if old, ok := inherited[desc]; ok {
+			syscall.Close(old)
+		}
+		inherited[desc] = fds[i]
+	}
+	return nil
+}
+
+// InheritListener creates a listener like NewListener, with the listening socket
+// inherited from the parent process if it passed one on the same network and address.
+func InheritListener(base *EventBase, network, address string, callback func(fd int, sa syscall.Sockaddr, arg interface{}), arg interface{}) (*Listener, error) {
+	key := network + ":" + address
+	inheritedMu.Lock()
+	loadInherited()
+	fd, ok := inherited[key]
+	delete(inherited, key)
+	inheritedMu.Unlock()
+	if !ok {
+		return NewListener(base, network, address, callback, arg)
+	}
+	if err := syscall.SetNonblock(fd, true); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+	path := ""
+	if network == "unix" {
+		path = address
+	}
+	return newListener(base, fd, network, address, path, callback, arg)
+}
+
+// loadInherited parses the listening sockets inherited by the environment once.
+// The environment is removed, so the processes started afterwards do not inherit it.
+// It is called with inheritedMu held.
+func loadInherited() {
+	if inherited != nil {
+		return
+	}
+	inherited = make(map[string]int)
+	value := os.Getenv(ListenFdsEnv)
+	parent := os.Getenv(ListenParentEnv)
+	os.Unsetenv(ListenFdsEnv)
+	os.Unsetenv(ListenParentEnv)
+	if value == "" || parent != strconv.Itoa(os.Getppid()) {
+		return
+	}
+	for _, desc := range strings.Split(value, ";") {
+		i := strings.IndexByte(desc, '=')
+		if i < 0 {
+			continue
+		}
+		fd, err := strconv.Atoi(desc[:i])
+		if err != nil || fd < 3 {
+			continue
+		}
+		syscall.CloseOnExec(fd)
+		inherited[desc[i+1:]] = fd
+	}
+}
+
+// Graceful tracks the listeners and the open connections of a process for a graceful restart.
+// The old process hands the listeners off, stops accepting and drains the connections,
+// then the event base is shut down so that its loop returns and the process can exit.
+//
+// The connections accepted by the listeners of Graceful are counted automatically.
+// As their fds are owned by the callback, Done must be called when one is closed.
+type Graceful struct {
+	// base is the event base of the process.
+	base *EventBase
+	// listeners is the listeners to hand off.
+	listeners []*Listener
+	// conns is the number of the open connections.
+	conns int
+	// timer is the timer event of the drain deadline.
+	timer *Event
+	// draining reports whether the connections are being drained.
+	draining bool
+	// cb is the callback function when the drain completes.
+	cb func(drained bool, arg interface{})
+	// arg is the argument passed to the callback function.
+	arg interface{}
+}
+
+// NewGraceful creates a graceful restart helper on the event base.
+func NewGraceful(base *EventBase) *Graceful {
+	g := &Graceful{base: base}
+	g.timer = NewTimer(base, g.onDeadline, nil)
+	return g
+}
+
+// Listen creates a listener by InheritListener and tracks it for the handoff.
+// Every accepted connection is added to the connections to drain.
+func (g *Graceful) Listen(network, address string, callback func(fd int, sa syscall.Sockaddr, arg interface{}), arg interface{}) (*Listener, error) {
+	ln, err := InheritListener(g.base, network, address, func(fd int, sa syscall.Sockaddr, arg interface{}) {
+		g.conns++
+		callback(fd, sa, arg)
+	}, arg)
+	if err != nil {
+		return nil, err
+	}
+	g.listeners = append(g.listeners, ln)
+	return ln, nil
+}
+
+// Listeners returns the tracked listeners.
+func (g *Graceful) Listeners() []*Listener {
+	return g.listeners
+}
+
+// Add adds a connection to drain, which is not accepted by the listeners of Graceful.
+func (g *Graceful) Add() {
+	g.conns++
+}
+
+// Done removes a connection to drain. It is called when a connection is closed.
+func (g *Graceful) Done() {
+	g.conns--
+	if g.draining && g.conns <= 0 {
+		g.finish(true)
+	}
+}
+
+// Conns returns the number of the open connections.
+func (g *Graceful) Conns() int {
+	return g.conns
+}
+
+// Restart starts the executable with the listeners inherited and drains the connections.
+// See StartProcess and Drain.
+func (g *Graceful) Restart(path string, args []string, timeout time.Duration, callback func(drained bool, arg interface{}), arg interface{}) (*os.Process, error) {
+	p, err := StartProcess(path, args, g.listeners...)
+	if err != nil {
+		return nil, err
+	}
+	g.Drain(timeout, callback, arg)
+	return p, nil
+}
+
+// Drain closes the listeners and waits for the open connections to be closed.
+// The callback is called with true when all are closed, or with false when the timeout expires.
+// After the callback returns, the event base is shut down and its loop returns.
+func (g *Graceful) Drain(timeout time.Duration, callback func(drained bool, arg interface{}), arg interface{}) {
+	for _, ln := range g.listeners {
+		ln.Close()
+	}
+	g.listeners = nil
+	g.draining = true
+	g.cb = callback
+	g.arg = arg
+	if g.conns <= 0 {
+		g.timer.Attach(0)
+		return
+	}
+	g.timer.Attach(timeout)
+}
+
+func (g *Graceful) onDeadline(fd int, events uint32, arg interface{}) {
+	g.finish(g.conns <= 0)
+}
+
+func (g *Graceful) finish(drained bool) {
+	if !g.draining {
+		return
+	}
+	g.draining = false
+	g.timer.Detach()
+	if g.cb != nil {
+		g.cb(drained, g.arg)
+	}
+	g.base.Shutdown()
+}
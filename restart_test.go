@@ -0,0 +1,248 @@
+// Copyright (c) 2023 cheng-zhongliang. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package event_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+
+	. "github.com/cheng-zhongliang/event"
+)
+
+func TestStartProcess(t *testing.T) {
+	base, err := NewBase()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ln, err := NewListener(base, "tcp", "127.0.0.1:0", func(fd int, sa syscall.Sockaddr, arg interface{}) {}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	dir, err := ioutil.TempDir("", "event")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	out := filepath.Join(dir, "env")
+	p, err := StartProcess("/bin/sh", []string{"sh", "-c", `test -S /dev/fd/3 && printf %s "$EVENT_LISTEN_FDS,$EVENT_LISTEN_PARENT" > "$0"`, out}, ln)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, err := p.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !state.Success() {
+		t.Fatal("listening socket not inherited")
+	}
+	env, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "3=tcp:127.0.0.1:0," + strconv.Itoa(os.Getpid()); string(env) != want {
+		t.Fatalf("env %q, want %q", env, want)
+	}
+
+	if err := base.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInheritListener(t *testing.T) {
+	base, err := NewBase()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ln, err := NewListener(base, "tcp", "127.0.0.1:0", func(fd int, sa syscall.Sockaddr, arg interface{}) {}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	dir, err := ioutil.TempDir("", "event")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// the child of the test process adopts the listener, but not a process claiming another parent.
+	for _, c := range []struct {
+		env  string
+		want string
+	}{
+		{"", "adopt"},
+		{"EVENT_LISTEN_PARENT=1", "ignore"},
+	} {
+		out := filepath.Join(dir, c.want)
+		script := c.env + ` EVENT_TEST_INHERIT=` + c.want + ` exec "$0" -test.run=^TestInheritChild$ > "$1" 2>&1`
+		p, err := StartProcess("/bin/sh", []string{"sh", "-c", script, os.Args[0], out}, ln)
+		if err != nil {
+			t.Fatal(err)
+		}
+		state, err := p.Wait()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !state.Success() {
+			log, _ := ioutil.ReadFile(out)
+			t.Fatalf("%s: child failed: %s", c.want, log)
+		}
+	}
+
+	if err := base.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestInheritChild runs in the process started by TestInheritListener.
+func TestInheritChild(t *testing.T) {
+	want := os.Getenv("EVENT_TEST_INHERIT")
+	if want == "" {
+		t.Skip("not started by TestInheritListener")
+	}
+	base, err := NewBase()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := InheritListener(base, "tcp", "127.0.0.1:0", func(fd int, sa syscall.Sockaddr, arg interface{}) {}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	if adopted := ln.Fd() == 3; adopted != (want == "adopt") {
+		t.Fatalf("fd %d adopted %v, want %s", ln.Fd(), adopted, want)
+	}
+	if os.Getenv(ListenFdsEnv) != "" || os.Getenv(ListenParentEnv) != "" {
+		t.Fatal("environment not removed")
+	}
+	if err := base.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestListenerHandoff(t *testing.T) {
+	oldBase, err := NewBase()
+	if err != nil {
+		t.Fatal(err)
+	}
+	base, err := NewBase()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pair, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer syscall.Close(pair[0])
+	defer syscall.Close(pair[1])
+
+	dir, err := ioutil.TempDir("", "event")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "sock")
+	old := NewGraceful(oldBase)
+	ln, err := old.Listen("unix", path, func(fd int, sa syscall.Sockaddr, arg interface{}) {}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SendListeners(pair[0], old.Listeners()...); err != nil {
+		t.Fatal(err)
+	}
+	if err := RecvListeners(pair[1]); err != nil {
+		t.Fatal(err)
+	}
+
+	accepted := 0
+	g := NewGraceful(base)
+	newLn, err := g.Listen("unix", path, func(fd int, sa syscall.Sockaddr, arg interface{}) {
+		accepted++
+		syscall.Close(fd)
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if newLn.Fd() == ln.Fd() {
+		t.Fatal("listening socket not passed")
+	}
+
+	drained := make(chan bool, 1)
+	old.Add()
+	old.Drain(time.Second, func(ok bool, arg interface{}) {
+		drained <- ok
+	}, nil)
+	if _, err := os.Stat(path); err != nil {
+		t.Fatal("socket path removed by the old listener")
+	}
+
+	fd, err := syscall.Socket(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer syscall.Close(fd)
+	if err := syscall.Connect(fd, &syscall.SockaddrUnix{Name: path}); err != nil {
+		t.Fatal(err)
+	}
+	if err := base.Loop(EvLoopOnce); err != nil {
+		t.Fatal(err)
+	}
+	if accepted != 1 || g.Conns() != 1 {
+		t.Fatalf("accepted %d conns %d, want 1 1", accepted, g.Conns())
+	}
+
+	old.Done()
+	if ok := <-drained; !ok {
+		t.Fatal("connections not drained")
+	}
+	if err := oldBase.Loop(EvLoopOnce); err == nil {
+		t.Fatal("old base not shut down after the drain")
+	}
+
+	newLn.Close()
+	if err := base.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGracefulTimeout(t *testing.T) {
+	base, err := NewBase()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g := NewGraceful(base)
+	if _, err := g.Listen("tcp", "127.0.0.1:0", func(fd int, sa syscall.Sockaddr, arg interface{}) {}, nil); err != nil {
+		t.Fatal(err)
+	}
+	g.Add()
+	result := ""
+	g.Drain(10*time.Millisecond, func(ok bool, arg interface{}) {
+		result = strconv.FormatBool(ok)
+	}, nil)
+	for deadline := time.Now().Add(time.Second); result == "" && time.Now().Before(deadline); {
+		if err := base.Loop(EvLoopOnce); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if result != "false" || g.Conns() != 1 {
+		t.Fatalf("drained %q conns %d, want false 1", result, g.Conns())
+	}
+	if err := base.Loop(EvLoopOnce); err == nil {
+		t.Fatal("base not shut down after the drain")
+	}
+}
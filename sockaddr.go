@@ -0,0 +1,89 @@
+// Copyright (c) 2023 cheng-zhongliang. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package event
+
+import (
+	"net"
+	"strconv"
+	"syscall"
+)
+
+// resolveSockaddr resolves the address on the named network.
+// It returns the address family and the socket address.
+func resolveSockaddr(network, address string) (int, syscall.Sockaddr, error) {
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+		addr, err := net.ResolveTCPAddr(network, address)
+		if err != nil {
+			return 0, nil, err
+		}
+		return ipSockaddr(network, addr.IP, addr.Port, addr.Zone)
+	case "udp", "udp4", "udp6":
+		addr, err := net.ResolveUDPAddr(network, address)
+		if err != nil {
+			return 0, nil, err
+		}
+		return ipSockaddr(network, addr.IP, addr.Port, addr.Zone)
+	case "unix", "unixgram":
+		return syscall.AF_UNIX, &syscall.SockaddrUnix{Name: address}, nil
+	}
+	return 0, nil, net.UnknownNetworkError(network)
+}
+
+func ipSockaddr(network string, ip net.IP, port int, zone string) (int, syscall.Sockaddr, error) {
+	last := network[len(network)-1]
+	if ip4 := ip.To4(); last != '6' && (ip4 != nil || len(ip) == 0) {
+		sa := &syscall.SockaddrInet4{Port: port}
+		copy(sa.Addr[:], ip4)
+		return syscall.AF_INET, sa, nil
+	}
+	if last == '4' {
+		return 0, nil, &net.AddrError{Err: "non-IPv4 address", Addr: ip.String()}
+	}
+	sa := &syscall.SockaddrInet6{Port: port}
+	copy(sa.Addr[:], ip.To16())
+	if zone != "" {
+		if ifi, err := net.InterfaceByName(zone); err == nil {
+			sa.ZoneId = uint32(ifi.Index)
+		}
+	}
+	return syscall.AF_INET6, sa, nil
+}
+
+// sockaddrNetwork returns the stream network and the address of the socket address,
+// and the path of a unix socket bound in the file system.
+func sockaddrNetwork(sa syscall.Sockaddr) (string, string, string) {
+	switch sa := sa.(type) {
+	case *syscall.SockaddrInet4:
+		return "tcp", net.JoinHostPort(net.IP(sa.Addr[:]).String(), strconv.Itoa(sa.Port)), ""
+	case *syscall.SockaddrInet6:
+		return "tcp", net.JoinHostPort(net.IP(sa.Addr[:]).String(), strconv.Itoa(sa.Port)), ""
+	case *syscall.SockaddrUnix:
+		if sa.Name == "" || sa.Name[0] == '@' {
+			return "unix", sa.Name, ""
+		}
+		return "unix", sa.Name, sa.Name
+	}
+	return "", "", ""
+}
+
+// sockaddrToAddr converts the socket address of a stream socket to net.Addr.
+func sockaddrToAddr(sa syscall.Sockaddr) net.Addr {
+	switch sa := sa.(type) {
+	case *syscall.SockaddrInet4:
+		return &net.TCPAddr{IP: append(net.IP(nil), sa.Addr[:]...), Port: sa.Port}
+	case *syscall.SockaddrInet6:
+		addr := &net.TCPAddr{IP: append(net.IP(nil), sa.Addr[:]...), Port: sa.Port}
+		if sa.ZoneId != 0 {
+			if ifi, err := net.InterfaceByIndex(int(sa.ZoneId)); err == nil {
+				addr.Zone = ifi.Name
+			}
+		}
+		return addr
+	case *syscall.SockaddrUnix:
+		return &net.UnixAddr{Name: sa.Name, Net: "unix"}
+	}
+	return nil
+}
@@ -0,0 +1,11 @@
+// Copyright (c) 2023 cheng-zhongliang. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build linux && !mips && !mipsle && !mips64 && !mips64le
+// +build linux,!mips,!mipsle,!mips64,!mips64le
+
+package event
+
+// soReusePort is SO_REUSEPORT, which is missing from syscall on some architectures.
+const soReusePort = 0xf
@@ -0,0 +1,16 @@
+// Copyright (c) 2023 cheng-zhongliang. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build linux && !386 && !amd64
+// +build linux,!386,!amd64
+
+package event
+
+import (
+	"syscall"
+)
+
+const (
+	sysSendmmsg = syscall.SYS_SENDMMSG
+)
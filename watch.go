@@ -0,0 +1,133 @@
+// Copyright (c) 2023 cheng-zhongliang. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package event
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// The operations of the file-system changes.
+const (
+	// WatchCreate is a file created in a watched directory.
+	WatchCreate = 1 << iota
+	// WatchWrite is the content of a file modified.
+	// On kqueue it is also a directory whose entries are created or removed.
+	WatchWrite
+	// WatchRemove is a file removed.
+	WatchRemove
+	// WatchRename is a file renamed or moved.
+	WatchRename
+	// WatchAttrib is the metadata of a file changed.
+	WatchAttrib
+	// WatchOverflow is the changes dropped by the kernel. The path is empty.
+	WatchOverflow
+)
+
+var (
+	ErrWatchNotExists = errors.New("watch does not exist")
+	ErrRecursiveWatch = errors.New("recursive watch not supported")
+)
+
+// Watcher watches the file-system changes by inotify on Linux and EVFILT_VNODE on kqueue.
+// The changes are reported through the callback function with the path and the operations.
+type Watcher struct {
+	// ev is the read event of the watch fd.
+	ev *Event
+	// fd is the inotify fd or the private kqueue.
+	fd int
+	// paths is the watched paths by the watch descriptors.
+	paths map[int]string
+	// ids is the watch descriptors by the watched paths.
+	ids map[string]int
+	// recursive is the directories watched recursively.
+	recursive map[string]bool
+	// buf is the buffer to read the changes.
+	buf []byte
+	// cb is the callback function of the changes.
+	cb func(path string, op uint32, arg interface{})
+	// arg is the argument passed to the callback function.
+	arg interface{}
+}
+
+// NewWatcher creates a watcher on the event base.
+func NewWatcher(base *EventBase, callback func(path string, op uint32, arg interface{}), arg interface{}) (*Watcher, error) {
+	fd, err := openWatchFd()
+	if err != nil {
+		return nil, err
+	}
+	w := &Watcher{
+		fd:        fd,
+		paths:     make(map[int]string),
+		ids:       make(map[string]int),
+		recursive: make(map[string]bool),
+		cb:        callback,
+		arg:       arg,
+	}
+	w.ev = New(base, fd, EvRead|EvPersist, w.onRead, nil)
+	if err := w.ev.Attach(0); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+	return w, nil
+}
+
+// Add watches the file or the directory. The changes of the entries of a directory
+// are reported with their paths on Linux, and as WatchWrite of the directory on kqueue.
+func (w *Watcher) Add(path string) error {
+	path = filepath.Clean(path)
+	if _, ok := w.ids[path]; ok {
+		return nil
+	}
+	id, err := w.addWatch(path)
+	if err != nil {
+		return err
+	}
+	w.paths[id] = path
+	w.ids[path] = id
+	return nil
+}
+
+// Remove stops watching the path, and its subdirectories if it is watched recursively.
+func (w *Watcher) Remove(path string) error {
+	path = filepath.Clean(path)
+	id, ok := w.ids[path]
+	if !ok {
+		return ErrWatchNotExists
+	}
+	if w.recursive[path] {
+		prefix := path + string(filepath.Separator)
+		for p, sub := range w.ids {
+			if strings.HasPrefix(p, prefix) {
+				w.forget(sub)
+				w.rmWatch(sub)
+			}
+		}
+	}
+	w.forget(id)
+	return w.rmWatch(id)
+}
+
+// Close stops watching all the paths.
+func (w *Watcher) Close() error {
+	w.ev.Detach()
+	for id := range w.paths {
+		w.rmWatch(id)
+	}
+	w.paths = nil
+	w.ids = nil
+	return syscall.Close(w.fd)
+}
+
+// forget drops the watch of a path removed from the file system.
+func (w *Watcher) forget(id int) {
+	if path, ok := w.paths[id]; ok {
+		delete(w.ids, path)
+		delete(w.recursive, path)
+		delete(w.paths, id)
+	}
+}
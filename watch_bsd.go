@@ -0,0 +1,88 @@
+// Copyright (c) 2023 cheng-zhongliang. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build darwin || dragonfly || freebsd || netbsd || openbsd
+// +build darwin dragonfly freebsd netbsd openbsd
+
+package event
+
+import (
+	"syscall"
+)
+
+const (
+	// vnodeNotes is the changes watched by EVFILT_VNODE.
+	vnodeNotes = syscall.NOTE_DELETE | syscall.NOTE_WRITE | syscall.NOTE_EXTEND |
+		syscall.NOTE_ATTRIB | syscall.NOTE_LINK | syscall.NOTE_RENAME
+	// maxVnodeEvents is the maximum number of the changes read at once.
+	maxVnodeEvents = 0x40
+)
+
+func openWatchFd() (int, error) {
+	return openKqueue()
+}
+
+// AddRecursive is only supported on Linux.
+func (w *Watcher) AddRecursive(path string) error {
+	return ErrRecursiveWatch
+}
+
+// addWatch opens the path and registers the EVFILT_VNODE filter of the fd,
+// which is used as the watch descriptor.
+func (w *Watcher) addWatch(path string) (int, error) {
+	fd, err := syscall.Open(path, syscall.O_RDONLY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return -1, err
+	}
+	var change syscall.Kevent_t
+	syscall.SetKevent(&change, fd, syscall.EVFILT_VNODE, syscall.EV_ADD|syscall.EV_CLEAR)
+	change.Fflags = vnodeNotes
+	if _, err := syscall.Kevent(w.fd, []syscall.Kevent_t{change}, nil, nil); err != nil {
+		syscall.Close(fd)
+		return -1, err
+	}
+	return fd, nil
+}
+
+// rmWatch closes the fd of the watch, which removes the filter.
+func (w *Watcher) rmWatch(id int) error {
+	return syscall.Close(id)
+}
+
+func (w *Watcher) onRead(fd int, events uint32, arg interface{}) {
+	var changes [maxVnodeEvents]syscall.Kevent_t
+	n, err := readKqueue(fd, changes[:])
+	if err != nil {
+		return
+	}
+	for i := 0; i < n; i++ {
+		id := int(changes[i].Ident)
+		path, ok := w.paths[id]
+		if !ok {
+			continue
+		}
+		fflags := changes[i].Fflags
+		op := uint32(0)
+		if fflags&(syscall.NOTE_WRITE|syscall.NOTE_EXTEND) != 0 {
+			op |= WatchWrite
+		}
+		if fflags&syscall.NOTE_DELETE != 0 {
+			op |= WatchRemove
+		}
+		if fflags&syscall.NOTE_RENAME != 0 {
+			op |= WatchRename
+		}
+		if fflags&(syscall.NOTE_ATTRIB|syscall.NOTE_LINK) != 0 {
+			op |= WatchAttrib
+		}
+		if op&(WatchRemove|WatchRename) != 0 {
+			// the fd refers to the old file, which is no longer at the path.
+			w.forget(id)
+			syscall.Close(id)
+		}
+		if op != 0 {
+			w.cb(path, op, w.arg)
+		}
+	}
+}
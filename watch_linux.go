@@ -0,0 +1,121 @@
+// Copyright (c) 2023 cheng-zhongliang. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build linux
+// +build linux
+
+package event
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	// inotifyMask is the changes watched by inotify.
+	inotifyMask = syscall.IN_CREATE | syscall.IN_MOVED_TO | syscall.IN_MODIFY |
+		syscall.IN_DELETE | syscall.IN_DELETE_SELF | syscall.IN_MOVED_FROM |
+		syscall.IN_MOVE_SELF | syscall.IN_ATTRIB
+	// inotifyBufferSize is the size of the buffer to read the changes.
+	inotifyBufferSize = 0x10000
+)
+
+func openWatchFd() (int, error) {
+	return syscall.InotifyInit1(syscall.IN_NONBLOCK | syscall.IN_CLOEXEC)
+}
+
+// AddRecursive watches the directory and all its subdirectories,
+// including the subdirectories created later. It is only supported on Linux.
+func (w *Watcher) AddRecursive(path string) error {
+	path = filepath.Clean(path)
+	return filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			if p == path {
+				return err
+			}
+			return nil
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		if err := w.Add(p); err != nil {
+			return err
+		}
+		w.recursive[p] = true
+		return nil
+	})
+}
+
+func (w *Watcher) addWatch(path string) (int, error) {
+	return syscall.InotifyAddWatch(w.fd, path, inotifyMask)
+}
+
+func (w *Watcher) rmWatch(id int) error {
+	_, err := syscall.InotifyRmWatch(w.fd, uint32(id))
+	return err
+}
+
+func (w *Watcher) onRead(fd int, events uint32, arg interface{}) {
+	if w.buf == nil {
+		w.buf = make([]byte, inotifyBufferSize)
+	}
+	n, err := syscall.Read(fd, w.buf)
+	if err != nil || n <= 0 {
+		return
+	}
+	var ie syscall.InotifyEvent
+	header := (*[syscall.SizeofInotifyEvent]byte)(unsafe.Pointer(&ie))[:]
+	for off := 0; off+syscall.SizeofInotifyEvent <= n; {
+		copy(header, w.buf[off:])
+		nameOff := off + syscall.SizeofInotifyEvent
+		off = nameOff + int(ie.Len)
+		if ie.Mask&syscall.IN_Q_OVERFLOW != 0 {
+			w.cb("", WatchOverflow, w.arg)
+			continue
+		}
+		dir, ok := w.paths[int(ie.Wd)]
+		if !ok {
+			continue
+		}
+		if ie.Mask&syscall.IN_IGNORED != 0 {
+			w.forget(int(ie.Wd))
+			continue
+		}
+		path := dir
+		if ie.Len > 0 {
+			name := w.buf[nameOff : nameOff+int(ie.Len)]
+			for i, c := range name {
+				if c == 0 {
+					name = name[:i]
+					break
+				}
+			}
+			path = filepath.Join(dir, string(name))
+		}
+		op := uint32(0)
+		if ie.Mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0 {
+			op |= WatchCreate
+		}
+		if ie.Mask&syscall.IN_MODIFY != 0 {
+			op |= WatchWrite
+		}
+		if ie.Mask&(syscall.IN_DELETE|syscall.IN_DELETE_SELF) != 0 {
+			op |= WatchRemove
+		}
+		if ie.Mask&(syscall.IN_MOVED_FROM|syscall.IN_MOVE_SELF) != 0 {
+			op |= WatchRename
+		}
+		if ie.Mask&syscall.IN_ATTRIB != 0 {
+			op |= WatchAttrib
+		}
+		if op&WatchCreate != 0 && ie.Mask&syscall.IN_ISDIR != 0 && w.recursive[dir] {
+			w.AddRecursive(path)
+		}
+		if op != 0 {
+			w.cb(path, op, w.arg)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright (c) 2023 cheng-zhongliang. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build linux
+// +build linux
+
+package event_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/cheng-zhongliang/event"
+)
+
+func TestWatcherRecursive(t *testing.T) {
+	base, err := NewBase()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "event")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	changes := map[string]uint32{}
+	w, err := NewWatcher(base, func(path string, op uint32, arg interface{}) {
+		changes[path] |= op
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.AddRecursive(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	sub := filepath.Join(dir, "sub")
+	if err := os.Mkdir(sub, 0700); err != nil {
+		t.Fatal(err)
+	}
+	waitChange(t, base, changes, sub, WatchCreate)
+
+	file := filepath.Join(sub, "file")
+	if err := ioutil.WriteFile(file, []byte("a"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	waitChange(t, base, changes, file, WatchCreate)
+
+	moved := filepath.Join(dir, "moved")
+	if err := os.Rename(file, moved); err != nil {
+		t.Fatal(err)
+	}
+	waitChange(t, base, changes, file, WatchRename)
+	waitChange(t, base, changes, moved, WatchCreate)
+
+	if err := w.Remove(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Remove(sub); err != ErrWatchNotExists {
+		t.Fatalf("error %v, want %v", err, ErrWatchNotExists)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := base.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright (c) 2023 cheng-zhongliang. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package event_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/cheng-zhongliang/event"
+)
+
+// waitChange runs the loop until the operation of the path is reported.
+func waitChange(t *testing.T, base *EventBase, changes map[string]uint32, path string, op uint32) {
+	for deadline := time.Now().Add(time.Second); changes[path]&op == 0; {
+		if time.Now().After(deadline) {
+			t.Fatalf("change %d of %s not reported: %v", op, path, changes)
+		}
+		if err := base.Loop(EvLoopOnce | EvLoopNoblock); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	base, err := NewBase()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "event")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "config")
+	if err := ioutil.WriteFile(file, []byte("a"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	changes := map[string]uint32{}
+	w, err := NewWatcher(base, func(path string, op uint32, arg interface{}) {
+		changes[path] |= op
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Add(file); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("b")
+	f.Close()
+	waitChange(t, base, changes, file, WatchWrite)
+
+	if err := os.Remove(file); err != nil {
+		t.Fatal(err)
+	}
+	waitChange(t, base, changes, file, WatchRemove|WatchAttrib)
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := base.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,547 @@
+// Copyright (c) 2023 cheng-zhongliang. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package websocket implements the WebSocket protocol of RFC 6455 on the event loop.
+package websocket
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"github.com/cheng-zhongliang/event"
+)
+
+// The opcodes of the frames.
+const (
+	OpContinuation = 0x0
+	OpText         = 0x1
+	OpBinary       = 0x2
+	OpClose        = 0x8
+	OpPing         = 0x9
+	OpPong         = 0xa
+)
+
+// The status codes of the close frames.
+const (
+	CloseNormal           = 1000
+	CloseGoingAway        = 1001
+	CloseProtocolError    = 1002
+	CloseUnsupportedData  = 1003
+	CloseNoStatus         = 1005
+	CloseAbnormal         = 1006
+	CloseInvalidPayload   = 1007
+	ClosePolicyViolation  = 1008
+	CloseMessageTooBig    = 1009
+	CloseInternalError    = 1011
+	DefaultMaxMessageSize = 1 << 20
+)
+
+const (
+	// connHandshake is the state to wait for the handshake response of the client.
+	connHandshake = iota
+	// connOpen is the state when messages can be sent and received.
+	connOpen
+	// connClosing is the state after the close frame is sent.
+	connClosing
+	// connClosed is the state when the connection is closed.
+	connClosed
+)
+
+const (
+	// closeTimeout is the timeout to wait for the peer to complete the close handshake.
+	closeTimeout = 5 * time.Second
+	// maxControlPayload is the maximum payload size of the control frames.
+	maxControlPayload = 125
+)
+
+var (
+	ErrClosed       = errors.New("websocket connection closed")
+	ErrBadHandshake = errors.New("websocket bad handshake")
+
+	// errMessageTooBig is the error of a decompressed message exceeding the maximum size.
+	errMessageTooBig = errors.New("websocket message too big")
+
+	// deflateTail is appended to a compressed message to terminate the deflate stream.
+	deflateTail = []byte{0x00, 0x00, 0xff, 0xff, 0x01, 0x00, 0x00, 0xff, 0xff}
+)
+
+// Config is the configuration of a connection.
+type Config struct {
+	// Compression enables the permessage-deflate extension if the peer supports it.
+	Compression bool
+	// MaxMessageSize is the maximum size of a received message. Zero means DefaultMaxMessageSize.
+	MaxMessageSize int
+	// FragmentSize is the maximum payload size of a sent frame. Zero means no fragmentation.
+	FragmentSize int
+	// Subprotocols is the subprotocols in the order of preference.
+	Subprotocols []string
+}
+
+// Conn is the WebSocket connection.
+type Conn struct {
+	// fd is the socket of the connection.
+	fd int
+	// client reports whether the connection is the client side, which masks the frames.
+	client bool
+	// compress reports whether the permessage-deflate extension is negotiated.
+	compress bool
+	// maxSize is the maximum size of a received message.
+	maxSize int
+	// fragmentSize is the maximum payload size of a sent frame.
+	fragmentSize int
+	// subprotocol is the negotiated subprotocol.
+	subprotocol string
+	// rev is the read event of the socket.
+	rev *event.Event
+	// wev is the write event of the socket.
+	wev *event.Event
+	// timer is the timer event of the close handshake.
+	timer *event.Event
+	// in is the bytes read from the socket.
+	in event.Buffer
+	// out is the bytes to write to the socket.
+	out event.Buffer
+	// state is the state of the connection.
+	state int
+	// closeAfterFlush reports whether the socket is closed after the output is written.
+	closeAfterFlush bool
+	// msgOp is the opcode of the fragmented message being received.
+	msgOp int
+	// msgCompressed reports whether the message being received is compressed.
+	msgCompressed bool
+	// msg is the payload of the fragmented message being received.
+	msg []byte
+	// closeCode is the status code of the close frame received.
+	closeCode int
+	// closeReason is the reason of the close frame received.
+	closeReason string
+	// handshakeKey is the Sec-WebSocket-Key of the client handshake.
+	handshakeKey string
+	// subprotocols is the subprotocols offered by the client.
+	subprotocols []string
+	// offerDeflate reports whether the client offered the permessage-deflate extension.
+	offerDeflate bool
+	// onOpen is the callback function when the client handshake completes or fails.
+	onOpen func(c *Conn, err error)
+	// onMessage is the callback function when a message is received.
+	onMessage func(c *Conn, op int, data []byte)
+	// onClose is the callback function when the connection is closed.
+	onClose func(c *Conn, code int, reason string)
+}
+
+func newConn(base *event.EventBase, fd int, client bool, config *Config) (*Conn, error) {
+	c := new(Conn)
+	c.fd = fd
+	c.client = client
+	c.maxSize = DefaultMaxMessageSize
+	if config != nil {
+		if config.MaxMessageSize > 0 {
+			c.maxSize = config.MaxMessageSize
+		}
+		c.fragmentSize = config.FragmentSize
+	}
+	c.rev = event.New(base, fd, event.EvRead|event.EvPersist, c.onRead, nil)
+	c.wev = event.New(base, fd, event.EvWrite|event.EvPersist, c.onWrite, nil)
+	c.timer = event.NewTimer(base, c.onTimeout, nil)
+	if err := c.rev.Attach(0); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// OnMessage sets the callback function when a message is received.
+// The op is OpText, OpBinary or OpPong. The pings are answered automatically.
+// The data is only valid until the callback returns.
+func (c *Conn) OnMessage(callback func(c *Conn, op int, data []byte)) {
+	c.onMessage = callback
+}
+
+// OnClose sets the callback function when the connection is closed.
+// The code is CloseAbnormal if the connection is closed without the close handshake.
+func (c *Conn) OnClose(callback func(c *Conn, code int, reason string)) {
+	c.onClose = callback
+}
+
+// Subprotocol returns the negotiated subprotocol.
+func (c *Conn) Subprotocol() string {
+	return c.subprotocol
+}
+
+// Fd returns the file descriptor of the connection.
+func (c *Conn) Fd() int {
+	return c.fd
+}
+
+// WriteMessage sends a message. The op is OpText or OpBinary.
+// The message is split into frames of the fragment size if it is set.
+func (c *Conn) WriteMessage(op int, data []byte) error {
+	if c.state != connOpen {
+		return ErrClosed
+	}
+	if op != OpText && op != OpBinary {
+		return errors.New("websocket invalid message opcode")
+	}
+	compressed := false
+	if c.compress && len(data) > 0 {
+		data = compressMessage(data)
+		compressed = true
+	}
+	for first := true; ; first = false {
+		frame := data
+		if c.fragmentSize > 0 && len(frame) > c.fragmentSize {
+			frame = frame[:c.fragmentSize]
+		}
+		data = data[len(frame):]
+		frameOp := OpContinuation
+		if first {
+			frameOp = op
+		}
+		c.writeFrame(frameOp, len(data) == 0, compressed && first, frame)
+		if len(data) == 0 {
+			break
+		}
+	}
+	c.flush()
+	return nil
+}
+
+// Ping sends a ping with the data. The pong is passed to the message callback.
+func (c *Conn) Ping(data []byte) error {
+	if c.state != connOpen {
+		return ErrClosed
+	}
+	if len(data) > maxControlPayload {
+		return errors.New("websocket control payload too large")
+	}
+	c.writeFrame(OpPing, true, false, data)
+	c.flush()
+	return nil
+}
+
+// Close starts the close handshake with the status code and the reason.
+// The connection is closed when the peer answers or the handshake times out.
+func (c *Conn) Close(code int, reason string) error {
+	if c.state != connOpen {
+		return ErrClosed
+	}
+	c.sendClose(code, reason)
+	return nil
+}
+
+func (c *Conn) sendClose(code int, reason string) {
+	payload := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	payload = append(payload, reason...)
+	if len(payload) > maxControlPayload {
+		payload = payload[:maxControlPayload]
+	}
+	c.writeFrame(OpClose, true, false, payload)
+	c.state = connClosing
+	c.timer.Attach(closeTimeout)
+	c.flush()
+}
+
+// fail closes the connection with the status code after a protocol violation.
+func (c *Conn) fail(code int) {
+	if c.state == connOpen {
+		c.closeCode = code
+		c.sendClose(code, "")
+	}
+	c.closeAfterFlush = true
+	c.flush()
+}
+
+func (c *Conn) writeFrame(op int, fin, rsv1 bool, payload []byte) {
+	var hdr [14]byte
+	hdr[0] = byte(op)
+	if fin {
+		hdr[0] |= 0x80
+	}
+	if rsv1 {
+		hdr[0] |= 0x40
+	}
+	n := 2
+	switch {
+	case len(payload) < 126:
+		hdr[1] = byte(len(payload))
+	case len(payload) <= 0xffff:
+		hdr[1] = 126
+		binary.BigEndian.PutUint16(hdr[2:], uint16(len(payload)))
+		n = 4
+	default:
+		hdr[1] = 127
+		binary.BigEndian.PutUint64(hdr[2:], uint64(len(payload)))
+		n = 10
+	}
+	if !c.client {
+		c.out.Write(hdr[:n])
+		c.out.Write(payload)
+		return
+	}
+	hdr[1] |= 0x80
+	mask := hdr[n : n+4]
+	rand.Read(mask)
+	c.out.Write(hdr[:n+4])
+	masked := make([]byte, len(payload))
+	for i := range payload {
+		masked[i] = payload[i] ^ mask[i&3]
+	}
+	c.out.Write(masked)
+}
+
+func (c *Conn) onRead(fd int, events uint32, arg interface{}) {
+	_, err := c.in.ReadFd(fd)
+	if err == syscall.EAGAIN {
+		return
+	}
+	if err != nil {
+		if c.state == connHandshake {
+			c.handshakeFailed(err)
+			return
+		}
+		c.finish()
+		return
+	}
+	if c.state == connHandshake {
+		if !c.readHandshake() {
+			return
+		}
+	}
+	c.process()
+}
+
+func (c *Conn) onWrite(fd int, events uint32, arg interface{}) {
+	c.flush()
+}
+
+func (c *Conn) onTimeout(fd int, events uint32, arg interface{}) {
+	if c.state == connHandshake {
+		c.handshakeFailed(ErrBadHandshake)
+		return
+	}
+	c.finish()
+}
+
+func (c *Conn) flush() {
+	if c.state == connClosed {
+		return
+	}
+	_, err := c.out.WriteFd(c.fd)
+	if err == syscall.EAGAIN {
+		c.wev.Attach(0)
+		return
+	}
+	c.wev.Detach()
+	if err != nil || c.closeAfterFlush {
+		c.finish()
+	}
+}
+
+// process parses and handles the frames in the input buffer.
+func (c *Conn) process() {
+	for c.state == connOpen || c.state == connClosing {
+		if c.closeAfterFlush {
+			return
+		}
+		p := c.in.Bytes()
+		if len(p) < 2 {
+			return
+		}
+		fin := p[0]&0x80 != 0
+		rsv1 := p[0]&0x40 != 0
+		op := int(p[0] & 0x0f)
+		masked := p[1]&0x80 != 0
+		length := uint64(p[1] & 0x7f)
+		n := 2
+		switch length {
+		case 126:
+			if len(p) < 4 {
+				return
+			}
+			length = uint64(binary.BigEndian.Uint16(p[2:]))
+			n = 4
+		case 127:
+			if len(p) < 10 {
+				return
+			}
+			length = binary.BigEndian.Uint64(p[2:])
+			n = 10
+		}
+		if p[0]&0x30 != 0 || masked == c.client || rsv1 && (!c.compress || op == OpContinuation || op >= OpClose) {
+			c.fail(CloseProtocolError)
+			return
+		}
+		if op >= OpClose && (!fin || length > maxControlPayload) {
+			c.fail(CloseProtocolError)
+			return
+		}
+		if length > uint64(c.maxSize) || op == OpContinuation && len(c.msg)+int(length) > c.maxSize {
+			c.fail(CloseMessageTooBig)
+			return
+		}
+		if masked {
+			n += 4
+		}
+		if uint64(len(p)) < uint64(n)+length {
+			return
+		}
+		payload := p[n : n+int(length)]
+		if masked {
+			mask := p[n-4 : n]
+			for i := range payload {
+				payload[i] ^= mask[i&3]
+			}
+		}
+		if !c.handleFrame(op, fin, rsv1, payload) {
+			return
+		}
+		c.in.Drain(n + int(length))
+	}
+}
+
+// handleFrame handles a frame and returns false if the connection is failed.
+func (c *Conn) handleFrame(op int, fin, rsv1 bool, payload []byte) bool {
+	switch op {
+	case OpText, OpBinary:
+		if c.msgOp != 0 {
+			c.fail(CloseProtocolError)
+			return false
+		}
+		if fin {
+			return c.deliver(op, rsv1, payload)
+		}
+		c.msgOp = op
+		c.msgCompressed = rsv1
+		c.msg = append(c.msg[:0], payload...)
+	case OpContinuation:
+		if c.msgOp == 0 {
+			c.fail(CloseProtocolError)
+			return false
+		}
+		c.msg = append(c.msg, payload...)
+		if fin {
+			op := c.msgOp
+			c.msgOp = 0
+			return c.deliver(op, c.msgCompressed, c.msg)
+		}
+	case OpPing:
+		if c.state == connOpen {
+			c.writeFrame(OpPong, true, false, payload)
+			c.flush()
+		}
+	case OpPong:
+		if c.state == connOpen && c.onMessage != nil {
+			c.onMessage(c, OpPong, payload)
+		}
+	case OpClose:
+		code, reason := CloseNoStatus, ""
+		if len(payload) == 1 {
+			c.fail(CloseProtocolError)
+			return false
+		}
+		if len(payload) >= 2 {
+			code = int(binary.BigEndian.Uint16(payload))
+			reason = string(payload[2:])
+			if !validCloseCode(code) || !utf8.ValidString(reason) {
+				c.fail(CloseProtocolError)
+				return false
+			}
+		}
+		c.closeCode, c.closeReason = code, reason
+		if c.state == connOpen {
+			echo := code
+			if code == CloseNoStatus {
+				echo = CloseNormal
+			}
+			c.sendClose(echo, "")
+		}
+		c.closeAfterFlush = true
+		c.flush()
+		return false
+	default:
+		c.fail(CloseProtocolError)
+		return false
+	}
+	return true
+}
+
+// deliver passes a complete message to the callback and returns false if the connection is failed.
+func (c *Conn) deliver(op int, compressed bool, data []byte) bool {
+	if compressed {
+		var err error
+		if data, err = decompressMessage(data, c.maxSize); err != nil {
+			if err == errMessageTooBig {
+				c.fail(CloseMessageTooBig)
+			} else {
+				c.fail(CloseInvalidPayload)
+			}
+			return false
+		}
+	}
+	if op == OpText && !utf8.Valid(data) {
+		c.fail(CloseInvalidPayload)
+		return false
+	}
+	if c.state == connOpen && c.onMessage != nil {
+		c.onMessage(c, op, data)
+	}
+	return true
+}
+
+// finish closes the socket and calls the close callback.
+func (c *Conn) finish() {
+	if c.state == connClosed {
+		return
+	}
+	c.state = connClosed
+	c.rev.Detach()
+	c.wev.Detach()
+	c.timer.Detach()
+	syscall.Close(c.fd)
+	if c.closeCode == 0 {
+		c.closeCode = CloseAbnormal
+	}
+	if c.onClose != nil {
+		c.onClose(c, c.closeCode, c.closeReason)
+	}
+}
+
+func validCloseCode(code int) bool {
+	switch {
+	case code >= 1000 && code <= 1003, code >= 1007 && code <= 1011, code >= 3000 && code <= 4999:
+		return true
+	}
+	return false
+}
+
+// compressMessage compresses the message without the context takeover.
+func compressMessage(data []byte) []byte {
+	var b bytes.Buffer
+	w, _ := flate.NewWriter(&b, flate.BestSpeed)
+	w.Write(data)
+	w.Flush()
+	return bytes.TrimSuffix(b.Bytes(), deflateTail[:4])
+}
+
+// decompressMessage decompresses the message up to the maximum size.
+func decompressMessage(data []byte, maxSize int) ([]byte, error) {
+	r := flate.NewReader(io.MultiReader(bytes.NewReader(data), bytes.NewReader(deflateTail)))
+	defer r.Close()
+	var b bytes.Buffer
+	n, err := b.ReadFrom(io.LimitReader(r, int64(maxSize)+1))
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	if n > int64(maxSize) {
+		return nil, errMessageTooBig
+	}
+	return b.Bytes(), nil
+}
@@ -0,0 +1,311 @@
+// Copyright (c) 2023 cheng-zhongliang. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"net"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strings"
+	"syscall"
+
+	"github.com/cheng-zhongliang/event"
+	"github.com/cheng-zhongliang/event/evhttp"
+)
+
+const (
+	// acceptGUID is the GUID to compute the Sec-WebSocket-Accept header.
+	acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	// deflateExtension is the permessage-deflate extension without the context takeover.
+	deflateExtension = "permessage-deflate; server_no_context_takeover; client_no_context_takeover"
+	// maxHandshakeSize is the maximum size of the handshake response.
+	maxHandshakeSize = 1 << 13
+)
+
+var ErrUnsupportedScheme = errors.New("websocket unsupported url scheme")
+
+// Upgrade upgrades the HTTP request to a WebSocket connection.
+// It must be called by the handler before the request is replied.
+// The request is replied with 400 if it is not a valid WebSocket handshake.
+func Upgrade(req *evhttp.Request, config *Config) (*Conn, error) {
+	if config == nil {
+		config = new(Config)
+	}
+	key := req.Header.Get("Sec-WebSocket-Key")
+	if req.Method != "GET" ||
+		!headerContains(req.Header, "Upgrade", "websocket") ||
+		!headerContains(req.Header, "Connection", "upgrade") ||
+		req.Header.Get("Sec-WebSocket-Version") != "13" || !validKey(key) {
+		req.ResponseHeader.Set("Sec-WebSocket-Version", "13")
+		req.Reply(evhttp.StatusBadRequest, nil)
+		return nil, ErrBadHandshake
+	}
+	fd, rest, err := req.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	c, err := newConn(req.Base(), fd, false, config)
+	if err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+	c.state = connOpen
+
+	header := textproto.MIMEHeader{}
+	header.Set("Upgrade", "websocket")
+	header.Set("Connection", "Upgrade")
+	header.Set("Sec-WebSocket-Accept", acceptKey(key))
+	if c.subprotocol = selectSubprotocol(req.Header, config.Subprotocols); c.subprotocol != "" {
+		header.Set("Sec-WebSocket-Protocol", c.subprotocol)
+	}
+	if config.Compression && acceptDeflate(req.Header) {
+		c.compress = true
+		header.Set("Sec-WebSocket-Extensions", deflateExtension)
+	}
+	c.out.WriteString("HTTP/1.1 101 Switching Protocols\r\n")
+	for k, vs := range header {
+		for _, v := range vs {
+			c.out.WriteString(k + ": " + v + "\r\n")
+		}
+	}
+	c.out.WriteString("\r\n")
+	c.flush()
+
+	if len(rest) > 0 {
+		c.in.Write(rest)
+		// process the frames after the caller sets the callbacks.
+		event.NewTimer(req.Base(), func(fd int, events uint32, arg interface{}) {
+			c.process()
+		}, nil).Attach(0)
+	}
+	return c, nil
+}
+
+// Dial opens a WebSocket connection to the ws:// url.
+// The callback is called with the connection when the handshake completes, or with the error.
+// Host names are resolved by a new resolver of the base.
+func Dial(base *event.EventBase, rawurl string, config *Config, callback func(c *Conn, err error, arg interface{}), arg interface{}) error {
+	if config == nil {
+		config = new(Config)
+	}
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "ws" {
+		return ErrUnsupportedScheme
+	}
+	host, port := u.Hostname(), u.Port()
+	if port == "" {
+		port = "80"
+	}
+
+	var key [16]byte
+	if _, err := rand.Read(key[:]); err != nil {
+		return err
+	}
+	d := &dialer{
+		base:   base,
+		config: config,
+		u:      u,
+		key:    base64.StdEncoding.EncodeToString(key[:]),
+		cb:     callback,
+		arg:    arg,
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		return d.connect(ip, port)
+	}
+	r, err := event.NewResolver(base)
+	if err != nil {
+		return err
+	}
+	return r.LookupHost(host, func(addrs []net.IP, err error, arg interface{}) {
+		r.Close()
+		if err == nil {
+			err = d.connect(addrs[0], port)
+		}
+		if err != nil {
+			callback(nil, err, d.arg)
+		}
+	}, nil)
+}
+
+// dialer is the state of a client handshake.
+type dialer struct {
+	base   *event.EventBase
+	config *Config
+	u      *url.URL
+	key    string
+	cb     func(c *Conn, err error, arg interface{})
+	arg    interface{}
+}
+
+func (d *dialer) connect(ip net.IP, port string) error {
+	return event.Connect(d.base, "tcp", net.JoinHostPort(ip.String(), port), closeTimeout, func(fd int, err error, arg interface{}) {
+		if err != nil {
+			d.cb(nil, err, d.arg)
+			return
+		}
+		c, err := newConn(d.base, fd, true, d.config)
+		if err != nil {
+			syscall.Close(fd)
+			d.cb(nil, err, d.arg)
+			return
+		}
+		c.handshakeKey = d.key
+		c.onOpen = func(c *Conn, err error) {
+			d.cb(c, err, d.arg)
+		}
+		c.timer.Attach(closeTimeout)
+		c.writeHandshake(d.u, d.config)
+	}, nil)
+}
+
+func (c *Conn) writeHandshake(u *url.URL, config *Config) {
+	header := textproto.MIMEHeader{}
+	header.Set("Host", u.Host)
+	header.Set("Upgrade", "websocket")
+	header.Set("Connection", "Upgrade")
+	header.Set("Sec-WebSocket-Key", c.handshakeKey)
+	header.Set("Sec-WebSocket-Version", "13")
+	if len(config.Subprotocols) > 0 {
+		header.Set("Sec-WebSocket-Protocol", strings.Join(config.Subprotocols, ", "))
+	}
+	if config.Compression {
+		header.Set("Sec-WebSocket-Extensions", deflateExtension)
+	}
+	c.subprotocols = config.Subprotocols
+	c.offerDeflate = config.Compression
+	c.out.WriteString("GET " + u.RequestURI() + " HTTP/1.1\r\n")
+	for k, vs := range header {
+		for _, v := range vs {
+			c.out.WriteString(k + ": " + v + "\r\n")
+		}
+	}
+	c.out.WriteString("\r\n")
+	c.flush()
+}
+
+// readHandshake reads the handshake response and returns true if the connection is open.
+func (c *Conn) readHandshake() bool {
+	p := c.in.Bytes()
+	i := bytes.Index(p, []byte("\r\n\r\n"))
+	if i < 0 {
+		if len(p) > maxHandshakeSize {
+			c.handshakeFailed(ErrBadHandshake)
+		}
+		return false
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(p[:i+4])), nil)
+	if err != nil {
+		c.handshakeFailed(err)
+		return false
+	}
+	c.in.Drain(i + 4)
+	header := textproto.MIMEHeader(resp.Header)
+	if resp.StatusCode != evhttp.StatusSwitchingProtocols ||
+		!headerContains(header, "Upgrade", "websocket") ||
+		!headerContains(header, "Connection", "upgrade") ||
+		header.Get("Sec-WebSocket-Accept") != acceptKey(c.handshakeKey) {
+		c.handshakeFailed(ErrBadHandshake)
+		return false
+	}
+	if ext := header.Get("Sec-WebSocket-Extensions"); ext != "" {
+		if !c.offerDeflate || !acceptDeflate(header) {
+			c.handshakeFailed(ErrBadHandshake)
+			return false
+		}
+		c.compress = true
+	}
+	if proto := header.Get("Sec-WebSocket-Protocol"); proto != "" {
+		found := false
+		for _, p := range c.subprotocols {
+			found = found || p == proto
+		}
+		if !found {
+			c.handshakeFailed(ErrBadHandshake)
+			return false
+		}
+		c.subprotocol = proto
+	}
+	c.state = connOpen
+	c.timer.Detach()
+	c.onOpen(c, nil)
+	return true
+}
+
+// handshakeFailed closes the connection and reports the error of the client handshake.
+func (c *Conn) handshakeFailed(err error) {
+	c.state = connClosed
+	c.rev.Detach()
+	c.wev.Detach()
+	c.timer.Detach()
+	syscall.Close(c.fd)
+	c.onOpen(nil, err)
+}
+
+func acceptKey(key string) string {
+	h := sha1.Sum([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+func validKey(key string) bool {
+	b, err := base64.StdEncoding.DecodeString(key)
+	return err == nil && len(b) == 16
+}
+
+// headerContains reports whether the comma separated header contains the token.
+func headerContains(header textproto.MIMEHeader, name, token string) bool {
+	for _, v := range header[textproto.CanonicalMIMEHeaderKey(name)] {
+		for _, s := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(s), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// selectSubprotocol returns the first subprotocol of the server offered by the client.
+func selectSubprotocol(header textproto.MIMEHeader, protocols []string) string {
+	for _, p := range protocols {
+		if headerContains(header, "Sec-WebSocket-Protocol", p) {
+			return p
+		}
+	}
+	return ""
+}
+
+// acceptDeflate reports whether a permessage-deflate offer can be accepted.
+// The window of the compressor is fixed, so offers limiting the server window are declined.
+func acceptDeflate(header textproto.MIMEHeader) bool {
+	for _, v := range header["Sec-Websocket-Extensions"] {
+		for _, ext := range strings.Split(v, ",") {
+			params := strings.Split(ext, ";")
+			if strings.TrimSpace(params[0]) != "permessage-deflate" {
+				continue
+			}
+			ok := true
+			for _, param := range params[1:] {
+				param = strings.TrimSpace(param)
+				if strings.HasPrefix(param, "server_max_window_bits") && param != "server_max_window_bits=15" {
+					ok = false
+				}
+			}
+			if ok {
+				return true
+			}
+		}
+	}
+	return false
+}
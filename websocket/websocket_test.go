@@ -0,0 +1,202 @@
+// Copyright (c) 2023 cheng-zhongliang. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package websocket_test
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/cheng-zhongliang/event"
+	"github.com/cheng-zhongliang/event/evhttp"
+	. "github.com/cheng-zhongliang/event/websocket"
+)
+
+// runUntil runs the event loop until the done channel is closed.
+func runUntil(t *testing.T, base *event.EventBase, done chan struct{}) {
+	stopped := int32(0)
+	go func() {
+		<-done
+		atomic.StoreInt32(&stopped, 1)
+	}()
+	ticker := event.NewTicker(base, func(fd int, events uint32, arg interface{}) {}, nil)
+	if err := ticker.Attach(5 * time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); atomic.LoadInt32(&stopped) == 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("test timed out")
+		}
+		if err := base.Loop(event.EvLoopOnce); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ticker.Detach()
+}
+
+// echoServer starts a server echoing the messages and returns its address.
+func echoServer(t *testing.T, base *event.EventBase, config *Config) (*evhttp.Server, string) {
+	s := evhttp.NewServer(base, func(req *evhttp.Request) {
+		c, err := Upgrade(req, config)
+		if err != nil {
+			return
+		}
+		c.OnMessage(func(c *Conn, op int, data []byte) {
+			c.WriteMessage(op, data)
+		})
+	})
+	ln, err := s.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sa, err := ln.Addr()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, "127.0.0.1:" + strconv.Itoa(sa.(*syscall.SockaddrInet4).Port)
+}
+
+func TestEcho(t *testing.T) {
+	base, err := event.NewBase()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := &Config{Compression: true, FragmentSize: 16, Subprotocols: []string{"chat"}}
+	s, addr := echoServer(t, base, config)
+
+	done := make(chan struct{})
+	big := strings.Repeat("hello world ", 100)
+	var got []string
+	closeCode := 0
+	err = Dial(base, "ws://"+addr+"/", config, func(c *Conn, err error, arg interface{}) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.Subprotocol() != "chat" {
+			t.Fatalf("subprotocol %q not equal", c.Subprotocol())
+		}
+		c.OnMessage(func(c *Conn, op int, data []byte) {
+			got = append(got, string(data))
+			switch len(got) {
+			case 1:
+				c.WriteMessage(OpBinary, []byte(big))
+			case 2:
+				c.Ping([]byte("ping"))
+			case 3:
+				c.Close(CloseNormal, "bye")
+			}
+		})
+		c.OnClose(func(c *Conn, code int, reason string) {
+			closeCode = code
+			close(done)
+		})
+		c.WriteMessage(OpText, []byte("hello"))
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runUntil(t, base, done)
+
+	if len(got) != 3 || got[0] != "hello" || got[1] != big || got[2] != "ping" {
+		t.Fatalf("messages %q not equal", got)
+	}
+	if closeCode != CloseNormal {
+		t.Fatalf("close code %d not equal", closeCode)
+	}
+
+	s.Close()
+	if err := base.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProtocolError(t *testing.T) {
+	base, err := event.NewBase()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, addr := echoServer(t, base, nil)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+
+		io.WriteString(conn, "GET / HTTP/1.1\r\nHost: x\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+			"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n")
+		r := bufio.NewReader(conn)
+		resp, err := http.ReadResponse(r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if resp.StatusCode != evhttp.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+			t.Errorf("response %d %q not equal", resp.StatusCode, resp.Header.Get("Sec-WebSocket-Accept"))
+			return
+		}
+
+		// an unmasked frame from the client is a protocol error.
+		conn.Write([]byte{0x81, 0x02, 'h', 'i'})
+		frame, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if len(frame) != 4 || frame[0] != 0x88 || binary.BigEndian.Uint16(frame[2:]) != CloseProtocolError {
+			t.Errorf("close frame %x not equal", frame)
+		}
+	}()
+	runUntil(t, base, done)
+
+	s.Close()
+	if err := base.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBadHandshake(t *testing.T) {
+	base, err := event.NewBase()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, addr := echoServer(t, base, nil)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		resp, err := http.Get("http://" + addr + "/")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		resp.Body.Close()
+		if resp.StatusCode != evhttp.StatusBadRequest || resp.Header.Get("Sec-WebSocket-Version") != "13" {
+			t.Errorf("response %d not equal", resp.StatusCode)
+		}
+	}()
+	runUntil(t, base, done)
+
+	s.Close()
+	if err := base.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+}